@@ -0,0 +1,88 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Grant is a permission given to a grantee on a file
+type Grant struct {
+	GranteeType  string // GranteeType is CanonicalUser, AmazonCustomerByEmail or Group
+	GranteeID    string // GranteeID is the canonical user ID of CanonicalUser grantees
+	DisplayName  string // DisplayName is the name of CanonicalUser grantees
+	EmailAddress string // EmailAddress identifies AmazonCustomerByEmail grantees
+	URI          string // URI identifies Group grantees, like http://acs.amazonaws.com/groups/global/AllUsers
+	Permission   string // Permission is FULL_CONTROL, WRITE, WRITE_ACP, READ or READ_ACP
+}
+
+// GetACLGrants returns all the grants of the ACL of a file
+func (fs *Fs) GetACLGrants(name string) ([]Grant, error) {
+	if name = fs.sanitize(name); isRoot(name) {
+		return nil, rootError("getacl", name)
+	}
+
+	out, err := fs.S3API.GetObjectAclWithContext(aws.BackgroundContext(), &s3.GetObjectAclInput{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+		Key:                 aws.String(fs.key(name)),
+	}, fs.requestOptions()...)
+	if err != nil {
+		return nil, permissionError(err)
+	}
+
+	grants := make([]Grant, 0, len(out.Grants))
+	for _, grant := range out.Grants {
+		g := Grant{Permission: aws.StringValue(grant.Permission)}
+		if grantee := grant.Grantee; grantee != nil {
+			g.GranteeType = aws.StringValue(grantee.Type)
+			g.GranteeID = aws.StringValue(grantee.ID)
+			g.DisplayName = aws.StringValue(grantee.DisplayName)
+			g.EmailAddress = aws.StringValue(grantee.EmailAddress)
+			g.URI = aws.StringValue(grantee.URI)
+		}
+		grants = append(grants, g)
+	}
+	return grants, nil
+}
+
+// chmodAllConcurrency is the number of files whose ACL ChmodAll sets at the same time
+var chmodAllConcurrency = 8
+
+// ChmodAll sets the ACL of all the files under a directory, directory markers included, from permissions like Chmod
+// does. The ACLs are set concurrently, and the files failing to be updated are reported in a *BatchError.
+func (fs *Fs) ChmodAll(prefix string, mode os.FileMode) error {
+	acl := permACL(mode)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := &BatchError{}
+	sem := make(chan struct{}, chmodAllConcurrency)
+
+	err := fs.walkAllObjects(fs.dirPrefix(prefix), func(obj *s3.Object) error {
+		name := fs.keyName(*obj.Key)
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fs.putACL(name, acl); err != nil {
+				mu.Lock()
+				failed.add(name, permissionError(err))
+				mu.Unlock()
+			}
+		}()
+		return nil
+	})
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+	return failed.errOrNil()
+}
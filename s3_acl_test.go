@@ -0,0 +1,96 @@
+package s3
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetACLGrants(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	mock.putObject("bucket", "file", []byte("content"), time.Now()).grants = []*s3.Grant{
+		{
+			Grantee: &s3.Grantee{
+				Type:        aws.String(s3.TypeCanonicalUser),
+				ID:          aws.String("79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be"),
+				DisplayName: aws.String("owner"),
+			},
+			Permission: aws.String(s3.PermissionFullControl),
+		},
+		{
+			Grantee: &s3.Grantee{
+				Type: aws.String(s3.TypeGroup),
+				URI:  aws.String("http://acs.amazonaws.com/groups/global/AllUsers"),
+			},
+			Permission: aws.String(s3.PermissionRead),
+		},
+	}
+
+	grants, err := fs.GetACLGrants("/file")
+	req.NoError(err)
+	req.Equal([]Grant{
+		{
+			GranteeType: "CanonicalUser",
+			GranteeID:   "79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be",
+			DisplayName: "owner",
+			Permission:  "FULL_CONTROL",
+		},
+		{
+			GranteeType: "Group",
+			URI:         "http://acs.amazonaws.com/groups/global/AllUsers",
+			Permission:  "READ",
+		},
+	}, grants)
+
+	_, err = fs.GetACLGrants("/missing")
+	req.Error(err)
+	req.NotErrorIs(err, os.ErrPermission)
+}
+
+func TestChmodAll(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	keys := []string{"public/", "public/index.html", "public/css/", "public/css/style.css"}
+	for i := 0; i < 20; i++ {
+		keys = append(keys, fmt.Sprintf("public/img/%02d.png", i))
+	}
+	for _, key := range keys {
+		mock.putObject("bucket", key, []byte(key), time.Now())
+	}
+	mock.putObject("bucket", "private/file", []byte("private"), time.Now())
+	mock.putObject("bucket", "public-internal/secret", []byte("secret"), time.Now())
+
+	req.NoError(fs.ChmodAll("/public", 0o644))
+	for _, key := range keys {
+		req.Equal("public-read", aws.StringValue(mock.getObject("bucket", key).acl), key)
+	}
+	req.Nil(mock.getObject("bucket", "private/file").acl)
+	req.Nil(mock.getObject("bucket", "public-internal/secret").acl)
+	req.Equal(len(keys), mock.count("PutObjectAcl"))
+
+	t.Run("Failures", func(t *testing.T) {
+		mock.hook = func(op string, input interface{}) error {
+			if in, ok := input.(*s3.PutObjectAclInput); ok && strings.HasSuffix(*in.Key, ".css") {
+				return awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "mock")
+			}
+			return nil
+		}
+		defer func() { mock.hook = nil }()
+
+		err := fs.ChmodAll("/public", 0o600)
+		var batchErr *BatchError
+		req.ErrorAs(err, &batchErr)
+		req.Len(batchErr.Errors, 1)
+		req.Equal("private", aws.StringValue(mock.getObject("bucket", "public/index.html").acl))
+	})
+}
@@ -0,0 +1,297 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// API is the part of the S3 client the core operations of an Fs use: Stat, Open, Readdir, Create, the writes,
+// Remove, RemoveAll and Mkdir. It's the interface the clients plugged with NewFsWithAPI, like adapters to another SDK,
+// have to implement.
+type API interface {
+	HeadObjectWithContext(aws.Context, *s3.HeadObjectInput, ...request.Option) (*s3.HeadObjectOutput, error)
+	GetObjectWithContext(aws.Context, *s3.GetObjectInput, ...request.Option) (*s3.GetObjectOutput, error)
+	PutObjectWithContext(aws.Context, *s3.PutObjectInput, ...request.Option) (*s3.PutObjectOutput, error)
+	DeleteObjectWithContext(aws.Context, *s3.DeleteObjectInput, ...request.Option) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2WithContext(
+		aws.Context, *s3.ListObjectsV2Input, ...request.Option,
+	) (*s3.ListObjectsV2Output, error)
+	CreateMultipartUploadWithContext(
+		aws.Context, *s3.CreateMultipartUploadInput, ...request.Option,
+	) (*s3.CreateMultipartUploadOutput, error)
+	UploadPartWithContext(aws.Context, *s3.UploadPartInput, ...request.Option) (*s3.UploadPartOutput, error)
+	CompleteMultipartUploadWithContext(
+		aws.Context, *s3.CompleteMultipartUploadInput, ...request.Option,
+	) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUploadWithContext(
+		aws.Context, *s3.AbortMultipartUploadInput, ...request.Option,
+	) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// apiClient turns an API into the s3iface.S3API an Fs uses. The methods of the other features are called on the API
+// when it implements them, and fail with ErrNotImplemented otherwise. The methods the Fs never calls aren't
+// implemented.
+type apiClient struct {
+	s3iface.S3API
+	api API
+}
+
+// notImplemented is returned by the methods the API doesn't implement
+func notImplemented(op string) error {
+	return fmt.Errorf("%s: %w by the client", op, ErrNotImplemented)
+}
+
+func (c *apiClient) HeadObjectWithContext(
+	ctx aws.Context, in *s3.HeadObjectInput, opts ...request.Option,
+) (*s3.HeadObjectOutput, error) {
+	return c.api.HeadObjectWithContext(ctx, in, opts...)
+}
+
+func (c *apiClient) GetObjectWithContext(
+	ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option,
+) (*s3.GetObjectOutput, error) {
+	return c.api.GetObjectWithContext(ctx, in, opts...)
+}
+
+func (c *apiClient) PutObjectWithContext(
+	ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option,
+) (*s3.PutObjectOutput, error) {
+	return c.api.PutObjectWithContext(ctx, in, opts...)
+}
+
+func (c *apiClient) DeleteObjectWithContext(
+	ctx aws.Context, in *s3.DeleteObjectInput, opts ...request.Option,
+) (*s3.DeleteObjectOutput, error) {
+	return c.api.DeleteObjectWithContext(ctx, in, opts...)
+}
+
+func (c *apiClient) ListObjectsV2WithContext(
+	ctx aws.Context, in *s3.ListObjectsV2Input, opts ...request.Option,
+) (*s3.ListObjectsV2Output, error) {
+	return c.api.ListObjectsV2WithContext(ctx, in, opts...)
+}
+
+func (c *apiClient) CreateMultipartUploadWithContext(
+	ctx aws.Context, in *s3.CreateMultipartUploadInput, opts ...request.Option,
+) (*s3.CreateMultipartUploadOutput, error) {
+	return c.api.CreateMultipartUploadWithContext(ctx, in, opts...)
+}
+
+func (c *apiClient) UploadPartWithContext(
+	ctx aws.Context, in *s3.UploadPartInput, opts ...request.Option,
+) (*s3.UploadPartOutput, error) {
+	return c.api.UploadPartWithContext(ctx, in, opts...)
+}
+
+func (c *apiClient) CompleteMultipartUploadWithContext(
+	ctx aws.Context, in *s3.CompleteMultipartUploadInput, opts ...request.Option,
+) (*s3.CompleteMultipartUploadOutput, error) {
+	return c.api.CompleteMultipartUploadWithContext(ctx, in, opts...)
+}
+
+func (c *apiClient) AbortMultipartUploadWithContext(
+	ctx aws.Context, in *s3.AbortMultipartUploadInput, opts ...request.Option,
+) (*s3.AbortMultipartUploadOutput, error) {
+	return c.api.AbortMultipartUploadWithContext(ctx, in, opts...)
+}
+
+// newRequest creates a request that isn't sent over HTTP, for the uploader expecting aws-sdk-go requests
+func newRequest(name string, in, out interface{}) *request.Request {
+	return request.New(
+		aws.Config{}, metadata.ClientInfo{}, request.Handlers{}, nil, &request.Operation{Name: name}, in, out,
+	)
+}
+
+// PutObjectRequest is used by the uploader for uploads fitting in a single part, the request is sent with
+// PutObjectWithContext
+func (c *apiClient) PutObjectRequest(in *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput) {
+	out := &s3.PutObjectOutput{}
+	req := newRequest("PutObject", in, out)
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		resp, err := c.api.PutObjectWithContext(r.Context(), in)
+		if err != nil {
+			r.Error = err
+			return
+		}
+		*out = *resp
+	})
+	return req, out
+}
+
+// GetObjectRequest is only used by the uploader to give the location of the multipart uploads, which isn't known
+func (c *apiClient) GetObjectRequest(in *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	out := &s3.GetObjectOutput{}
+	return newRequest("GetObject", in, out), out
+}
+
+// WaitUntilObjectExistsWithContext is used by Create. Without a waiter, the file is looked up once.
+func (c *apiClient) WaitUntilObjectExistsWithContext(
+	ctx aws.Context, in *s3.HeadObjectInput, opts ...request.WaiterOption,
+) error {
+	if api, ok := c.api.(interface {
+		WaitUntilObjectExistsWithContext(aws.Context, *s3.HeadObjectInput, ...request.WaiterOption) error
+	}); ok {
+		return api.WaitUntilObjectExistsWithContext(ctx, in, opts...)
+	}
+	_, err := c.api.HeadObjectWithContext(ctx, in)
+	return err
+}
+
+func (c *apiClient) WaitUntilObjectNotExistsWithContext(
+	ctx aws.Context, in *s3.HeadObjectInput, opts ...request.WaiterOption,
+) error {
+	if api, ok := c.api.(interface {
+		WaitUntilObjectNotExistsWithContext(aws.Context, *s3.HeadObjectInput, ...request.WaiterOption) error
+	}); ok {
+		return api.WaitUntilObjectNotExistsWithContext(ctx, in, opts...)
+	}
+	return notImplemented("WaitUntilObjectNotExists")
+}
+
+func (c *apiClient) ListObjectsWithContext(
+	ctx aws.Context, in *s3.ListObjectsInput, opts ...request.Option,
+) (*s3.ListObjectsOutput, error) {
+	if api, ok := c.api.(interface {
+		ListObjectsWithContext(aws.Context, *s3.ListObjectsInput, ...request.Option) (*s3.ListObjectsOutput, error)
+	}); ok {
+		return api.ListObjectsWithContext(ctx, in, opts...)
+	}
+	return nil, notImplemented("ListObjects")
+}
+
+func (c *apiClient) CopyObjectWithContext(
+	ctx aws.Context, in *s3.CopyObjectInput, opts ...request.Option,
+) (*s3.CopyObjectOutput, error) {
+	if api, ok := c.api.(interface {
+		CopyObjectWithContext(aws.Context, *s3.CopyObjectInput, ...request.Option) (*s3.CopyObjectOutput, error)
+	}); ok {
+		return api.CopyObjectWithContext(ctx, in, opts...)
+	}
+	return nil, notImplemented("CopyObject")
+}
+
+func (c *apiClient) UploadPartCopyWithContext(
+	ctx aws.Context, in *s3.UploadPartCopyInput, opts ...request.Option,
+) (*s3.UploadPartCopyOutput, error) {
+	if api, ok := c.api.(interface {
+		UploadPartCopyWithContext(
+			aws.Context, *s3.UploadPartCopyInput, ...request.Option,
+		) (*s3.UploadPartCopyOutput, error)
+	}); ok {
+		return api.UploadPartCopyWithContext(ctx, in, opts...)
+	}
+	return nil, notImplemented("UploadPartCopy")
+}
+
+func (c *apiClient) DeleteObjectsWithContext(
+	ctx aws.Context, in *s3.DeleteObjectsInput, opts ...request.Option,
+) (*s3.DeleteObjectsOutput, error) {
+	if api, ok := c.api.(interface {
+		DeleteObjectsWithContext(aws.Context, *s3.DeleteObjectsInput, ...request.Option) (*s3.DeleteObjectsOutput, error)
+	}); ok {
+		return api.DeleteObjectsWithContext(ctx, in, opts...)
+	}
+	return nil, notImplemented("DeleteObjects")
+}
+
+func (c *apiClient) GetObjectTaggingWithContext(
+	ctx aws.Context, in *s3.GetObjectTaggingInput, opts ...request.Option,
+) (*s3.GetObjectTaggingOutput, error) {
+	if api, ok := c.api.(interface {
+		GetObjectTaggingWithContext(
+			aws.Context, *s3.GetObjectTaggingInput, ...request.Option,
+		) (*s3.GetObjectTaggingOutput, error)
+	}); ok {
+		return api.GetObjectTaggingWithContext(ctx, in, opts...)
+	}
+	return nil, notImplemented("GetObjectTagging")
+}
+
+func (c *apiClient) PutObjectTaggingWithContext(
+	ctx aws.Context, in *s3.PutObjectTaggingInput, opts ...request.Option,
+) (*s3.PutObjectTaggingOutput, error) {
+	if api, ok := c.api.(interface {
+		PutObjectTaggingWithContext(
+			aws.Context, *s3.PutObjectTaggingInput, ...request.Option,
+		) (*s3.PutObjectTaggingOutput, error)
+	}); ok {
+		return api.PutObjectTaggingWithContext(ctx, in, opts...)
+	}
+	return nil, notImplemented("PutObjectTagging")
+}
+
+func (c *apiClient) GetObjectAclWithContext(
+	ctx aws.Context, in *s3.GetObjectAclInput, opts ...request.Option,
+) (*s3.GetObjectAclOutput, error) {
+	if api, ok := c.api.(interface {
+		GetObjectAclWithContext(aws.Context, *s3.GetObjectAclInput, ...request.Option) (*s3.GetObjectAclOutput, error)
+	}); ok {
+		return api.GetObjectAclWithContext(ctx, in, opts...)
+	}
+	return nil, notImplemented("GetObjectAcl")
+}
+
+func (c *apiClient) PutObjectAclWithContext(
+	ctx aws.Context, in *s3.PutObjectAclInput, opts ...request.Option,
+) (*s3.PutObjectAclOutput, error) {
+	if api, ok := c.api.(interface {
+		PutObjectAclWithContext(aws.Context, *s3.PutObjectAclInput, ...request.Option) (*s3.PutObjectAclOutput, error)
+	}); ok {
+		return api.PutObjectAclWithContext(ctx, in, opts...)
+	}
+	return nil, notImplemented("PutObjectAcl")
+}
+
+func (c *apiClient) HeadBucketWithContext(
+	ctx aws.Context, in *s3.HeadBucketInput, opts ...request.Option,
+) (*s3.HeadBucketOutput, error) {
+	if api, ok := c.api.(interface {
+		HeadBucketWithContext(aws.Context, *s3.HeadBucketInput, ...request.Option) (*s3.HeadBucketOutput, error)
+	}); ok {
+		return api.HeadBucketWithContext(ctx, in, opts...)
+	}
+	return nil, notImplemented("HeadBucket")
+}
+
+// HeadBucketRequest is used by PresignPost to get the signing configuration of an aws-sdk-go client
+func (c *apiClient) HeadBucketRequest(in *s3.HeadBucketInput) (*request.Request, *s3.HeadBucketOutput) {
+	if api, ok := c.api.(interface {
+		HeadBucketRequest(*s3.HeadBucketInput) (*request.Request, *s3.HeadBucketOutput)
+	}); ok {
+		return api.HeadBucketRequest(in)
+	}
+	out := &s3.HeadBucketOutput{}
+	req := newRequest("HeadBucket", in, out)
+	req.Error = notImplemented("HeadBucketRequest")
+	return req, out
+}
+
+func (c *apiClient) CreateBucketWithContext(
+	ctx aws.Context, in *s3.CreateBucketInput, opts ...request.Option,
+) (*s3.CreateBucketOutput, error) {
+	if api, ok := c.api.(interface {
+		CreateBucketWithContext(aws.Context, *s3.CreateBucketInput, ...request.Option) (*s3.CreateBucketOutput, error)
+	}); ok {
+		return api.CreateBucketWithContext(ctx, in, opts...)
+	}
+	return nil, notImplemented("CreateBucket")
+}
+
+func (c *apiClient) ListMultipartUploadsWithContext(
+	ctx aws.Context, in *s3.ListMultipartUploadsInput, opts ...request.Option,
+) (*s3.ListMultipartUploadsOutput, error) {
+	if api, ok := c.api.(interface {
+		ListMultipartUploadsWithContext(
+			aws.Context, *s3.ListMultipartUploadsInput, ...request.Option,
+		) (*s3.ListMultipartUploadsOutput, error)
+	}); ok {
+		return api.ListMultipartUploadsWithContext(ctx, in, opts...)
+	}
+	return nil, notImplemented("ListMultipartUploads")
+}
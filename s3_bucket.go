@@ -0,0 +1,218 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// ErrNoSuchBucket is returned when the bucket doesn't exist. It matches os.ErrNotExist.
+var ErrNoSuchBucket = fmt.Errorf("bucket doesn't exist: %w", os.ErrNotExist)
+
+// Ping checks that the bucket exists and can be accessed with a HeadBucket, like a health check. It returns
+// ErrNoSuchBucket if the bucket doesn't exist, and a *PermissionError if the access is denied.
+func (fs *Fs) Ping() error {
+	_, err := fs.S3API.HeadBucketWithContext(aws.BackgroundContext(), &s3.HeadBucketInput{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+	}, fs.requestOptions()...)
+	if isNotFound(err) || isNoSuchBucket(err) {
+		return fmt.Errorf("%w: %s", ErrNoSuchBucket, fs.Bucket)
+	}
+	return permissionError(err)
+}
+
+// isNoSuchBucket checks if an error means the bucket doesn't exist
+func isNoSuchBucket(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchBucket
+}
+
+// createBucket creates the bucket, in the region of the session. It doesn't fail if the bucket was created in between.
+func (fs Fs) createBucket(ctx aws.Context) error {
+	input := &s3.CreateBucketInput{Bucket: aws.String(fs.Bucket)}
+	if fs.Session != nil {
+		// us-east-1 is the default location, which can't be given explicitly
+		if region := aws.StringValue(fs.Session.Config.Region); region != "" && region != "us-east-1" {
+			input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(region)}
+		}
+	}
+
+	_, err := fs.S3API.CreateBucketWithContext(ctx, input, fs.requestOptions()...)
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou {
+		return nil
+	}
+	return permissionError(err)
+}
+
+// writeAPI returns the client performing the writes. With AutoCreateBucket, it creates the bucket when a write fails
+// because the bucket doesn't exist. Otherwise, with WithBucketCheck, it checks that the bucket exists first. With
+// WithMaxConcurrentUploads, the requests sending content wait for a free upload slot.
+func (fs Fs) writeAPI(api s3iface.S3API) s3iface.S3API {
+	if fs.uploadSlots != nil {
+		api = &uploadLimiter{S3API: api, slots: fs.uploadSlots}
+	}
+	if fs.AutoCreateBucket {
+		return &bucketCreator{S3API: api, fs: fs}
+	}
+	if fs.bucketCheck != nil {
+		return &bucketChecker{S3API: api, fs: fs}
+	}
+	return api
+}
+
+// bucketCheck remembers that the bucket was checked, once it was found to exist
+type bucketCheck struct {
+	mu      sync.Mutex
+	checked bool
+}
+
+// checkBucket checks that the bucket exists before a write, when enabled with WithBucketCheck, and returns
+// ErrNoSuchBucket otherwise. A missing bucket is checked again by the next write. The writes aren't prevented when
+// the bucket can't be looked up, like when HeadBucket isn't allowed, they fail by themselves if needed.
+func (fs Fs) checkBucket() error {
+	c := fs.bucketCheck
+	if c == nil || fs.AutoCreateBucket {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checked {
+		return nil
+	}
+
+	var permErr *PermissionError
+	switch err := fs.Ping(); {
+	case errors.Is(err, ErrNoSuchBucket):
+		return err
+	case err == nil || errors.As(err, &permErr):
+		c.checked = true
+	}
+	return nil
+}
+
+// bucketChecker checks that the bucket exists before the writes starting a file
+type bucketChecker struct {
+	s3iface.S3API
+	fs Fs
+}
+
+func (c *bucketChecker) PutObjectWithContext(
+	ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option,
+) (*s3.PutObjectOutput, error) {
+	if err := c.fs.checkBucket(); err != nil {
+		return nil, err
+	}
+	return c.S3API.PutObjectWithContext(ctx, in, opts...)
+}
+
+// PutObjectRequest is used by the uploader for uploads fitting in a single part. The request fails without being sent
+// if the bucket doesn't exist.
+func (c *bucketChecker) PutObjectRequest(in *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput) {
+	req, out := c.S3API.PutObjectRequest(in)
+	if err := c.fs.checkBucket(); err != nil {
+		req.Error = err
+	}
+	return req, out
+}
+
+func (c *bucketChecker) CreateMultipartUploadWithContext(
+	ctx aws.Context, in *s3.CreateMultipartUploadInput, opts ...request.Option,
+) (*s3.CreateMultipartUploadOutput, error) {
+	if err := c.fs.checkBucket(); err != nil {
+		return nil, err
+	}
+	return c.S3API.CreateMultipartUploadWithContext(ctx, in, opts...)
+}
+
+// bucketCreator creates the missing bucket of the writes starting a file, and retries them once
+type bucketCreator struct {
+	s3iface.S3API
+	fs Fs
+}
+
+func (c *bucketCreator) PutObjectWithContext(
+	ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option,
+) (*s3.PutObjectOutput, error) {
+	start, err := bodyStart(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.S3API.PutObjectWithContext(ctx, in, opts...)
+	if !isNoSuchBucket(err) {
+		return out, err
+	}
+	if err := c.retryable(ctx, in.Body, start); err != nil {
+		return nil, err
+	}
+	return c.S3API.PutObjectWithContext(ctx, in, opts...)
+}
+
+// PutObjectRequest is used by the uploader for uploads fitting in a single part. The request is retried once the
+// bucket is created.
+func (c *bucketCreator) PutObjectRequest(in *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput) {
+	req, out := c.S3API.PutObjectRequest(in)
+	start, err := bodyStart(in.Body)
+	if err != nil {
+		req.Error = err
+		return req, out
+	}
+
+	retried := false
+	req.Handlers.AfterRetry.PushBack(func(r *request.Request) {
+		if retried || !isNoSuchBucket(r.Error) {
+			return
+		}
+		retried = true
+		if err := c.retryable(r.Context(), in.Body, start); err != nil {
+			r.Error = err
+			return
+		}
+		r.Error = nil
+		r.Retryable = aws.Bool(true)
+	})
+	return req, out
+}
+
+func (c *bucketCreator) CreateMultipartUploadWithContext(
+	ctx aws.Context, in *s3.CreateMultipartUploadInput, opts ...request.Option,
+) (*s3.CreateMultipartUploadOutput, error) {
+	out, err := c.S3API.CreateMultipartUploadWithContext(ctx, in, opts...)
+	if !isNoSuchBucket(err) {
+		return out, err
+	}
+	if err := c.fs.createBucket(ctx); err != nil {
+		return nil, err
+	}
+	return c.S3API.CreateMultipartUploadWithContext(ctx, in, opts...)
+}
+
+// retryable creates the bucket, and rewinds the body of the write to retry
+func (c *bucketCreator) retryable(ctx aws.Context, body io.ReadSeeker, start int64) error {
+	if err := c.fs.createBucket(ctx); err != nil {
+		return err
+	}
+	if body != nil {
+		_, err := body.Seek(start, io.SeekStart)
+		return err
+	}
+	return nil
+}
+
+// bodyStart returns the position the body of a write starts at
+func bodyStart(body io.ReadSeeker) (int64, error) {
+	if body == nil {
+		return 0, nil
+	}
+	return body.Seek(0, io.SeekCurrent)
+}
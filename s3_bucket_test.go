@@ -0,0 +1,152 @@
+package s3
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+// missingBucket makes all the requests fail with NoSuchBucket until the bucket is created, like S3 does
+func missingBucket(mock *mockS3) {
+	created := false
+	mock.hook = func(op string, _ interface{}) error {
+		if op == "CreateBucket" {
+			created = true
+		} else if !created {
+			return mockNotFound(s3.ErrCodeNoSuchBucket)
+		}
+		return nil
+	}
+}
+
+func TestAutoCreateBucket(t *testing.T) {
+	req := require.New(t)
+
+	t.Run("Disabled", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		missingBucket(mock)
+		_, err := fs.Create("/file")
+		req.Error(err)
+		req.Zero(mock.count("CreateBucket"))
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithAutoCreateBucket())
+		missingBucket(mock)
+		file, err := fs.Create("/file")
+		req.NoError(err)
+		req.NoError(file.Close())
+		req.Equal(1, mock.count("CreateBucket"))
+		req.NotNil(mock.getObject("bucket", "file"))
+	})
+
+	t.Run("Write", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithAutoCreateBucket())
+		missingBucket(mock)
+		file, err := fs.OpenFile("/file", os.O_WRONLY, 0o644)
+		req.NoError(err)
+		_, err = file.Write([]byte("content"))
+		req.NoError(err)
+		req.NoError(file.Close())
+		req.Equal(1, mock.count("CreateBucket"))
+		req.Equal([]byte("content"), mock.getObject("bucket", "file").body)
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithAutoCreateBucket())
+		missingBucket(mock)
+		content := bytes.Repeat([]byte("a"), partSize+1024)
+		req.NoError(fs.UploadReaderAt("/file", bytes.NewReader(content), int64(len(content))))
+		req.Equal(1, mock.count("CreateBucket"))
+		req.Equal(2, mock.count("CreateMultipartUpload"))
+		req.Equal(content, mock.getObject("bucket", "file").body)
+	})
+}
+
+func TestPing(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	req.NoError(fs.Ping())
+	req.Equal([]string{"HeadBucket"}, mock.calls)
+
+	// HeadBucket responses don't have a body, the error is only told by the status code
+	mock.hook = func(string, interface{}) error {
+		return mockNotFound("NotFound")
+	}
+	err := fs.Ping()
+	req.ErrorIs(err, ErrNoSuchBucket)
+	req.ErrorIs(err, os.ErrNotExist)
+	req.NotErrorIs(err, os.ErrPermission)
+
+	mock.hook = func(string, interface{}) error {
+		return awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), http.StatusForbidden, "mock")
+	}
+	err = fs.Ping()
+	req.ErrorIs(err, os.ErrPermission)
+	req.NotErrorIs(err, ErrNoSuchBucket)
+}
+
+func TestBucketCheck(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithBucketCheck())
+
+	exists := false
+	mock.hook = func(op string, _ interface{}) error {
+		if op == "HeadBucket" && !exists {
+			return mockNotFound("NotFound")
+		}
+		return nil
+	}
+
+	_, err := fs.Create("/file")
+	req.ErrorIs(err, ErrNoSuchBucket)
+	req.EqualError(err, "open /file: bucket doesn't exist: file does not exist: bucket")
+	_, err = fs.OpenFile("/file", os.O_WRONLY, 0)
+	req.ErrorIs(err, ErrNoSuchBucket)
+	_, err = fs.PutBytes("/file", []byte("content"))
+	req.ErrorIs(err, ErrNoSuchBucket)
+	err = fs.UploadReaderAt("/file", bytes.NewReader([]byte("content")), 7)
+	req.ErrorIs(err, ErrNoSuchBucket)
+	req.ErrorIs(err, os.ErrNotExist)
+
+	// Nothing was uploaded
+	req.Equal(4, mock.count("HeadBucket"))
+	req.Zero(mock.count("PutObject"))
+	req.Zero(mock.count("CreateMultipartUpload"))
+
+	// Once the bucket exists, it isn't checked anymore
+	exists = true
+	mock.resetCalls()
+	testCreateFile(t, fs, "/file", "content")
+	_, err = fs.PutBytes("/other", []byte("content"))
+	req.NoError(err)
+	req.Equal(1, mock.count("HeadBucket"))
+
+	t.Run("Forbidden", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithBucketCheck())
+		mock.hook = func(op string, _ interface{}) error {
+			if op == "HeadBucket" {
+				return awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), http.StatusForbidden, "mock")
+			}
+			return nil
+		}
+
+		// The writes aren't prevented when the bucket can't be looked up
+		testCreateFile(t, fs, "/file", "content")
+		_, err := fs.PutBytes("/other", []byte("content"))
+		req.NoError(err)
+		req.Equal(1, mock.count("HeadBucket"))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		testCreateFile(t, fs, "/file", "content")
+		req.Zero(mock.count("HeadBucket"))
+	})
+}
@@ -0,0 +1,368 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/spf13/afero"
+)
+
+// maxCopyObjectSize is the biggest object a single CopyObject can copy, bigger ones require a multipart copy
+var maxCopyObjectSize int64 = 5 * 1024 * 1024 * 1024
+
+// copyPartSize is the size of the parts of a multipart copy
+var copyPartSize int64 = 1024 * 1024 * 1024
+
+// SyncTo copies all the files under a prefix to an other Fs, keeping their names. Copies are performed server-side,
+// and as such both Fs have to be in the same region. Files failing to be copied are reported in a *BatchError.
+func (fs *Fs) SyncTo(dst *Fs, prefix string) error {
+	failed := &BatchError{}
+	err := fs.walkObjects(fs.sanitize(prefix), func(obj *s3.Object) error {
+		name := fs.keyName(*obj.Key)
+		if errCopy := copyObject(fs, fs.key(name), dst, dst.key(name), *obj.Size, obj.StorageClass); errCopy != nil {
+			failed.add(name, errCopy)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return failed.errOrNil()
+}
+
+// MoveTo moves a file to an other Fs, like from a staging bucket to a production one, by copying it server-side and
+// then deleting the original. Like with SyncTo, both Fs have to be in the same region. The copy keeps the properties,
+// the tags and the storage class of the file.
+func (fs *Fs) MoveTo(dst *Fs, srcName, dstName string) error {
+	srcName = fs.sanitize(srcName)
+	dstName = dst.sanitize(dstName)
+	if isRoot(srcName) || isRoot(dstName) {
+		return &os.LinkError{Op: "move", Old: srcName, New: dstName, Err: os.ErrInvalid}
+	}
+	if fs.Bucket == dst.Bucket && fs.key(srcName) == dst.key(dstName) {
+		return nil
+	}
+
+	head, err := fs.headObject(srcName)
+	if isNotFound(err) {
+		return &os.LinkError{Op: "move", Old: srcName, New: dstName, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return &os.LinkError{Op: "move", Old: srcName, New: dstName, Err: permissionError(err)}
+	}
+
+	fs.invalidate(srcName)
+	dst.invalidate(dstName)
+	err = copyObject(fs, fs.key(srcName), dst, dst.key(dstName), aws.Int64Value(head.ContentLength), head.StorageClass)
+	if err != nil {
+		return &os.LinkError{Op: "move", Old: srcName, New: dstName, Err: permissionError(err)}
+	}
+	if err := dst.ensureDirMarker(path.Dir(dstName)); err != nil {
+		return &os.LinkError{Op: "move", Old: srcName, New: dstName, Err: permissionError(err)}
+	}
+
+	_, err = fs.S3API.DeleteObjectWithContext(aws.BackgroundContext(), &s3.DeleteObjectInput{
+		Bucket:                    aws.String(fs.Bucket),
+		BypassGovernanceRetention: fs.bypassGovernanceRetention(),
+		ExpectedBucketOwner:       fs.ExpectedBucketOwner,
+		Key:                       aws.String(fs.key(srcName)),
+	}, fs.requestOptions()...)
+	if err != nil {
+		return &os.LinkError{Op: "move", Old: srcName, New: dstName, Err: permissionError(err)}
+	}
+	return nil
+}
+
+// NeedsUpload tells if a local file differs from the remote one, given the hex MD5 and the size of the local file.
+// Multipart uploads don't have the MD5 of their content as ETag, they're considered different.
+func (fs *Fs) NeedsUpload(name string, localMD5 string, localSize int64) (bool, error) {
+	if name = fs.sanitize(name); isRoot(name) {
+		return false, rootError("stat", name)
+	}
+
+	head, err := fs.S3API.HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+	}, fs.requestOptions()...)
+	if err != nil {
+		var errRequestFailure awserr.RequestFailure
+		if errors.As(err, &errRequestFailure) && errRequestFailure.StatusCode() == 404 {
+			return true, nil
+		}
+		return false, permissionError(err)
+	}
+
+	if aws.Int64Value(head.ContentLength) != localSize {
+		return true, nil
+	}
+
+	etag := strings.Trim(aws.StringValue(head.ETag), "\"")
+	if strings.Contains(etag, "-") {
+		return true, nil
+	}
+
+	return !strings.EqualFold(etag, localMD5), nil
+}
+
+// Touch sets the modification time of a file to now, or creates it empty if it doesn't exist. Existing files are
+// copied onto themselves, which keeps their content, properties, metadata and tags, but resets their ACL.
+func (fs *Fs) Touch(name string) error {
+	name = fs.sanitize(name)
+	if isRoot(name) {
+		return rootError("touch", name)
+	}
+	fs.invalidate(name)
+
+	head, err := fs.headObject(name)
+	if isNotFound(err) {
+		_, err = fs.putObject(name, bytes.NewReader([]byte{}))
+		return permissionError(err)
+	}
+	if err != nil {
+		return permissionError(err)
+	}
+
+	_, err = fs.S3API.CopyObjectWithContext(aws.BackgroundContext(), fs.selfCopyInput(name, head),
+		fs.requestOptions()...)
+	return permissionError(err)
+}
+
+// UpdateMetadata replaces the properties of a file, like its Content-Type, without uploading its content again. The
+// properties that aren't set are kept, except the ACL which is reset like with any copy. The file is copied onto
+// itself, which is limited to the files of at most 5GB.
+func (fs *Fs) UpdateMetadata(name string, props *UploadedFileProperties) error {
+	name = fs.sanitize(name)
+	if isRoot(name) {
+		return rootError("update", name)
+	}
+	fs.invalidate(name)
+
+	head, err := fs.headObject(name)
+	if isNotFound(err) {
+		return &os.PathError{Op: "update", Path: name, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return permissionError(err)
+	}
+
+	input := fs.selfCopyInput(name, head)
+	applyFileCopyProps(input, props)
+	_, err = fs.S3API.CopyObjectWithContext(aws.BackgroundContext(), input, fs.requestOptions()...)
+	return permissionError(err)
+}
+
+// CreateFrom opens a file for writing, like OpenFile with os.O_WRONLY, giving it the Content-Type, the Cache-Control
+// and the user metadata of a template file. Setting the Content-Type of the file still overrides the template's.
+func (fs *Fs) CreateFrom(template, name string) (afero.File, error) {
+	template = fs.sanitize(template)
+	if isRoot(template) {
+		return nil, rootError("create", template)
+	}
+
+	head, err := fs.headObject(template)
+	if isNotFound(err) {
+		return nil, &os.PathError{Op: "create", Path: template, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "create", Path: template, Err: permissionError(err)}
+	}
+
+	file, err := fs.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	f := file.(*File)
+	f.contentType = head.ContentType
+	f.cacheControl = head.CacheControl
+	f.userMetadata = aws.StringValueMap(head.Metadata)
+	return f, nil
+}
+
+// headObject fetches the properties of an object
+func (fs *Fs) headObject(name string) (*s3.HeadObjectOutput, error) {
+	return fs.S3API.HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+	}, fs.requestOptions()...)
+}
+
+// selfCopyInput prepares the copy of an object onto itself. S3 only allows it when replacing its properties, so they
+// are set again from the ones of the object.
+func (fs *Fs) selfCopyInput(name string, head *s3.HeadObjectOutput) *s3.CopyObjectInput {
+	return &s3.CopyObjectInput{
+		Bucket:                         aws.String(fs.Bucket),
+		ExpectedBucketOwner:            fs.ExpectedBucketOwner,
+		CopySource:                     aws.String(copySource(fs.Bucket, fs.key(name))),
+		ExpectedSourceBucketOwner:      fs.ExpectedBucketOwner,
+		Key:                            aws.String(fs.key(name)),
+		SSECustomerAlgorithm:           fs.sseCustomerAlgorithm(),
+		SSECustomerKey:                 fs.sseCustomerKey(),
+		CopySourceSSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		CopySourceSSECustomerKey:       fs.sseCustomerKey(),
+		MetadataDirective:              aws.String(s3.MetadataDirectiveReplace),
+		CacheControl:                   head.CacheControl,
+		ContentDisposition:             head.ContentDisposition,
+		ContentEncoding:                head.ContentEncoding,
+		ContentLanguage:                head.ContentLanguage,
+		ContentType:                    head.ContentType,
+		Metadata:                       head.Metadata,
+		StorageClass:                   head.StorageClass,
+	}
+}
+
+// copyObject copies an object server-side, with a multipart copy if it's too big for a single CopyObject. The copy
+// keeps the tags and the storage class of the object, which would otherwise be STANDARD.
+func copyObject(src *Fs, srcKey string, dst *Fs, dstKey string, size int64, storageClass *string) error {
+	if size > maxCopyObjectSize {
+		return copyObjectMultipart(src, srcKey, dst, dstKey, size, storageClass)
+	}
+
+	_, err := dst.S3API.CopyObjectWithContext(aws.BackgroundContext(), &s3.CopyObjectInput{
+		Bucket:                         aws.String(dst.Bucket),
+		ExpectedBucketOwner:            dst.ExpectedBucketOwner,
+		CopySource:                     aws.String(copySource(src.Bucket, srcKey)),
+		ExpectedSourceBucketOwner:      src.ExpectedBucketOwner,
+		Key:                            aws.String(dstKey),
+		SSECustomerAlgorithm:           dst.sseCustomerAlgorithm(),
+		SSECustomerKey:                 dst.sseCustomerKey(),
+		CopySourceSSECustomerAlgorithm: src.sseCustomerAlgorithm(),
+		CopySourceSSECustomerKey:       src.sseCustomerKey(),
+		StorageClass:                   storageClass,
+		TaggingDirective:               aws.String(s3.TaggingDirectiveCopy),
+	}, dst.requestOptions()...)
+	return err
+}
+
+func copyObjectMultipart(src *Fs, srcKey string, dst *Fs, dstKey string, size int64, storageClass *string) error {
+	// Contrary to CopyObject, the properties of the object aren't copied
+	head, err := src.S3API.HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket:               aws.String(src.Bucket),
+		ExpectedBucketOwner:  src.ExpectedBucketOwner,
+		Key:                  aws.String(srcKey),
+		SSECustomerAlgorithm: src.sseCustomerAlgorithm(),
+		SSECustomerKey:       src.sseCustomerKey(),
+	}, src.requestOptions()...)
+	if err != nil {
+		return err
+	}
+
+	tagging, err := objectTagging(src, srcKey)
+	if err != nil {
+		return err
+	}
+
+	upload, err := dst.S3API.CreateMultipartUploadWithContext(aws.BackgroundContext(), &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(dst.Bucket),
+		ExpectedBucketOwner:  dst.ExpectedBucketOwner,
+		Key:                  aws.String(dstKey),
+		SSECustomerAlgorithm: dst.sseCustomerAlgorithm(),
+		SSECustomerKey:       dst.sseCustomerKey(),
+		CacheControl:         head.CacheControl,
+		ContentEncoding:      head.ContentEncoding,
+		ContentType:          head.ContentType,
+		Metadata:             head.Metadata,
+		StorageClass:         storageClass,
+		Tagging:              tagging,
+	}, dst.requestOptions()...)
+	if err != nil {
+		return err
+	}
+
+	parts, err := copyParts(src, srcKey, dst, dstKey, size, upload.UploadId)
+	if err != nil {
+		_, _ = dst.S3API.AbortMultipartUploadWithContext(aws.BackgroundContext(), &s3.AbortMultipartUploadInput{
+			Bucket:              aws.String(dst.Bucket),
+			ExpectedBucketOwner: dst.ExpectedBucketOwner,
+			Key:                 aws.String(dstKey),
+			UploadId:            upload.UploadId,
+		}, dst.requestOptions()...)
+		return err
+	}
+
+	_, err = dst.S3API.CompleteMultipartUploadWithContext(aws.BackgroundContext(), &s3.CompleteMultipartUploadInput{
+		Bucket:              aws.String(dst.Bucket),
+		ExpectedBucketOwner: dst.ExpectedBucketOwner,
+		Key:                 aws.String(dstKey),
+		UploadId:            upload.UploadId,
+		MultipartUpload:     &s3.CompletedMultipartUpload{Parts: parts},
+	}, dst.requestOptions()...)
+	return err
+}
+
+func copyParts(src *Fs, srcKey string, dst *Fs, dstKey string, size int64, uploadID *string) (
+	[]*s3.CompletedPart, error) {
+	parts := make([]*s3.CompletedPart, 0, size/copyPartSize+1)
+	for start := int64(0); start < size; start += copyPartSize {
+		end := start + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		partNumber := aws.Int64(int64(len(parts) + 1))
+		out, err := dst.S3API.UploadPartCopyWithContext(aws.BackgroundContext(), &s3.UploadPartCopyInput{
+			Bucket:                         aws.String(dst.Bucket),
+			ExpectedBucketOwner:            dst.ExpectedBucketOwner,
+			Key:                            aws.String(dstKey),
+			SSECustomerAlgorithm:           dst.sseCustomerAlgorithm(),
+			SSECustomerKey:                 dst.sseCustomerKey(),
+			CopySourceSSECustomerAlgorithm: src.sseCustomerAlgorithm(),
+			CopySourceSSECustomerKey:       src.sseCustomerKey(),
+			CopySource:                     aws.String(copySource(src.Bucket, srcKey)),
+			ExpectedSourceBucketOwner:      src.ExpectedBucketOwner,
+			CopySourceRange:                aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+			PartNumber:                     partNumber,
+			UploadId:                       uploadID,
+		}, dst.requestOptions()...)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: partNumber})
+	}
+	return parts, nil
+}
+
+// objectTagging returns the tags of an object, URL-encoded like the Tagging of uploads
+func objectTagging(fs *Fs, key string) (*string, error) {
+	out, err := fs.S3API.GetObjectTaggingWithContext(aws.BackgroundContext(), &s3.GetObjectTaggingInput{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+		Key:                 aws.String(key),
+	}, fs.requestOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	if len(out.TagSet) == 0 {
+		return nil, nil
+	}
+
+	tags := url.Values{}
+	for _, tag := range out.TagSet {
+		tags.Add(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+	}
+	return aws.String(tags.Encode()), nil
+}
+
+// copySource returns the CopySource of an object, which is made of its bucket and its URL-encoded key. S3 decodes
+// "+" as a space, it has to be encoded as well.
+func copySource(bucket, key string) string {
+	segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
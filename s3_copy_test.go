@@ -0,0 +1,322 @@
+package s3
+
+import (
+	"crypto/md5" //nolint: gosec
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncTo(t *testing.T) {
+	req := require.New(t)
+	src, mock := newMockFs(t)
+	dst := NewFsWithOptions("dst", nil, WithS3API(mock))
+
+	mock.putObject("bucket", "data/a", []byte("a"), time.Now())
+	mock.putObject("bucket", "data/sub/b", []byte("b"), time.Now())
+	mock.putObject("bucket", "data/huge", nil, time.Now()).fakeSize = 6 * 1024 * 1024 * 1024
+	mock.putObject("bucket", "other/c", []byte("c"), time.Now())
+
+	req.NoError(src.SyncTo(dst, "data/"))
+
+	req.Equal("a", string(mock.getObject("dst", "data/a").body))
+	req.Equal("b", string(mock.getObject("dst", "data/sub/b").body))
+	req.Equal(int64(6*1024*1024*1024), mock.getObject("dst", "data/huge").size())
+	req.Nil(mock.getObject("dst", "other/c"))
+
+	// Only the huge object went through a multipart copy
+	req.Equal(2, mock.count("CopyObject"))
+	req.Equal(1, mock.count("CreateMultipartUpload"))
+	req.Equal(6, mock.count("UploadPartCopy"))
+	lastPart := mock.lastInput("UploadPartCopy").(*s3.UploadPartCopyInput)
+	req.Equal("bytes=5368709120-6442450943", aws.StringValue(lastPart.CopySourceRange))
+	req.Equal(1, mock.count("CompleteMultipartUpload"))
+}
+
+func TestMoveTo(t *testing.T) {
+	req := require.New(t)
+	staging, mock := newMockFs(t)
+	prod := NewFsWithOptions("prod", nil, WithS3API(mock), WithPrefix("site/"))
+
+	obj := mock.putObject("bucket", "release/app v1.tar", []byte("app"), time.Now())
+	obj.contentType = aws.String("application/x-tar")
+
+	req.NoError(staging.MoveTo(prod, "/release/app v1.tar", "/releases/app.tar"))
+
+	moved := mock.getObject("prod", "site/releases/app.tar")
+	req.NotNil(moved)
+	req.Equal("app", string(moved.body))
+	req.Equal("application/x-tar", aws.StringValue(moved.contentType))
+	req.Nil(mock.getObject("bucket", "release/app v1.tar"))
+
+	copied := mock.lastInput("CopyObject").(*s3.CopyObjectInput)
+	req.Equal("prod", aws.StringValue(copied.Bucket))
+	req.Equal("bucket/release/app%20v1.tar", aws.StringValue(copied.CopySource))
+	req.Equal("bucket", aws.StringValue(mock.lastInput("DeleteObject").(*s3.DeleteObjectInput).Bucket))
+
+	// The destination directory is marked
+	req.NotNil(mock.getObject("prod", "site/releases/"))
+
+	err := staging.MoveTo(prod, "/missing", "/releases/missing")
+	req.ErrorIs(err, os.ErrNotExist)
+	req.Nil(mock.getObject("prod", "site/releases/missing"))
+
+	t.Run("DeleteFailure", func(t *testing.T) {
+		mock.putObject("bucket", "release/locked", []byte("locked"), time.Now())
+		mock.hook = func(op string, _ interface{}) error {
+			if op == "DeleteObject" {
+				return awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "mock")
+			}
+			return nil
+		}
+		defer func() { mock.hook = nil }()
+
+		err := staging.MoveTo(prod, "/release/locked", "/releases/locked")
+		var linkErr *os.LinkError
+		req.True(errors.As(err, &linkErr))
+		req.Equal("move", linkErr.Op)
+		req.ErrorIs(err, os.ErrPermission)
+		req.NotNil(mock.getObject("bucket", "release/locked"))
+	})
+}
+
+func TestSyncToErrors(t *testing.T) {
+	req := require.New(t)
+	src, mock := newMockFs(t)
+	dst := NewFsWithOptions("dst", nil, WithS3API(mock))
+
+	mock.putObject("bucket", "ok", []byte("ok"), time.Now())
+	// Raising the threshold makes the 6GB object go through a single CopyObject, which fails
+	mock.putObject("bucket", "ko", nil, time.Now()).fakeSize = 6 * 1024 * 1024 * 1024
+	maxCopyObjectSize = 10 * 1024 * 1024 * 1024
+	defer func() { maxCopyObjectSize = 5 * 1024 * 1024 * 1024 }()
+
+	err := src.SyncTo(dst, "")
+	var batchErr *BatchError
+	req.True(errors.As(err, &batchErr))
+	req.Len(batchErr.Errors, 1)
+	req.Error(batchErr.Errors["ko"])
+	req.NotNil(mock.getObject("dst", "ok"))
+}
+
+func TestRenameMultipartCopy(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "huge", nil, time.Now()).fakeSize = 6 * 1024 * 1024 * 1024
+
+	req.NoError(fs.Rename("huge", "renamed"))
+
+	req.Nil(mock.getObject("bucket", "huge"))
+	req.Equal(int64(6*1024*1024*1024), mock.getObject("bucket", "renamed").size())
+	req.Zero(mock.count("CopyObject"))
+	req.Equal(1, mock.count("CreateMultipartUpload"))
+	req.Equal(6, mock.count("UploadPartCopy"))
+	req.Equal(1, mock.count("CompleteMultipartUpload"))
+}
+
+func TestRenameKeepsStorageClassAndTags(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	archived := mock.putObject("bucket", "archived", []byte("content"), time.Now())
+	archived.storageClass = aws.String(s3.StorageClassGlacier)
+	archived.tagging = aws.String("project=afero&team=storage")
+	huge := mock.putObject("bucket", "huge", nil, time.Now())
+	huge.fakeSize = 6 * 1024 * 1024 * 1024
+	huge.storageClass = aws.String(s3.StorageClassGlacier)
+	huge.tagging = aws.String("project=afero")
+	mock.putObject("bucket", "standard", []byte("content"), time.Now())
+
+	req.NoError(fs.Rename("/archived", "/renamed/archived"))
+	req.NoError(fs.Rename("/huge", "/renamed/huge"))
+	req.NoError(fs.Rename("/standard", "/renamed/standard"))
+
+	renamed := mock.getObject("bucket", "renamed/archived")
+	req.Equal(s3.StorageClassGlacier, aws.StringValue(renamed.storageClass))
+	req.Equal("project=afero&team=storage", aws.StringValue(renamed.tagging))
+	req.Equal(s3.TaggingDirectiveCopy, aws.StringValue(mock.lastInput("CopyObject").(*s3.CopyObjectInput).TaggingDirective))
+
+	renamed = mock.getObject("bucket", "renamed/huge")
+	req.Equal(s3.StorageClassGlacier, aws.StringValue(renamed.storageClass))
+	req.Equal("project=afero", aws.StringValue(renamed.tagging))
+
+	req.Nil(mock.getObject("bucket", "renamed/standard").storageClass)
+}
+
+func TestCopySourceEscaping(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	for src, escaped := range map[string]string{
+		"dir/with space.txt": "bucket/dir/with%20space.txt",
+		"dir/a+b.txt":        "bucket/dir/a%2Bb.txt",
+		"dir/été/日本.txt":     "bucket/dir/%C3%A9t%C3%A9/%E6%97%A5%E6%9C%AC.txt",
+		"dir/100%?#.txt":     "bucket/dir/100%25%3F%23.txt",
+	} {
+		mock.putObject("bucket", src, []byte(src), time.Now())
+		req.NoError(fs.Copy("/"+src, "/copy/"+src))
+		req.Equal(escaped, aws.StringValue(mock.lastInput("CopyObject").(*s3.CopyObjectInput).CopySource))
+		req.Equal(src, string(mock.getObject("bucket", "copy/"+src).body))
+	}
+
+	req.NoError(fs.Rename("/dir/a+b.txt", "/dir/a b.txt"))
+	req.Equal("dir/a+b.txt", string(mock.getObject("bucket", "dir/a b.txt").body))
+	req.Nil(mock.getObject("bucket", "dir/a+b.txt"))
+}
+
+func TestTouch(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	req.NoError(fs.Touch("/dir/new"))
+	req.NotNil(mock.getObject("bucket", "dir/new"))
+	req.Empty(mock.getObject("bucket", "dir/new").body)
+
+	lastModified := time.Now().Add(-time.Hour).UTC()
+	obj := mock.putObject("bucket", "dir/existing", []byte("content"), lastModified)
+	obj.contentType = aws.String("text/plain")
+	obj.metadata = map[string]*string{"Author": aws.String("me")}
+	obj.tagging = aws.String("project=afero")
+
+	req.NoError(fs.Touch("/dir/existing"))
+	touched := mock.getObject("bucket", "dir/existing")
+	req.True(touched.lastModified.After(lastModified))
+	req.Equal("content", string(touched.body))
+	req.Equal("text/plain", aws.StringValue(touched.contentType))
+	req.Equal("me", aws.StringValue(touched.metadata["Author"]))
+	req.Equal("project=afero", aws.StringValue(touched.tagging))
+
+	info, err := fs.Stat("/dir/existing")
+	req.NoError(err)
+	req.WithinDuration(time.Now(), info.ModTime(), time.Minute)
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	obj := mock.putObject("bucket", "report.dat", []byte("content"), time.Now())
+	obj.contentType = aws.String("application/octet-stream")
+	obj.cacheControl = aws.String("no-cache")
+	obj.metadata = map[string]*string{"Author": aws.String("me")}
+	obj.tagging = aws.String("project=afero")
+	mock.resetCalls()
+
+	req.NoError(fs.UpdateMetadata("/report.dat", &UploadedFileProperties{
+		ContentType: aws.String("text/csv"),
+		Tagging:     aws.String("project=reports"),
+	}))
+	req.Equal(1, mock.count("CopyObject"))
+	req.Zero(mock.count("PutObject"))
+
+	updated := mock.getObject("bucket", "report.dat")
+	req.Equal("content", string(updated.body))
+	req.Equal("text/csv", aws.StringValue(updated.contentType))
+	req.Equal("project=reports", aws.StringValue(updated.tagging))
+	// The properties that aren't set are kept
+	req.Equal("no-cache", aws.StringValue(updated.cacheControl))
+	req.Equal("me", aws.StringValue(updated.metadata["Author"]))
+
+	err := fs.UpdateMetadata("/missing", &UploadedFileProperties{ContentType: aws.String("text/csv")})
+	req.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestCreateFrom(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	obj := mock.putObject("bucket", "templates/invoice.dat", []byte("template"), time.Now())
+	obj.contentType = aws.String("application/x-invoice")
+	obj.cacheControl = aws.String("no-cache")
+	obj.metadata = map[string]*string{"Author": aws.String("me"), "Version": aws.String("2")}
+
+	file, err := fs.CreateFrom("/templates/invoice.dat", "/invoices/1.txt")
+	req.NoError(err)
+	_, err = file.WriteString("invoice")
+	req.NoError(err)
+	req.NoError(file.Close())
+
+	created := mock.getObject("bucket", "invoices/1.txt")
+	req.Equal("invoice", string(created.body))
+	req.Equal("application/x-invoice", aws.StringValue(created.contentType))
+	req.Equal("no-cache", aws.StringValue(created.cacheControl))
+	req.Equal(map[string]string{"Author": "me", "Version": "2"}, aws.StringValueMap(created.metadata))
+
+	// The template is left as is
+	req.Equal("template", string(mock.getObject("bucket", "templates/invoice.dat").body))
+
+	_, err = fs.CreateFrom("/templates/missing.dat", "/invoices/2.txt")
+	req.ErrorIs(err, os.ErrNotExist)
+	req.Nil(mock.getObject("bucket", "invoices/2.txt"))
+}
+
+func TestCopy(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "dir/src", []byte("content"), time.Now())
+	mock.putObject("bucket", "huge", nil, time.Now()).fakeSize = 6 * 1024 * 1024 * 1024
+
+	req.NoError(fs.Copy("/dir/src", "/dir/dst"))
+	req.Equal("content", string(mock.getObject("bucket", "dir/src").body))
+	req.Equal("content", string(mock.getObject("bucket", "dir/dst").body))
+	req.Equal(1, mock.count("CopyObject"))
+
+	req.NoError(fs.Copy("huge", "huge-copy"))
+	req.NotNil(mock.getObject("bucket", "huge"))
+	req.Equal(int64(6*1024*1024*1024), mock.getObject("bucket", "huge-copy").size())
+	req.Equal(1, mock.count("CopyObject"))
+	req.Equal(6, mock.count("UploadPartCopy"))
+}
+
+func TestNeedsUpload(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	content := []byte("hello world")
+	sum := md5.Sum(content) //nolint: gosec
+	localMD5 := hex.EncodeToString(sum[:])
+	mock.putObject("bucket", "file", content, time.Now())
+
+	t.Run("Matching", func(t *testing.T) {
+		needed, err := fs.NeedsUpload("/file", localMD5, int64(len(content)))
+		req.NoError(err)
+		req.False(needed)
+
+		needed, err = fs.NeedsUpload("/file", strings.ToUpper(localMD5), int64(len(content)))
+		req.NoError(err)
+		req.False(needed)
+	})
+
+	t.Run("DifferentContent", func(t *testing.T) {
+		needed, err := fs.NeedsUpload("/file", "d41d8cd98f00b204e9800998ecf8427e", int64(len(content)))
+		req.NoError(err)
+		req.True(needed)
+	})
+
+	t.Run("DifferentSize", func(t *testing.T) {
+		needed, err := fs.NeedsUpload("/file", localMD5, int64(len(content))+1)
+		req.NoError(err)
+		req.True(needed)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		needed, err := fs.NeedsUpload("/missing", localMD5, int64(len(content)))
+		req.NoError(err)
+		req.True(needed)
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		mock.putObject("bucket", "multipart", content, time.Now()).etag = "\"" + localMD5 + "-2\""
+		needed, err := fs.NeedsUpload("/multipart", localMD5, int64(len(content)))
+		req.NoError(err)
+		req.True(needed)
+	})
+}
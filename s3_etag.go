@@ -0,0 +1,99 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"crypto/md5" //nolint: gosec
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// multipartETag returns the ETag S3 gives to an object uploaded in parts: the MD5 of the concatenated MD5s of the
+// parts, followed by the number of parts
+func multipartETag(partMD5s [][]byte) string {
+	h := md5.New() //nolint: gosec
+	for _, sum := range partMD5s {
+		h.Write(sum)
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(h.Sum(nil)), len(partMD5s))
+}
+
+// etagRecorder computes the MD5 of the parts uploaded by an uploader, so that the ETag of the completed upload can
+// be verified
+type etagRecorder struct {
+	s3iface.S3API
+	mu        sync.Mutex
+	md5s      map[int64][]byte // md5s are the MD5s of the uploaded parts, by part number
+	encrypted bool             // encrypted is set when the parts are encrypted with SSE-C or SSE-KMS
+}
+
+func newETagRecorder(api s3iface.S3API) *etagRecorder {
+	return &etagRecorder{S3API: api, md5s: make(map[int64][]byte)}
+}
+
+func (r *etagRecorder) UploadPartWithContext(
+	ctx aws.Context, in *s3.UploadPartInput, opts ...request.Option,
+) (*s3.UploadPartOutput, error) {
+	start, err := in.Body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	h := md5.New() //nolint: gosec
+	if _, err := io.Copy(h, in.Body); err != nil {
+		return nil, err
+	}
+	if _, err := in.Body.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	out, err := r.S3API.UploadPartWithContext(ctx, in, opts...)
+	if err == nil {
+		r.mu.Lock()
+		r.md5s[aws.Int64Value(in.PartNumber)] = h.Sum(nil)
+		// The encryption can be the default one of the bucket, it's only told by the responses
+		if in.SSECustomerKey != nil || out.SSECustomerAlgorithm != nil ||
+			strings.HasPrefix(aws.StringValue(out.ServerSideEncryption), s3.ServerSideEncryptionAwsKms) {
+			r.encrypted = true
+		}
+		r.mu.Unlock()
+	}
+	return out, err
+}
+
+// verify checks the ETag of a completed upload against the one expected from its parts. Uploads done with a single
+// request aren't checked, as their ETag is computed by S3 from the content it received, nor the encrypted ones, as
+// their ETag isn't derived from the MD5 of their content.
+func (r *etagRecorder) verify(out *s3manager.UploadOutput) error {
+	if out.UploadID == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.encrypted {
+		return nil
+	}
+	numbers := make([]int64, 0, len(r.md5s))
+	for number := range r.md5s {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	sums := make([][]byte, 0, len(numbers))
+	for _, number := range numbers {
+		sums = append(sums, r.md5s[number])
+	}
+
+	if expected, etag := multipartETag(sums), strings.Trim(aws.StringValue(out.ETag), "\""); etag != expected {
+		return fmt.Errorf("%w: multipart upload has ETag %s, expected %s", ErrChecksumMismatch, etag, expected)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5" //nolint: gosec
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+const partSize = 5 * 1024 * 1024
+
+func TestMultipartETag(t *testing.T) {
+	req := require.New(t)
+	first := md5.Sum(bytes.Repeat([]byte("a"), partSize)) //nolint: gosec
+	second := md5.Sum(bytes.Repeat([]byte("b"), 1024))    //nolint: gosec
+	req.Equal("16329fb6004d64a4fbc5bbb983fa0528-2", multipartETag([][]byte{first[:], second[:]}))
+}
+
+// corruptingS3 completes the multipart uploads with another ETag than the one of their parts
+type corruptingS3 struct {
+	*mockS3
+}
+
+func (m corruptingS3) CompleteMultipartUploadWithContext(
+	ctx aws.Context, in *s3.CompleteMultipartUploadInput, opts ...request.Option,
+) (*s3.CompleteMultipartUploadOutput, error) {
+	out, err := m.mockS3.CompleteMultipartUploadWithContext(ctx, in, opts...)
+	if err == nil {
+		out.ETag = aws.String("\"00000000000000000000000000000000-2\"")
+	}
+	return out, err
+}
+
+// kmsS3 encrypts the parts of the multipart uploads with SSE-KMS, like the buckets encrypting by default do
+type kmsS3 struct {
+	corruptingS3
+}
+
+func (m kmsS3) UploadPartWithContext(
+	ctx aws.Context, in *s3.UploadPartInput, opts ...request.Option,
+) (*s3.UploadPartOutput, error) {
+	out, err := m.mockS3.UploadPartWithContext(ctx, in, opts...)
+	if err == nil {
+		out.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+	}
+	return out, err
+}
+
+func TestMultipartETagVerification(t *testing.T) {
+	req := require.New(t)
+	content := append(bytes.Repeat([]byte("a"), partSize), bytes.Repeat([]byte("b"), 1024)...)
+
+	t.Run("Matching", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithMultipartETagVerification())
+		req.NoError(fs.UploadReaderAt("/file", bytes.NewReader(content), int64(len(content))))
+		req.Equal(2, mock.count("UploadPart"))
+		req.Equal("\"16329fb6004d64a4fbc5bbb983fa0528-2\"", mock.getObject("bucket", "file").etag)
+	})
+
+	t.Run("Written", func(t *testing.T) {
+		fs, _ := newMockFs(t, WithMultipartETagVerification())
+		file, err := fs.Create("/file")
+		req.NoError(err)
+		_, err = file.Write(content)
+		req.NoError(err)
+		req.NoError(file.Close())
+	})
+
+	t.Run("Mismatching", func(t *testing.T) {
+		mock := corruptingS3{newMockS3()}
+		fs := NewFsWithOptions("bucket", nil, WithS3API(mock), WithMultipartETagVerification())
+		err := fs.UploadReaderAt("/file", bytes.NewReader(content), int64(len(content)))
+		req.ErrorIs(err, ErrChecksumMismatch)
+		// The object is left in place
+		req.NotNil(mock.getObject("bucket", "file"))
+	})
+
+	t.Run("SSE-C", func(t *testing.T) {
+		mock := corruptingS3{newMockS3()}
+		key := bytes.Repeat([]byte("k"), 32)
+		fs := NewFsWithOptions("bucket", nil, WithS3API(mock), WithSSECustomerKey(key), WithMultipartETagVerification())
+		req.NoError(fs.UploadReaderAt("/file", bytes.NewReader(content), int64(len(content))))
+		req.Equal(content, mock.getObject("bucket", "file").body)
+	})
+
+	t.Run("SSE-KMS", func(t *testing.T) {
+		fs := NewFsWithOptions("bucket", nil, WithS3API(kmsS3{corruptingS3{newMockS3()}}), WithMultipartETagVerification())
+		req.NoError(fs.UploadReaderAt("/file", bytes.NewReader(content), int64(len(content))))
+	})
+
+	t.Run("SinglePart", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithMultipartETagVerification())
+		req.NoError(fs.UploadReaderAt("/file", bytes.NewReader([]byte("small")), 5))
+		req.Zero(mock.count("UploadPart"))
+	})
+}
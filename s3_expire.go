@@ -0,0 +1,65 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// expiresAtMetadata is the user metadata, sent as "x-amz-meta-expires-at", holding the RFC 3339 time after which
+// SweepExpired removes a file
+const expiresAtMetadata = "Expires-At"
+
+// SweepExpired removes the files inside a directory whose expiry is past, and returns the number of removed files. The
+// expiry of a file is the time set with File.SetExpiresAt, or its Expires header otherwise. The files without expiry
+// are kept. As the expiry isn't listed, each file is looked up with a HeadObject. The files that couldn't be removed
+// are reported in a *BatchError. Like with RemoveAll, the files of the whole bucket are only swept if the prefix is
+// "/", and with soft deletion the files are moved to the trash, which is only swept when the prefix is in it.
+func (fs *Fs) SweepExpired(prefix string) (int, error) {
+	if prefix = fs.sanitize(prefix); isRoot(prefix) && prefix != "/" {
+		return 0, rootError("sweep", prefix)
+	}
+
+	now := fs.now()
+	var names []string
+	err := fs.walkObjects(fs.dirPrefix(prefix), func(obj *s3.Object) error {
+		name := fs.keyName(*obj.Key)
+		if fs.keptInTrash(prefix, name) {
+			return nil
+		}
+		head, err := fs.headObject(name)
+		if isNotFound(err) {
+			return nil
+		} else if err != nil {
+			return permissionError(err)
+		}
+		if expiresAt, ok := objectExpiry(head); ok && !now.Before(expiresAt) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return fs.removeMany(names)
+}
+
+// objectExpiry returns the expiry of an object, from its metadata or its Expires header
+func objectExpiry(head *s3.HeadObjectOutput) (time.Time, bool) {
+	for key, value := range head.Metadata {
+		if strings.EqualFold(key, expiresAtMetadata) {
+			if expiresAt, err := time.Parse(time.RFC3339, aws.StringValue(value)); err == nil {
+				return expiresAt, true
+			}
+		}
+	}
+	if expires, err := http.ParseTime(aws.StringValue(head.Expires)); err == nil {
+		return expires, true
+	}
+	return time.Time{}, false
+}
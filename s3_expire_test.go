@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweepExpired(t *testing.T) {
+	req := require.New(t)
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	fs, mock := newMockFs(t, WithClock(func() time.Time { return now }))
+
+	write := func(name string, expiresAt time.Time) {
+		file, err := fs.Create(name)
+		req.NoError(err)
+		file.(*File).SetExpiresAt(expiresAt)
+		_, err = file.WriteString("content")
+		req.NoError(err)
+		req.NoError(file.Close())
+	}
+	write("/tmp/expired", now.Add(-time.Minute))
+	write("/tmp/expiring", now)
+	write("/tmp/valid", now.Add(time.Minute))
+	mock.putObject("bucket", "tmp/permanent", []byte("content"), now)
+	mock.putObject("bucket", "tmp/expires", []byte("content"), now).expires = aws.String(
+		now.Add(-time.Hour).Format(http.TimeFormat),
+	)
+	mock.putObject("bucket", "other/expired", []byte("content"), now).metadata = map[string]*string{
+		"Expires-At": aws.String(now.Add(-time.Hour).Format(time.RFC3339)),
+	}
+	mock.putObject("bucket", "tmp2/expired", []byte("content"), now).metadata = map[string]*string{
+		"Expires-At": aws.String(now.Add(-time.Hour).Format(time.RFC3339)),
+	}
+	req.Equal(
+		now.Add(-time.Minute).Format(time.RFC3339),
+		aws.StringValue(mock.getObject("bucket", "tmp/expired").metadata["Expires-At"]),
+	)
+
+	removed, err := fs.SweepExpired("/tmp")
+	req.NoError(err)
+	req.Equal(3, removed)
+
+	for name, exists := range map[string]bool{
+		"/tmp/expired":   false,
+		"/tmp/expiring":  false,
+		"/tmp/expires":   false,
+		"/tmp/valid":     true,
+		"/tmp/permanent": true,
+		"/other/expired": true,
+		"/tmp2/expired":  true,
+	} {
+		_, err := fs.Stat(name)
+		if exists {
+			req.NoError(err, name)
+		} else {
+			req.ErrorIs(err, os.ErrNotExist, name)
+		}
+	}
+}
@@ -2,6 +2,7 @@
 package s3
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -9,29 +10,54 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/spf13/afero"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 // File represents a file in S3.
 // nolint: govet
 type File struct {
-	fs                       *Fs            // Parent file system
-	name                     string         // Name of the file
-	cachedInfo               os.FileInfo    // File info cached for later used
-	streamRead               io.ReadCloser  // streamRead is the underlying stream we are reading from
-	streamReadOffset         int64          // streamReadOffset is the offset of the read-only stream
-	streamWrite              io.WriteCloser // streamWrite is the underlying stream we are reading to
-	streamWriteErr           error          // streamWriteErr is the error that should be returned in case of a write
-	streamWriteCloseErr      chan error     // streamWriteCloseErr is the channel containing the underlying write error
-	readdirContinuationToken *string        // readdirContinuationToken is used to perform files listing across calls
-	readdirNotTruncated      bool           // readdirNotTruncated is set when we shall continue reading
+	fs                       *Fs               // Parent file system
+	name                     string            // Name of the file
+	cachedInfo               os.FileInfo       // File info cached for later used
+	streamRead               io.ReadCloser     // streamRead is the underlying stream we are reading from
+	streamReadOffset         int64             // streamReadOffset is the offset of the read-only stream
+	streamReadOpened         bool              // streamReadOpened is set when opened for reading, reads open the stream
+	streamReadDecoded        bool              // streamReadDecoded is set when the stream is decoded, of unknown size
+	streamWrite              io.WriteCloser    // streamWrite is the underlying stream we are reading to
+	streamWriteErr           error             // streamWriteErr is the error that should be returned in case of a write
+	streamWriteAborted       error             // streamWriteAborted is the error the write stream was aborted with
+	streamWriteCloseErr      chan error        // streamWriteCloseErr is the channel containing the underlying write error
+	streamWriteSize          int64             // streamWriteSize is the number of bytes written to the write stream
+	streamWriteParts         *partsTracker     // streamWriteParts tracks the parts uploaded from the write stream
+	readdirContinuationToken *string           // readdirContinuationToken is used to perform files listing across calls
+	readdirNotTruncated      bool              // readdirNotTruncated is set when we shall continue reading
+	readOptions              readOptions       // readOptions are applied to the read requests of this file
+	readBlock                []byte            // readBlock is the last block fetched by ReadAt with read-ahead
+	readBlockOffset          int64             // readBlockOffset is the offset of readBlock in the file
+	contentType              *string           // contentType overrides the Content-Type of the file being written
+	cacheControl             *string           // cacheControl overrides the Cache-Control of the file being written
+	expiresAt                *time.Time        // expiresAt is when SweepExpired removes the file being written
+	acl                      *string           // acl is the canned ACL derived from the permissions of a created file
+	writeCacheBuf            *bytes.Buffer     // writeCacheBuf keeps the content written for the write cache
+	readCache                []byte            // readCache is the content of the file when served by the write cache
+	metadata                 map[string]string // metadata is the user metadata returned with the content
+	userMetadata             map[string]string // userMetadata is the user metadata of the file being written
+	isDir                    bool              // isDir is set when a directory was opened
+	keepUnwritten            bool              // keepUnwritten keeps the existing file when closed without any write
+	rangeEnd                 int64             // rangeEnd is the end of the content fetched by the reads, when set
+	versionID                string            // versionID is the version of the object returned with the content
 	// I think readdirNotTruncated can be dropped. The continuation token is probably enough.
 }
 
@@ -43,8 +69,14 @@ func NewFile(fs *Fs, name string) *File {
 	}
 }
 
-// Name returns the filename, i.e. S3 path without the bucket name.
-func (f *File) Name() string { return f.name }
+// Name returns the filename, i.e. S3 path without the bucket name. Like with os.File, directories are named without
+// trailing slash, even when opened with one, or through the "dir/" key of their marker.
+func (f *File) Name() string {
+	if len(f.name) > 1 {
+		return strings.TrimSuffix(f.name, "/")
+	}
+	return f.name
+}
 
 // Readdir reads the contents of the directory associated with file and
 // returns a slice of up to n FileInfo values, as would be returned
@@ -69,29 +101,48 @@ func (f *File) Readdir(n int) ([]os.FileInfo, error) {
 	}
 	// ListObjects treats leading slashes as part of the directory name
 	// It also needs a trailing slash to list contents of a directory.
-	name := strings.TrimPrefix(f.Name(), "/") // + "/"
+	name := strings.TrimPrefix(f.fs.key(f.Name()), "/") // + "/"
 
 	// For the root of the bucket, we need to remove any prefix
 	if name != "" && !strings.HasSuffix(name, "/") {
 		name += "/"
 	}
-	output, err := f.fs.S3API.ListObjectsV2(&s3.ListObjectsV2Input{
-		ContinuationToken: f.readdirContinuationToken,
-		Bucket:            aws.String(f.fs.Bucket),
-		Prefix:            aws.String(name),
-		Delimiter:         aws.String("/"),
-		MaxKeys:           aws.Int64(int64(n)),
-	})
-	if err != nil {
-		return nil, err
+	input := &s3.ListObjectsV2Input{
+		ContinuationToken:   f.readdirContinuationToken,
+		Bucket:              aws.String(f.fs.Bucket),
+		ExpectedBucketOwner: f.fs.ExpectedBucketOwner,
+		Prefix:              aws.String(name),
+		Delimiter:           aws.String("/"),
+		MaxKeys:             aws.Int64(int64(n)),
 	}
-	f.readdirContinuationToken = output.NextContinuationToken
-	if !(*output.IsTruncated) {
-		f.readdirNotTruncated = true
+	var fis []os.FileInfo
+	for {
+		output, err := f.fs.listObjects(input)
+		if err != nil {
+			return nil, err
+		}
+		f.readdirContinuationToken = output.NextContinuationToken
+		if !(*output.IsTruncated) {
+			f.readdirNotTruncated = true
+		}
+		fis = f.fs.listingInfos(output)
+
+		// A page only listing the marker of the directory is skipped, as an empty page would mean the end of it
+		if len(fis) > 0 || f.readdirNotTruncated {
+			break
+		}
+		input.ContinuationToken = output.NextContinuationToken
 	}
+	f.fs.statCache.addDir(f.Name(), fis)
+
+	return fis, nil
+}
+
+// listingInfos returns the FileInfo of the directories and the files of a listing with a delimiter, in this order
+func (fs *Fs) listingInfos(output *s3.ListObjectsV2Output) []os.FileInfo {
 	var fis = make([]os.FileInfo, 0, len(output.CommonPrefixes)+len(output.Contents))
 	for _, subfolder := range output.CommonPrefixes {
-		fis = append(fis, NewFileInfo(path.Base("/"+*subfolder.Prefix), true, 0, time.Unix(0, 0)))
+		fis = append(fis, fs.newFileInfo(fs.decodeKey(path.Base("/"+*subfolder.Prefix)), true, 0, fs.now()))
 	}
 	for _, fileObject := range output.Contents {
 		if strings.HasSuffix(*fileObject.Key, "/") {
@@ -99,17 +150,17 @@ func (f *File) Readdir(n int) ([]os.FileInfo, error) {
 			continue
 		}
 
-		fis = append(fis, NewFileInfo(path.Base("/"+*fileObject.Key), false, *fileObject.Size, *fileObject.LastModified))
+		name := fs.decodeKey(path.Base("/" + *fileObject.Key))
+		fis = append(fis, fs.newFileInfo(name, false, *fileObject.Size, *fileObject.LastModified))
 	}
-
-	return fis, nil
+	return fis
 }
 
 // ReaddirAll provides list of file cachedInfo.
 func (f *File) ReaddirAll() ([]os.FileInfo, error) {
 	var fileInfos []os.FileInfo
 	for {
-		infos, err := f.Readdir(100)
+		infos, err := f.Readdir(int(f.fs.listPageSize()))
 		fileInfos = append(fileInfos, infos...)
 		if err != nil {
 			if errors.Is(err, io.EOF) {
@@ -122,6 +173,32 @@ func (f *File) ReaddirAll() ([]os.FileInfo, error) {
 	return fileInfos, nil
 }
 
+// ErrStopReaddir can be returned by the function given to ReaddirFunc to stop the listing without error
+var ErrStopReaddir = errors.New("stop readdir")
+
+// ReaddirFunc calls fn for each entry of the directory, fetching them page by page instead of loading them all
+// into memory. If fn returns ErrStopReaddir, the listing stops and nil is returned, any other error stops the
+// listing and is returned.
+func (f *File) ReaddirFunc(fn func(os.FileInfo) error) error {
+	for {
+		infos, err := f.Readdir(int(f.fs.listPageSize()))
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		for _, info := range infos {
+			if err := fn(info); err != nil {
+				if errors.Is(err, ErrStopReaddir) {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+}
+
 // Readdirnames reads and returns a slice of names from the directory f.
 //
 // If n > 0, Readdirnames returns at most n names. In this case, if
@@ -149,7 +226,7 @@ func (f *File) Readdirnames(n int) ([]string, error) {
 // Stat returns the FileInfo structure describing file.
 // If there is an error, it will be of type *PathError.
 func (f *File) Stat() (os.FileInfo, error) {
-	info, err := f.fs.Stat(f.Name())
+	info, err := f.fs.stat(f.Name(), &f.readOptions)
 	if err == nil {
 		f.cachedInfo = info
 	}
@@ -169,16 +246,42 @@ func (f *File) Truncate(int64) error {
 }
 
 // WriteString is like Write, but writes the contents of string s rather than
-// a slice of bytes.
+// a slice of bytes. Files starting with a WriteString are uploaded as text, unless their Content-Type is set or can
+// be guessed from their extension.
 func (f *File) WriteString(s string) (int, error) {
+	if f.streamWriteSize == 0 && f.contentType == nil && f.guessContentType() == "" {
+		f.SetContentType("text/plain; charset=utf-8")
+	}
 	return f.Write([]byte(s)) // nolint: gocritic
 }
 
+// guessContentType returns the Content-Type of the file properties, or the one guessed from the extension
+func (f *File) guessContentType() string {
+	if f.fs.FileProps != nil && f.fs.FileProps.ContentType != nil {
+		return *f.fs.FileProps.ContentType
+	}
+	return mime.TypeByExtension(filepath.Ext(f.name))
+}
+
+// Flush waits until all the complete parts of the content written so far are uploaded, keeping the multipart
+// upload open. Less content is lost if the writer crashes after a Flush, but the object only becomes visible once
+// the file is closed. It does nothing on files not opened for writing, or writing to temporary files.
+func (f *File) Flush() error {
+	if f.streamWriteParts == nil {
+		return nil
+	}
+	return f.streamWriteParts.wait(f.streamWriteSize / s3manager.DefaultUploadPartSize)
+}
+
 // Close closes the File, rendering it unusable for I/O.
 // It returns an error, if any.
 func (f *File) Close() error {
 	// Closing a reading stream
-	if f.streamRead != nil {
+	if f.streamReadOpened {
+		f.streamReadOpened = false
+		if f.streamRead == nil {
+			return nil
+		}
 		// We try to close the Reader
 		defer func() {
 			f.streamRead = nil
@@ -191,8 +294,16 @@ func (f *File) Close() error {
 		defer func() {
 			f.streamWrite = nil
 			f.streamWriteCloseErr = nil
+			f.streamWriteSize = 0
+			f.streamWriteParts = nil
+			f.writeCacheBuf = nil
 		}()
 
+		// An existing file opened by Create is left as it is when nothing was written
+		if f.keepUnwritten && f.streamWriteAborted == nil && f.discardUnwritten() {
+			return nil
+		}
+
 		// We try to close the Writer
 		if err := f.streamWrite.Close(); err != nil {
 			return err
@@ -202,6 +313,12 @@ func (f *File) Close() error {
 		// might be rather slow.
 		err := <-f.streamWriteCloseErr
 		close(f.streamWriteCloseErr)
+		if f.streamWriteAborted != nil {
+			return f.streamWriteAborted
+		}
+		if err == nil && f.writeCacheBuf != nil {
+			f.fs.writeCache.add(f.name, f.writeCacheBuf.Bytes())
+		}
 		return err
 	}
 
@@ -213,15 +330,43 @@ func (f *File) Close() error {
 // It returns the number of bytes read and an error, if any.
 // EOF is signaled by a zero count with err set to io.EOF.
 func (f *File) Read(p []byte) (int, error) {
-	if f.streamRead == nil {
+	if f.isDir {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+
+	if !f.streamReadOpened {
 		return 0, io.EOF
 	}
 
-	n, err := f.streamRead.Read(p)
+	// Files opened lazily are looked up by their first read, with the request fetching their content if possible
+	if f.cachedInfo == nil && f.streamReadOffset == 0 {
+		if err := f.openReadStream(0); err != nil {
+			return 0, err
+		}
+	} else if err := f.lookup(); err != nil {
+		return 0, err
+	}
 
-	if err == nil {
-		f.streamReadOffset += int64(n)
+	if f.streamReadOffset >= f.cachedInfo.Size() && !f.streamReadDecoded {
+		return 0, io.EOF
+	}
+
+	// The stream is opened on the first read, or the first one after a seek
+	if f.streamRead == nil {
+		if err := f.openReadStream(f.streamReadOffset); err != nil {
+			return 0, err
+		}
+	}
+
+	// The buffer is filled as much as possible, instead of returning the small reads of the network
+	n := 0
+	var err error
+	for n < len(p) && err == nil {
+		var read int
+		read, err = f.streamRead.Read(p[n:])
+		n += read
 	}
+	f.streamReadOffset += int64(n)
 
 	return n, err
 }
@@ -231,6 +376,9 @@ func (f *File) Read(p []byte) (int, error) {
 // ReadAt always returns a non-nil error when n < len(b).
 // At end of file, that error is io.EOF.
 func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if f.readOptions.blockSize > 0 && !f.isDir {
+		return f.readAtBlocks(p, off)
+	}
 	_, err = f.Seek(off, io.SeekStart)
 	if err != nil {
 		return
@@ -251,7 +399,7 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 	}
 
 	// Read seek has its own implementation
-	if f.streamRead != nil {
+	if f.streamReadOpened {
 		return f.seekRead(offset, whence)
 	}
 
@@ -268,75 +416,385 @@ func (f *File) seekRead(offset int64, whence int) (int64, error) {
 	case io.SeekCurrent:
 		startByte = f.streamReadOffset + offset
 	case io.SeekEnd:
+		if err := f.lookup(); err != nil {
+			return 0, err
+		}
 		startByte = f.cachedInfo.Size() - offset
 	}
 
-	if err := f.streamRead.Close(); err != nil {
-		return 0, fmt.Errorf("couldn't close previous stream: %w", err)
-	}
-	f.streamRead = nil
-
 	if startByte < 0 {
 		return startByte, ErrInvalidSeek
 	}
 
-	return startByte, f.openReadStream(startByte)
+	// The stream is re-opened at the new offset by the next read, so that consecutive seeks don't fetch anything
+	if f.streamRead != nil {
+		if err := f.streamRead.Close(); err != nil {
+			return 0, fmt.Errorf("couldn't close previous stream: %w", err)
+		}
+		f.streamRead = nil
+	}
+	f.streamReadOffset = startByte
+
+	return startByte, nil
 }
 
 // Write writes len(b) bytes to the File.
 // It returns the number of bytes written and an error, if any.
 // Write returns a non-nil error when n != len(b).
 func (f *File) Write(p []byte) (int, error) {
+	if f.streamWriteAborted != nil {
+		return 0, f.streamWriteAborted
+	}
+	if f.fs.MaxObjectSize > 0 && f.streamWriteSize+int64(len(p)) > f.fs.MaxObjectSize {
+		f.abortWrite(ErrObjectTooLarge)
+		return 0, ErrObjectTooLarge
+	}
+
 	n, err := f.streamWrite.Write(p)
+	f.streamWriteSize += int64(n)
+
+	// Files growing too big for the write cache aren't kept in memory
+	if f.writeCacheBuf != nil {
+		if f.fs.writeCache.accepts(f.writeCacheBuf.Len() + n) {
+			f.writeCacheBuf.Write(p[:n])
+		} else {
+			f.writeCacheBuf = nil
+		}
+	}
 
 	// If we have an error, it's only the "read/write on closed pipe" and we
 	// should report the underlying one
 	if err != nil {
+		if f.streamWriteErr == nil {
+			// Or it's an error of the temporary file
+			return n, err
+		}
 		return 0, f.streamWriteErr
 	}
 
 	return n, err
 }
 
+// discardUnwritten drops the write stream if nothing was written to it, without uploading anything
+func (f *File) discardUnwritten() bool {
+	if f.streamWriteSize > 0 {
+		return false
+	}
+	switch w := f.streamWrite.(type) {
+	case *lazyWriter:
+		return w.discard()
+	case *tempFileWriter:
+		w.discard()
+		return true
+	}
+	return false
+}
+
+// abortWrite makes the upload of the write stream fail, the error is returned when closing the file
+func (f *File) abortWrite(err error) {
+	f.streamWriteAborted = err
+	switch w := f.streamWrite.(type) {
+	case *lazyWriter:
+		w.abort(err)
+	case *tempFileWriter:
+		w.discard()
+		f.streamWriteCloseErr <- err
+	}
+}
+
 func (f *File) openWriteStream() error {
 	if f.streamWrite != nil {
 		return ErrAlreadyOpened
 	}
 
+	if f.fs.writeCache != nil {
+		f.writeCacheBuf = &bytes.Buffer{}
+	}
+
+	if f.fs.TempFileWrites {
+		return f.openTempFileWriteStream()
+	}
+
 	reader, writer := io.Pipe()
 
 	f.streamWriteCloseErr = make(chan error)
-	f.streamWrite = writer
+	f.streamWriteParts = newPartsTracker(f.fs.S3API)
 
-	uploader := s3manager.NewUploader(f.fs.Session)
-	uploader.Concurrency = 1
+	// The upload starts with the first write, so that the file can still be configured until then
+	f.streamWrite = &lazyWriter{WriteCloser: writer, start: func() {
+		go func() {
+			err := f.upload(reader, f.streamWriteParts)
 
-	go func() {
-		input := &s3manager.UploadInput{
-			Bucket: aws.String(f.fs.Bucket),
-			Key:    aws.String(f.name),
-			Body:   reader,
-		}
+			if err != nil {
+				f.streamWriteErr = err
+				_ = writer.Close()
+			}
 
-		if f.fs.FileProps != nil {
-			applyFileWriteProps(input, f.fs.FileProps)
-		}
+			f.streamWriteParts.finish(err)
+			f.streamWriteCloseErr <- err
+			// close(f.streamWriteCloseErr)
+		}()
+	}}
+	return nil
+}
+
+// lazyWriter calls start before the first write, or when closed if nothing was written
+type lazyWriter struct {
+	io.WriteCloser
+	start func()
+	once  sync.Once
+}
+
+func (w *lazyWriter) Write(p []byte) (int, error) {
+	w.once.Do(w.start)
+	return w.WriteCloser.Write(p)
+}
+
+func (w *lazyWriter) Close() error {
+	w.once.Do(w.start)
+	return w.WriteCloser.Close()
+}
+
+// discard prevents the upload from starting, it returns false if it already started
+func (w *lazyWriter) discard() bool {
+	discarded := false
+	w.once.Do(func() { discarded = true })
+	return discarded
+}
+
+// abort makes the upload fail with an error, without uploading anything if it didn't start
+func (w *lazyWriter) abort(err error) {
+	w.once.Do(w.start)
+	if pw, ok := w.WriteCloser.(*io.PipeWriter); ok {
+		_ = pw.CloseWithError(err)
+	}
+}
+
+// openTempFileWriteStream buffers the written content in a temporary file, which is uploaded on close
+func (f *File) openTempFileWriteStream() error {
+	tmp, err := os.CreateTemp(f.fs.TempDir, "afero-s3-")
+	if err != nil {
+		return err
+	}
 
-		// If no Content-Type was specified, we'll guess one
-		if input.ContentType == nil {
-			input.ContentType = aws.String(mime.TypeByExtension(filepath.Ext(f.name)))
+	// The upload is performed when closing the temporary file, its result is sent like for the pipe stream
+	f.streamWriteCloseErr = make(chan error, 1)
+	f.streamWrite = &tempFileWriter{file: tmp, upload: func(body io.Reader) {
+		f.streamWriteCloseErr <- f.upload(body, f.fs.S3API)
+	}}
+	return nil
+}
+
+// upload uploads the content of the file from a reader, with a client of the Fs
+func (f *File) upload(body io.Reader, api s3iface.S3API) error {
+	input := f.fs.uploadInput(f.name, body)
+	if f.contentType != nil {
+		input.ContentType = f.contentType
+	}
+	if f.cacheControl != nil {
+		input.CacheControl = f.cacheControl
+	}
+	if f.acl != nil {
+		input.ACL = f.acl
+	}
+	if len(f.userMetadata) > 0 {
+		input.Metadata = aws.StringMap(f.userMetadata)
+	}
+	if f.expiresAt != nil {
+		if input.Metadata == nil {
+			input.Metadata = map[string]*string{}
 		}
+		input.Metadata[expiresAtMetadata] = aws.String(f.expiresAt.UTC().Format(time.RFC3339))
+	}
 
-		_, err := uploader.Upload(input)
+	return f.fs.upload(input, api, func(u *s3manager.Uploader) {
+		u.Concurrency = 1
+	})
+}
 
-		if err != nil {
-			f.streamWriteErr = err
-			_ = f.streamWrite.Close()
+// Metadata returns the user metadata of a file opened for reading. It's returned with the content, so it's fetched
+// by opening the stream the next read uses if the file wasn't read yet, and looked up if there's nothing left to read.
+func (f *File) Metadata() (map[string]string, error) {
+	if f.metadata != nil || !f.streamReadOpened || f.streamRead != nil {
+		return f.metadata, nil
+	}
+
+	if f.readCache == nil && (f.cachedInfo == nil || f.streamReadOffset < f.cachedInfo.Size()) {
+		if err := f.openReadStream(f.streamReadOffset); err != nil {
+			return nil, err
 		}
+		return f.metadata, nil
+	}
 
-		f.streamWriteCloseErr <- err
-		// close(f.streamWriteCloseErr)
+	head, err := f.fs.headObject(f.name)
+	if isNotFound(err) {
+		return nil, &os.PathError{Op: "metadata", Path: f.name, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "metadata", Path: f.name, Err: permissionError(err)}
+	}
+	f.metadata = aws.StringValueMap(head.Metadata)
+	return f.metadata, nil
+}
+
+// VersionID returns the version of a file opened for reading, in a versioned bucket. It's the version of the content
+// read, or the one that was looked up when opening the file if nothing was read yet.
+func (f *File) VersionID() string {
+	if f.versionID != "" {
+		return f.versionID
+	}
+	if info, ok := f.cachedInfo.(FileInfo); ok {
+		return info.versionID
+	}
+	return ""
+}
+
+// SetContentType defines the Content-Type of the file being written, instead of the one of the file properties or
+// the one guessed from its extension. It must be called before the first write.
+func (f *File) SetContentType(ct string) {
+	f.contentType = &ct
+}
+
+// SetCacheControl defines the Cache-Control of the file being written, instead of the one of the file properties.
+// It must be called before the first write.
+func (f *File) SetCacheControl(cc string) {
+	f.cacheControl = &cc
+}
+
+// SetExpiresAt defines when the file being written expires, after which SweepExpired removes it. It's saved in the
+// "x-amz-meta-expires-at" metadata. It must be called before the first write.
+func (f *File) SetExpiresAt(t time.Time) {
+	f.expiresAt = &t
+}
+
+// partsTracker counts the parts uploaded by an uploader, so that we can wait for them
+type partsTracker struct {
+	s3iface.S3API
+	mu       sync.Mutex
+	cond     *sync.Cond
+	uploaded int64 // uploaded is the number of parts uploaded
+	done     bool  // done is set when the upload is over
+	err      error // err is the error the upload failed with
+}
+
+func newPartsTracker(api s3iface.S3API) *partsTracker {
+	t := &partsTracker{S3API: api}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+func (t *partsTracker) UploadPartWithContext(
+	ctx aws.Context, in *s3.UploadPartInput, opts ...request.Option,
+) (*s3.UploadPartOutput, error) {
+	out, err := t.S3API.UploadPartWithContext(ctx, in, opts...)
+	if err == nil {
+		t.mu.Lock()
+		t.uploaded++
+		t.cond.Broadcast()
+		t.mu.Unlock()
+	}
+	return out, err
+}
+
+// finish stops the waits once the upload is over
+func (t *partsTracker) finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done = true
+	t.err = err
+	t.cond.Broadcast()
+}
+
+// wait waits until some parts are uploaded, or the upload is over
+func (t *partsTracker) wait(parts int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.uploaded < parts && !t.done {
+		t.cond.Wait()
+	}
+	return t.err
+}
+
+// tempFileWriter writes to a temporary file, and uploads it when closed. The temporary file is always removed.
+type tempFileWriter struct {
+	file      *os.File
+	upload    func(body io.Reader)
+	discarded bool // discarded is set when the content won't be uploaded
+}
+
+func (w *tempFileWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+// discard removes the temporary file, without uploading it
+func (w *tempFileWriter) discard() {
+	w.discarded = true
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
+
+func (w *tempFileWriter) Close() error {
+	if w.discarded {
+		return nil
+	}
+
+	defer func() {
+		_ = w.file.Close()
+		_ = os.Remove(w.file.Name())
 	}()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	w.upload(w.file)
+	return nil
+}
+
+// openRead opens the file for reading, directories can only be listed
+func (f *File) openRead() error {
+	// Files opened lazily are looked up by their first read, the root is known to be a directory
+	if f.fs.LazyOpen && !isRoot(f.name) {
+		if entry, ok := f.fs.writeCache.get(f.name); ok {
+			f.cachedInfo = f.fs.withPerms(entry.info)
+			f.readCache = entry.content
+		}
+		f.streamReadOpened = true
+		return nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		f.isDir = true
+		return nil
+	}
+
+	if entry, ok := f.fs.writeCache.get(f.name); ok {
+		f.readCache = entry.content
+	}
+
+	f.streamReadOpened = true
+	return nil
+}
+
+// lookup gets the FileInfo of a file opened lazily, if it wasn't fetched yet
+func (f *File) lookup() error {
+	if f.cachedInfo != nil {
+		return nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		f.isDir = true
+		return &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
 	return nil
 }
 
@@ -345,23 +803,154 @@ func (f *File) openReadStream(startAt int64) error {
 		return ErrAlreadyOpened
 	}
 
+	// The cached content isn't encoded like the one of the objects
+	if f.readCache != nil && f.readOptions.decoders == nil {
+		f.streamReadOffset = startAt
+		f.streamRead = io.NopCloser(bytes.NewReader(f.readCache[startAt:]))
+		return nil
+	}
+
 	var streamRange *string
 
-	if startAt > 0 {
-		streamRange = aws.String(fmt.Sprintf("bytes=%d-%d", startAt, f.cachedInfo.Size()))
+	if startAt > 0 || f.rangeEnd > 0 {
+		end := f.cachedInfo.Size() - 1
+		if f.rangeEnd > 0 && f.rangeEnd-1 < end {
+			end = f.rangeEnd - 1
+		}
+		streamRange = aws.String(fmt.Sprintf("bytes=%d-%d", startAt, end))
 	}
 
-	resp, err := f.fs.S3API.GetObject(&s3.GetObjectInput{
-		Bucket: aws.String(f.fs.Bucket),
-		Key:    aws.String(f.name),
-		Range:  streamRange,
+	req := &s3.GetObjectInput{
+		Bucket:               aws.String(f.fs.Bucket),
+		ExpectedBucketOwner:  f.fs.ExpectedBucketOwner,
+		Key:                  aws.String(f.fs.key(f.name)),
+		SSECustomerAlgorithm: f.fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       f.fs.sseCustomerKey(),
+		Range:                streamRange,
+	}
+	f.readOptions.applyGetObject(req)
+
+	resp, err := f.fs.S3API.GetObjectWithContext(aws.BackgroundContext(), req, f.fs.requestOptions()...)
+	if err != nil {
+		if f.cachedInfo == nil && isNotFound(err) {
+			// Files opened lazily may be directories, which have no object
+			if _, errDir := f.fs.statDirectory(f.name); errDir == nil {
+				f.isDir = true
+				return &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+			}
+			return &os.PathError{Op: "open", Path: f.name, Err: os.ErrNotExist}
+		}
+		return permissionError(err)
+	}
+
+	// Files opened lazily get their FileInfo from the response, their whole content being fetched
+	if f.cachedInfo == nil {
+		info := f.fs.newFileInfo(path.Base(f.name), false, aws.Int64Value(resp.ContentLength),
+			aws.TimeValue(resp.LastModified))
+		info.versionID = aws.StringValue(resp.VersionId)
+		f.cachedInfo = info
+	}
+
+	body := f.readOptions.wrapBody(resp)
+	body, decoded, err := f.readOptions.decoders.decode(body, resp.ContentEncoding, streamRange != nil)
+	if err != nil {
+		return &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+
+	f.metadata = aws.StringValueMap(resp.Metadata)
+	f.versionID = aws.StringValue(resp.VersionId)
+	f.streamReadOffset = startAt
+	f.streamReadDecoded = decoded
+	f.streamRead = closeOnCollect(body)
+	return nil
+}
+
+// collectedCloser closes a response body when it's garbage collected without being closed, like when the file
+// reading it is abandoned, so that its connection isn't leaked
+type collectedCloser struct {
+	io.ReadCloser
+}
+
+func closeOnCollect(body io.ReadCloser) io.ReadCloser {
+	c := &collectedCloser{ReadCloser: body}
+	runtime.SetFinalizer(c, func(c *collectedCloser) {
+		_ = c.ReadCloser.Close()
 	})
+	return c
+}
+
+func (c *collectedCloser) Close() error {
+	runtime.SetFinalizer(c, nil)
+	return c.ReadCloser.Close()
+}
+
+// readAtBlocks reads from the aligned blocks of the file, fetching them only when they aren't the last one
+func (f *File) readAtBlocks(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+
+	if err := f.lookup(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for n < len(p) {
+		if off >= f.cachedInfo.Size() {
+			return n, io.EOF
+		}
+		if err := f.loadBlock(off); err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], f.readBlock[off-f.readBlockOffset:])
+		n += copied
+		off += int64(copied)
+	}
+
+	return n, nil
+}
+
+// loadBlock fetches the block containing an offset, unless it's already loaded
+func (f *File) loadBlock(off int64) error {
+	if f.readBlock != nil && off >= f.readBlockOffset && off < f.readBlockOffset+int64(len(f.readBlock)) {
+		return nil
+	}
+
+	if f.readCache != nil {
+		f.readBlock = f.readCache
+		f.readBlockOffset = 0
+		return nil
+	}
+
+	start := off - off%f.readOptions.blockSize
+	req := &s3.GetObjectInput{
+		Bucket:               aws.String(f.fs.Bucket),
+		ExpectedBucketOwner:  f.fs.ExpectedBucketOwner,
+		Key:                  aws.String(f.fs.key(f.name)),
+		SSECustomerAlgorithm: f.fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       f.fs.sseCustomerKey(),
+		Range:                aws.String(fmt.Sprintf("bytes=%d-%d", start, start+f.readOptions.blockSize-1)),
+	}
+	f.readOptions.applyGetObject(req)
+
+	resp, err := f.fs.S3API.GetObjectWithContext(aws.BackgroundContext(), req, f.fs.requestOptions()...)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
 
-	f.streamReadOffset = startAt
-	f.streamRead = resp.Body
+	block, err := io.ReadAll(f.readOptions.wrapIdleTimeout(resp.Body))
+	if err != nil {
+		return err
+	}
+	if int64(len(block)) <= off-start {
+		return io.ErrUnexpectedEOF
+	}
+
+	f.readBlock = block
+	f.readBlockOffset = start
 	return nil
 }
 
@@ -0,0 +1,625 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaddirFunc(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	for i := 0; i < 2500; i++ {
+		mock.putObject("bucket", fmt.Sprintf("dir/file-%04d.parquet", i), nil, time.Now())
+		mock.putObject("bucket", fmt.Sprintf("dir/file-%04d.json", i), nil, time.Now())
+	}
+
+	t.Run("All", func(t *testing.T) {
+		dir, err := fs.Open("/dir")
+		req.NoError(err)
+
+		count := 0
+		req.NoError(dir.(*File).ReaddirFunc(func(info os.FileInfo) error {
+			if strings.HasSuffix(info.Name(), ".parquet") {
+				count++
+			}
+			return nil
+		}))
+		req.Equal(2500, count)
+	})
+
+	t.Run("EarlyStop", func(t *testing.T) {
+		dir, err := fs.Open("/dir")
+		req.NoError(err)
+		mock.resetCalls()
+
+		var names []string
+		req.NoError(dir.(*File).ReaddirFunc(func(info os.FileInfo) error {
+			names = append(names, info.Name())
+			if len(names) == 3 {
+				return ErrStopReaddir
+			}
+			return nil
+		}))
+		req.Equal([]string{"file-0000.json", "file-0000.parquet", "file-0001.json"}, names)
+		req.Equal(1, mock.count("ListObjectsV2"))
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		dir, err := fs.Open("/dir")
+		req.NoError(err)
+
+		errFn := errors.New("fn failed")
+		req.ErrorIs(dir.(*File).ReaddirFunc(func(os.FileInfo) error { return errFn }), errFn)
+	})
+}
+
+func TestTempFileWrites(t *testing.T) {
+	req := require.New(t)
+	dir := t.TempDir()
+	fs, mock := newMockFs(t, WithTempFileWrites(dir))
+
+	content := bytes.Repeat([]byte("0123456789"), 600*1024) // 6MB, more than the 5MB the uploader buffers in memory
+
+	file, err := fs.OpenFile("file", os.O_WRONLY, 0750)
+	req.NoError(err)
+	_, err = file.Write(content)
+	req.NoError(err)
+
+	tmpFiles, err := os.ReadDir(dir)
+	req.NoError(err)
+	req.Len(tmpFiles, 1)
+	req.Zero(mock.count("CreateMultipartUpload"), "nothing should be uploaded before close")
+
+	req.NoError(file.Close())
+
+	tmpFiles, err = os.ReadDir(dir)
+	req.NoError(err)
+	req.Empty(tmpFiles)
+	req.Equal(content, mock.getObject("bucket", "file").body)
+	req.Equal(2, mock.count("UploadPart"))
+}
+
+func TestReadDirectory(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "dir/file", []byte("content"), time.Now())
+
+	dir, err := fs.Open("/dir")
+	req.NoError(err)
+
+	fis, err := dir.Readdir(-1)
+	req.NoError(err)
+	req.Len(fis, 1)
+
+	_, err = dir.Read(make([]byte, 10))
+	req.ErrorIs(err, syscall.EISDIR)
+	var pathErr *os.PathError
+	req.True(errors.As(err, &pathErr))
+	req.Equal("read", pathErr.Op)
+	req.Equal("/dir", pathErr.Path)
+}
+
+func TestDirectoryName(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "dir/", nil, time.Now())
+	mock.putObject("bucket", "dir/file", []byte("content"), time.Now())
+
+	for _, name := range []string{"/dir", "/dir/", "dir/"} {
+		dir, err := fs.OpenFile(name, os.O_RDONLY, 0)
+		req.NoError(err)
+		req.Equal(strings.TrimSuffix(name, "/"), dir.Name(), name)
+
+		names, err := dir.Readdirnames(-1)
+		req.NoError(err)
+		req.Equal([]string{"file"}, names)
+
+		info, err := dir.Stat()
+		req.NoError(err)
+		req.True(info.IsDir())
+	}
+
+	root, err := fs.Open("/")
+	req.NoError(err)
+	req.Equal("/", root.Name())
+
+	// The marker written by Mkdir is named like the directory
+	marker, err := fs.OpenFile("/other/", os.O_CREATE, 0755)
+	req.NoError(err)
+	req.Equal("/other", marker.Name())
+	req.NoError(marker.Close())
+	req.NotNil(mock.getObject("bucket", "other/"))
+}
+
+func TestFlush(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	file, err := fs.OpenFile("/file", os.O_WRONLY, 0)
+	req.NoError(err)
+
+	part := bytes.Repeat([]byte("a"), 5*1024*1024)
+	for i := 0; i < 2; i++ {
+		_, err = file.Write(part)
+		req.NoError(err)
+	}
+	_, err = file.Write([]byte("end"))
+	req.NoError(err)
+
+	req.NoError(file.(*File).Flush())
+	req.Equal(2, mock.count("UploadPart"))
+	req.Equal(0, mock.count("CompleteMultipartUpload"))
+	req.Nil(mock.getObject("bucket", "file"))
+
+	req.NoError(file.Close())
+	req.Equal(3, mock.count("UploadPart"))
+	req.Equal(1, mock.count("CompleteMultipartUpload"))
+	req.EqualValues(2*len(part)+3, mock.getObject("bucket", "file").size())
+
+	t.Run("NotWriting", func(t *testing.T) {
+		file, err := fs.Open("/file")
+		req.NoError(err)
+		req.NoError(file.(*File).Flush())
+		req.NoError(file.Close())
+	})
+}
+
+func TestSeekBeforeRead(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	content := make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	mock.putObject("bucket", "file", content, time.Now())
+
+	file, err := fs.Open("/file")
+	req.NoError(err)
+	req.Zero(mock.count("GetObject"))
+
+	offset, err := file.Seek(100, io.SeekStart)
+	req.NoError(err)
+	req.EqualValues(100, offset)
+	req.Zero(mock.count("GetObject"))
+
+	buf := make([]byte, 50)
+	n, err := file.Read(buf)
+	req.NoError(err)
+	req.Equal(content[100:150], buf[:n])
+	req.Equal(1, mock.count("GetObject"))
+	req.Equal("bytes=100-999", aws.StringValue(mock.lastInput("GetObject").(*s3.GetObjectInput).Range))
+
+	// Reading goes on from the same stream
+	n, err = file.Read(buf)
+	req.NoError(err)
+	req.Equal(content[150:200], buf[:n])
+	req.Equal(1, mock.count("GetObject"))
+
+	// Seeking relatively to the current offset
+	offset, err = file.Seek(-100, io.SeekCurrent)
+	req.NoError(err)
+	req.EqualValues(100, offset)
+	rest, err := io.ReadAll(file)
+	req.NoError(err)
+	req.Equal(content[100:], rest)
+	req.Equal(2, mock.count("GetObject"))
+
+	// Reading at the end doesn't fetch anything
+	_, err = file.Seek(1000, io.SeekStart)
+	req.NoError(err)
+	_, err = file.Read(buf)
+	req.ErrorIs(err, io.EOF)
+	req.Equal(2, mock.count("GetObject"))
+
+	req.NoError(file.Close())
+}
+
+func TestSetContentType(t *testing.T) {
+	req := require.New(t)
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Stream", nil},
+		{"TempFile", []Option{WithTempFileWrites(t.TempDir())}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, mock := newMockFs(t, append(tc.opts, WithFileProps(&UploadedFileProperties{
+				ContentType: aws.String("application/octet-stream"),
+			}))...)
+
+			file, err := fs.OpenFile("/photo", os.O_WRONLY, 0)
+			req.NoError(err)
+			file.(*File).SetContentType("image/jpeg")
+			_, err = file.WriteString("content")
+			req.NoError(err)
+			req.NoError(file.Close())
+
+			head, err := mock.HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+				Bucket: aws.String("bucket"),
+				Key:    aws.String("photo"),
+			})
+			req.NoError(err)
+			req.Equal("image/jpeg", aws.StringValue(head.ContentType))
+
+			// Other files keep the file properties
+			testCreateFile(t, fs, "/other", "content")
+			req.Equal("application/octet-stream", aws.StringValue(mock.getObject("bucket", "other").contentType))
+		})
+	}
+}
+
+func TestSetCacheControl(t *testing.T) {
+	req := require.New(t)
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Stream", nil},
+		{"TempFile", []Option{WithTempFileWrites(t.TempDir())}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, mock := newMockFs(t, append(tc.opts, WithFileProps(&UploadedFileProperties{
+				CacheControl: aws.String("no-cache"),
+			}))...)
+
+			file, err := fs.Create("/app.js")
+			req.NoError(err)
+			file.(*File).SetCacheControl("public, max-age=31536000, immutable")
+			_, err = file.WriteString("content")
+			req.NoError(err)
+			req.NoError(file.Close())
+			req.Equal("public, max-age=31536000, immutable",
+				aws.StringValue(mock.getObject("bucket", "app.js").cacheControl))
+
+			// Other files keep the file properties
+			testCreateFile(t, fs, "/index.html", "content")
+			req.Equal("no-cache", aws.StringValue(mock.getObject("bucket", "index.html").cacheControl))
+		})
+	}
+}
+
+func TestLazyOpen(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithLazyOpen())
+	mock.putObject("bucket", "dir/file", []byte("content"), time.Now())
+	mock.resetCalls()
+
+	file, err := fs.Open("/dir/file")
+	req.NoError(err)
+	req.Empty(mock.calls)
+
+	content, err := io.ReadAll(file)
+	req.NoError(err)
+	req.Equal("content", string(content))
+	req.Equal([]string{"GetObject"}, mock.calls)
+	req.NoError(file.Close())
+
+	t.Run("Seek", func(t *testing.T) {
+		file, err := fs.Open("/dir/file")
+		req.NoError(err)
+		_, err = file.Seek(4, io.SeekEnd)
+		req.NoError(err)
+		content, err := io.ReadAll(file)
+		req.NoError(err)
+		req.Equal("tent", string(content))
+		req.NoError(file.Close())
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		file, err := fs.Open("/dir/missing")
+		req.NoError(err)
+		_, err = file.Read(make([]byte, 10))
+		req.ErrorIs(err, os.ErrNotExist)
+		req.NoError(file.Close())
+	})
+
+	t.Run("Directory", func(t *testing.T) {
+		dir, err := fs.Open("/dir")
+		req.NoError(err)
+		names, err := dir.Readdirnames(0)
+		req.NoError(err)
+		req.Equal([]string{"file"}, names)
+	})
+
+	t.Run("ReadDirectory", func(t *testing.T) {
+		dir, err := fs.Open("/dir")
+		req.NoError(err)
+		for i := 0; i < 2; i++ {
+			_, err = dir.Read(make([]byte, 10))
+			req.ErrorIs(err, syscall.EISDIR)
+			var pathErr *os.PathError
+			req.ErrorAs(err, &pathErr)
+			req.Equal("read", pathErr.Op)
+			req.Equal("/dir", pathErr.Path)
+		}
+		req.NoError(dir.Close())
+	})
+}
+
+func TestFileMetadata(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "file", []byte("content"), time.Now()).metadata = map[string]*string{
+		"Author": aws.String("me"),
+		"Source": aws.String("scanner"),
+	}
+
+	file, err := fs.Open("/file")
+	req.NoError(err)
+	mock.resetCalls()
+
+	// The metadata is fetched with the content
+	metadata, err := file.(*File).Metadata()
+	req.NoError(err)
+	req.Equal(map[string]string{"Author": "me", "Source": "scanner"}, metadata)
+	content, err := io.ReadAll(file)
+	req.NoError(err)
+	req.Equal("content", string(content))
+	metadata, err = file.(*File).Metadata()
+	req.NoError(err)
+	req.Equal(map[string]string{"Author": "me", "Source": "scanner"}, metadata)
+	req.Equal([]string{"GetObject"}, mock.calls)
+	req.NoError(file.Close())
+
+	t.Run("AtEnd", func(t *testing.T) {
+		file, err := fs.Open("/file")
+		req.NoError(err)
+		_, err = file.Seek(7, io.SeekStart)
+		req.NoError(err)
+		mock.resetCalls()
+
+		// Nothing is left to read, the metadata is looked up
+		metadata, err := file.(*File).Metadata()
+		req.NoError(err)
+		req.Equal(map[string]string{"Author": "me", "Source": "scanner"}, metadata)
+		req.Equal([]string{"HeadObject"}, mock.calls)
+		req.NoError(file.Close())
+	})
+
+	t.Run("Removed", func(t *testing.T) {
+		file, err := fs.Open("/file")
+		req.NoError(err)
+		req.NoError(fs.Remove("/file"))
+
+		metadata, err := file.(*File).Metadata()
+		req.Error(err)
+		req.Nil(metadata)
+		req.NoError(file.Close())
+	})
+
+	t.Run("Lazy", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithLazyOpen())
+		mock.putObject("bucket", "file", []byte("content"), time.Now()).metadata = map[string]*string{
+			"Author": aws.String("me"),
+		}
+
+		file, err := fs.Open("/file")
+		req.NoError(err)
+		content, err := io.ReadAll(file)
+		req.NoError(err)
+		req.Equal("content", string(content))
+		metadata, err := file.(*File).Metadata()
+		req.NoError(err)
+		req.Equal(map[string]string{"Author": "me"}, metadata)
+		req.Zero(mock.count("HeadObject"))
+		req.Equal(1, mock.count("GetObject"))
+	})
+}
+
+func TestMaxObjectSize(t *testing.T) {
+	req := require.New(t)
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Stream", nil},
+		{"TempFile", []Option{WithTempFileWrites(t.TempDir())}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, mock := newMockFs(t, append(tc.opts, WithMaxObjectSize(10))...)
+
+			file, err := fs.Create("/file")
+			req.NoError(err)
+			mock.resetCalls()
+
+			_, err = file.Write([]byte("12345678"))
+			req.NoError(err)
+			_, err = file.Write([]byte("9abc"))
+			req.ErrorIs(err, ErrObjectTooLarge)
+			_, err = file.Write([]byte("d"))
+			req.ErrorIs(err, ErrObjectTooLarge)
+			req.ErrorIs(file.Close(), ErrObjectTooLarge)
+
+			// The previous content is kept
+			req.Zero(mock.count("PutObject"))
+			req.Empty(mock.getObject("bucket", "file").body)
+		})
+	}
+
+	t.Run("Multipart", func(t *testing.T) {
+		const partSize = 5 * 1024 * 1024
+		fs, mock := newMockFs(t, WithMaxObjectSize(partSize+1024))
+
+		file, err := fs.OpenFile("/big", os.O_WRONLY, 0o644)
+		req.NoError(err)
+		_, err = file.Write(make([]byte, partSize))
+		req.NoError(err)
+		_, err = file.Write(make([]byte, 2048))
+		req.ErrorIs(err, ErrObjectTooLarge)
+		req.ErrorIs(file.Close(), ErrObjectTooLarge)
+
+		req.Nil(mock.getObject("bucket", "big"))
+		req.Equal(1, mock.count("AbortMultipartUpload"))
+		req.Empty(mock.uploads)
+	})
+}
+
+func TestWriteContentType(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	write := func(name string, fn func(file afero.File) error) {
+		file, err := fs.OpenFile(name, os.O_WRONLY, 0o644)
+		req.NoError(err)
+		req.NoError(fn(file))
+		req.NoError(file.Close())
+	}
+
+	// Writing through the file guesses the Content-Type from the extension, like Create
+	write("/page.html", func(file afero.File) error {
+		_, err := file.Write([]byte("<html></html>"))
+		return err
+	})
+	req.Equal("text/html; charset=utf-8", aws.StringValue(mock.getObject("bucket", "page.html").contentType))
+
+	write("/data.json", func(file afero.File) error {
+		_, err := file.WriteString(`{"key":"value"}`)
+		return err
+	})
+	req.Equal("application/json", aws.StringValue(mock.getObject("bucket", "data.json").contentType))
+
+	// Files without extension written as strings are text
+	write("/notes", func(file afero.File) error {
+		_, err := file.WriteString("some notes")
+		return err
+	})
+	req.Equal("text/plain; charset=utf-8", aws.StringValue(mock.getObject("bucket", "notes").contentType))
+
+	write("/blob", func(file afero.File) error {
+		_, err := file.Write([]byte{0, 1, 2})
+		return err
+	})
+	req.NotEqual("text/plain; charset=utf-8", aws.StringValue(mock.getObject("bucket", "blob").contentType))
+}
+
+// trackedBody counts how many times the bodies it's part of were closed
+type trackedBody struct {
+	io.Reader
+	closed *int32
+}
+
+func (b trackedBody) Close() error {
+	atomic.AddInt32(b.closed, 1)
+	return nil
+}
+
+// trackingS3 tracks the closing of the bodies of the objects it returns
+type trackingS3 struct {
+	*mockS3
+	closed *int32
+}
+
+func (m trackingS3) GetObjectWithContext(
+	ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option,
+) (*s3.GetObjectOutput, error) {
+	out, err := m.mockS3.GetObjectWithContext(ctx, in, opts...)
+	if err == nil {
+		out.Body = trackedBody{Reader: out.Body, closed: m.closed}
+	}
+	return out, err
+}
+
+func TestReadBodyClosed(t *testing.T) {
+	req := require.New(t)
+	mock := newMockS3()
+	closed := new(int32)
+	fs := NewFsWithOptions("bucket", nil, WithS3API(trackingS3{mockS3: mock, closed: closed}))
+	mock.putObject("bucket", "file", []byte("some content"), time.Now())
+
+	// Closing after a partial read
+	file, err := fs.Open("file")
+	req.NoError(err)
+	_, err = file.Read(make([]byte, 4))
+	req.NoError(err)
+	req.NoError(file.Close())
+	req.Equal(int32(1), atomic.LoadInt32(closed))
+
+	// Seeking closes the previous stream
+	file, err = fs.Open("file")
+	req.NoError(err)
+	_, err = file.Read(make([]byte, 4))
+	req.NoError(err)
+	_, err = file.Seek(8, io.SeekStart)
+	req.NoError(err)
+	req.Equal(int32(2), atomic.LoadInt32(closed))
+	n, _ := file.Read(make([]byte, 4))
+	req.Equal(4, n)
+	req.NoError(file.Close())
+	req.Equal(int32(3), atomic.LoadInt32(closed))
+
+	// Abandoning the file without closing it
+	func() {
+		file, err := fs.Open("file")
+		req.NoError(err)
+		_, err = file.Read(make([]byte, 4))
+		req.NoError(err)
+	}()
+	req.Eventually(func() bool {
+		runtime.GC()
+		return atomic.LoadInt32(closed) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestVersionID(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	obj := mock.putObject("bucket", "file", []byte("v1"), time.Now())
+	obj.versionID = aws.String("version-1")
+
+	info, err := fs.Stat("/file")
+	req.NoError(err)
+	req.Equal(ObjectSys{VersionID: "version-1"}, info.Sys())
+
+	file, err := fs.Open("/file")
+	req.NoError(err)
+	req.Equal("version-1", file.(*File).VersionID())
+
+	// The version read is the one returned with the content
+	obj = mock.putObject("bucket", "file", []byte("v2"), time.Now())
+	obj.versionID = aws.String("version-2")
+	data, err := io.ReadAll(file)
+	req.NoError(err)
+	req.Equal("v2", string(data))
+	req.Equal("version-2", file.(*File).VersionID())
+	req.NoError(file.Close())
+
+	t.Run("LazyOpen", func(t *testing.T) {
+		fs := NewFsWithOptions("bucket", nil, WithS3API(mock), WithLazyOpen())
+		file, err := fs.Open("/file")
+		req.NoError(err)
+		_, err = io.ReadAll(file)
+		req.NoError(err)
+		req.Equal("version-2", file.(*File).VersionID())
+		info, err := file.Stat()
+		req.NoError(err)
+		req.Equal(ObjectSys{VersionID: "version-2"}, info.Sys())
+	})
+
+	t.Run("Unversioned", func(t *testing.T) {
+		mock.putObject("bucket", "other", []byte("content"), time.Now())
+		info, err := fs.Stat("/other")
+		req.NoError(err)
+		req.Nil(info.Sys())
+	})
+}
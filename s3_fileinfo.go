@@ -12,15 +12,23 @@ type FileInfo struct {
 	name        string
 	directory   bool
 	sizeInBytes int64
+	versionID   string
+	mode        os.FileMode // mode overrides the default mode when set
+}
+
+// ObjectSys is returned by the Sys of the FileInfo of files read from versioned buckets
+type ObjectSys struct {
+	VersionID string // VersionID is the version of the object that was looked up or read
 }
 
 // NewFileInfo creates file cachedInfo.
+// The modification time is converted to UTC, as S3-compatible backends don't all use the same timezone.
 func NewFileInfo(name string, directory bool, sizeInBytes int64, modTime time.Time) FileInfo {
 	return FileInfo{
 		name:        name,
 		directory:   directory,
 		sizeInBytes: sizeInBytes,
-		modTime:     modTime,
+		modTime:     modTime.UTC(),
 	}
 }
 
@@ -35,17 +43,20 @@ func (fi FileInfo) Size() int64 {
 }
 
 // Mode provides the file mode bits. For a file in S3 this defaults to
-// 664 for files, 775 for directories.
+// 644 for files, 755 for directories, unless the Fs defines other permissions.
 // In the future this may return differently depending on the permissions
 // available on the bucket.
 func (fi FileInfo) Mode() os.FileMode {
+	if fi.mode != 0 {
+		return fi.mode
+	}
 	if fi.directory {
 		return 0755
 	}
-	return 0664
+	return 0644
 }
 
-// ModTime provides the last modification time.
+// ModTime provides the last modification time, in UTC.
 func (fi FileInfo) ModTime() time.Time {
 	return fi.modTime
 }
@@ -55,7 +66,10 @@ func (fi FileInfo) IsDir() bool {
 	return fi.directory
 }
 
-// Sys provides the underlying data source (can return nil)
+// Sys provides the underlying data source (can return nil). It's an ObjectSys for the files of versioned buckets.
 func (fi FileInfo) Sys() interface{} {
-	return nil
+	if fi.versionID == "" {
+		return nil
+	}
+	return ObjectSys{VersionID: fi.versionID}
 }
@@ -3,87 +3,316 @@ package s3
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"mime"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/spf13/afero"
 )
 
 // Fs is an FS object backed by S3.
 type Fs struct {
-	FileProps *UploadedFileProperties // FileProps define the file properties we want to set for all new files
-	Session   *session.Session        // Session config
-	S3API     *s3.S3
-	Bucket    string // Bucket name
-	RawMode   bool   // Controls path sanitation.
+	FileProps           *UploadedFileProperties // FileProps define the file properties we want to set for all new files
+	Session             *session.Session        // Session config
+	S3API               s3iface.S3API           // S3API is the client performing all the requests
+	Bucket              string                  // Bucket name
+	Prefix              string                  // Prefix all the keys are scoped to
+	ExpectedBucketOwner *string                 // ExpectedBucketOwner makes requests fail if the bucket has another owner
+	RequestTimeout      time.Duration           // RequestTimeout aborts requests not answered in time
+	Retryer             request.Retryer         // Retryer replaces the retry policy of the client when set
+	TempDir             string                  // TempDir is where temporary files are created, defaults to os.TempDir
+	RawMode             bool                    // Controls path sanitation.
+	KeySanitizer        KeySanitizer            // KeySanitizer encodes the characters of the names unsafe in keys
+	PermACL             bool                    // PermACL sets the ACL of created files from their permissions
+	LazyOpen            bool                    // LazyOpen looks files opened for reading up on their first read
+	DisableDirMarkers   bool                    // DisableDirMarkers doesn't create "dir/" objects for the directories
+	SSECustomerKey      string                  // SSECustomerKey encrypts the files with SSE-C when set
+	TempFileWrites      bool                    // TempFileWrites buffers writes in temporary files instead of memory
+	CreateIfMissing     bool                    // CreateIfMissing makes Create keep the content of existing files
+	ListObjectsV1       bool                    // ListObjectsV1 lists with the legacy ListObjects instead of ListObjectsV2
+	UnsignedPayload     bool                    // UnsignedPayload doesn't sign the content of the uploads
+	MaxObjectSize       int64                   // MaxObjectSize aborts the writes of bigger files, when set
+	TrashPrefix         string                  // TrashPrefix is where removed files are moved to, when set
+	VerifyMultipartETag bool                    // VerifyMultipartETag checks the ETag of the multipart uploads
+	Clock               func() time.Time        // Clock gives the times S3 doesn't provide, defaults to time.Now
+	BypassGovernance    bool                    // BypassGovernance removes files protected by governance-mode locks
+	DefaultFilePerm     os.FileMode             // DefaultFilePerm is the mode of the files, 0644 when not set
+	DefaultDirPerm      os.FileMode             // DefaultDirPerm is the mode of the directories, 0755 when not set
+	AutoCreateBucket    bool                    // AutoCreateBucket creates the bucket when a write finds it missing
+	ListPageSize        int64                   // ListPageSize is the number of keys per listing page, up to 1000
+	HeadObjectFallback  bool                    // HeadObjectFallback stats with a GetObject when HeadObject is denied
+	AllowFileOverDir    bool                    // AllowFileOverDir lets Create write a file named like a directory
+	statCache           *statCache              // statCache is only set when enabled with WithStatCache
+	bucketCheck         *bucketCheck            // bucketCheck is only set when enabled with WithBucketCheck
+	uploadSlots         chan struct{}           // uploadSlots is only set when enabled with WithMaxConcurrentUploads
+	writeCache          *writeCache             // writeCache is only set when enabled with WithWriteCache
 }
 
 // UploadedFileProperties defines all the set properties applied to future files
 type UploadedFileProperties struct {
-	ACL             *string // ACL defines the right to apply
-	CacheControl    *string // CacheControl defines the Cache-Control header
-	ContentType     *string // ContentType defines the Content-Type header
-	ContentEncoding *string // ContentEncoding defines the Content-Encoding header
+	ACL              *string // ACL defines the right to apply
+	CacheControl     *string // CacheControl defines the Cache-Control header
+	ContentType      *string // ContentType defines the Content-Type header
+	ContentEncoding  *string // ContentEncoding defines the Content-Encoding header
+	BucketKeyEnabled *bool   // BucketKeyEnabled uses an S3 Bucket Key for SSE-KMS encryption
+	GrantRead        *string // GrantRead allows grantees to read the object and its metadata
+	GrantReadACP     *string // GrantReadACP allows grantees to read the object ACL
+	GrantWriteACP    *string // GrantWriteACP allows grantees to write the object ACL
+	GrantFullControl *string // GrantFullControl gives grantees READ, READ_ACP, and WRITE_ACP permissions
+	Tagging          *string // Tagging defines the tags set at creation, URL-encoded like "key1=value1&key2=value2"
 }
 
 // NewFs creates a new Fs object writing files to a given S3 bucket.
 func NewFs(bucket string, session *session.Session) *Fs {
-	s3Api := s3.New(session)
 	return &Fs{
 		Bucket:  bucket,
 		Session: session,
-		S3API:   s3Api,
+		S3API:   newClient(bucket, session),
 	}
 }
 
+// NewFsWithOptions creates a new Fs object writing files to a given S3 bucket, configured through options.
+func NewFsWithOptions(bucket string, session *session.Session, opts ...Option) *Fs {
+	fs := &Fs{
+		Bucket:  bucket,
+		Session: session,
+	}
+
+	for _, opt := range opts {
+		opt(fs)
+	}
+
+	if fs.S3API == nil {
+		fs.S3API = newClient(bucket, session)
+	}
+
+	return fs
+}
+
+// newClient creates the client of a bucket. The buckets with dots in their names are addressed path-style, unless the
+// session says otherwise, as their virtual-hosted-style host names don't match the TLS certificate of S3.
+func newClient(bucket string, session *session.Session) *s3.S3 {
+	if strings.Contains(bucket, ".") && session.Config.S3ForcePathStyle == nil {
+		return s3.New(session, &aws.Config{S3ForcePathStyle: aws.Bool(true)})
+	}
+	return s3.New(session)
+}
+
+// NewFsWithAPI creates a new Fs object writing files to a given S3 bucket through any client implementing the API
+// interface, without a session. This allows plugging an adapter to another client, like one of aws-sdk-go-v2. The
+// other features of the Fs, like Rename or the tags, use the methods of s3iface.S3API the client also implements, and
+// fail with ErrNotImplemented otherwise. The request options given to the methods, like the one reporting a
+// *RegionError, only apply to aws-sdk-go clients and can be ignored by the others. A client implementing the whole
+// s3iface.S3API is used as it is.
+func NewFsWithAPI(bucket string, api API, opts ...Option) *Fs {
+	client, ok := api.(s3iface.S3API)
+	if !ok {
+		client = &apiClient{api: api}
+	}
+	return NewFsWithOptions(bucket, nil, append([]Option{WithS3API(client)}, opts...)...)
+}
+
+// now returns the current time of the Clock, like the modification time of the directories, which S3 doesn't store
+func (fs *Fs) now() time.Time {
+	if fs.Clock != nil {
+		return fs.Clock()
+	}
+	return time.Now()
+}
+
+// newFileInfo creates the FileInfo of a file, with the default permissions of the Fs
+func (fs Fs) newFileInfo(name string, directory bool, sizeInBytes int64, modTime time.Time) FileInfo {
+	return fs.withPerms(NewFileInfo(name, directory, sizeInBytes, modTime))
+}
+
+// withPerms sets the default permissions of the Fs to a FileInfo
+func (fs Fs) withPerms(info FileInfo) FileInfo {
+	if info.directory {
+		info.mode = fs.DefaultDirPerm
+	} else {
+		info.mode = fs.DefaultFilePerm
+	}
+	return info
+}
+
+// maxListPageSize is the maximum, and default, number of keys S3 returns per listing page
+const maxListPageSize = 1000
+
+// listPageSize returns the number of keys to list per page, the sizes out of the 1 to 1000 range being ignored
+func (fs Fs) listPageSize() int64 {
+	if fs.ListPageSize < 1 || fs.ListPageSize > maxListPageSize {
+		return maxListPageSize
+	}
+	return fs.ListPageSize
+}
+
 // ErrNotImplemented is returned when this operation is not (yet) implemented
 var ErrNotImplemented = errors.New("not implemented")
 
 // ErrNotSupported is returned when this operations is not supported by S3
 var ErrNotSupported = errors.New("s3 doesn't support this operation")
 
+// ErrNotConfirmed is returned by Purge when it isn't confirmed
+var ErrNotConfirmed = errors.New("purge not confirmed")
+
+// ErrObjectTooLarge is returned when writing a file bigger than the MaxObjectSize
+var ErrObjectTooLarge = errors.New("file bigger than the maximum object size")
+
 // ErrAlreadyOpened is returned when the file is already opened
 var ErrAlreadyOpened = errors.New("already opened")
 
 // ErrInvalidSeek is returned when the seek operation is not doable
 var ErrInvalidSeek = errors.New("invalid seek offset")
 
+// ErrConflict is returned by CompareAndSwap when the file changed since it was read
+var ErrConflict = errors.New("file changed concurrently")
+
+// PermissionError is returned when S3 denies a request (403 AccessDenied) and wraps its error. It matches
+// os.ErrPermission, so that errors.Is(err, os.ErrPermission) can be used like with any afero.Fs.
+type PermissionError struct {
+	Err error // Err is the error returned by S3
+}
+
+func (e *PermissionError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the error returned by S3
+func (e *PermissionError) Unwrap() error { return e.Err }
+
+// Is makes the error match os.ErrPermission
+func (e *PermissionError) Is(target error) bool { return target == os.ErrPermission }
+
+// permissionError wraps the errors of the requests S3 denied in a PermissionError, and returns the others as is
+func permissionError(err error) error {
+	var errRequestFailure awserr.RequestFailure
+	if errors.As(err, &errRequestFailure) && errRequestFailure.StatusCode() == http.StatusForbidden {
+		return &PermissionError{Err: err}
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == "AccessDenied" {
+		return &PermissionError{Err: err}
+	}
+	return err
+}
+
+// isNotFound checks if an error means the object, or the listed prefix, doesn't exist
+func isNotFound(err error) bool {
+	var errRequestFailure awserr.RequestFailure
+	return errors.As(err, &errRequestFailure) && errRequestFailure.StatusCode() == http.StatusNotFound
+}
+
+// isRoot checks if a sanitized name is the root of the bucket, or of the prefix. Like with sanitize, blank names are
+// considered empty.
+func isRoot(name string) bool {
+	trimmed := strings.Trim(strings.TrimSpace(name), "/")
+	return trimmed == "" || trimmed == "."
+}
+
+// rootError is returned by the operations on files that can't apply to the root
+func rootError(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrInvalid}
+}
+
+// BatchError is returned when an operation on many files failed on some of them
+type BatchError struct {
+	Errors map[string]error // Errors contains the error of each failed file
+}
+
+func (e *BatchError) add(name string, err error) {
+	if e.Errors == nil {
+		e.Errors = map[string]error{}
+	}
+	e.Errors[name] = err
+}
+
+// errOrNil returns nil if no file failed, so that we don't return a non-nil error interface
+func (e *BatchError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *BatchError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	messages := make([]string, len(names))
+	for i, name := range names {
+		messages[i] = fmt.Sprintf("%s: %s", name, e.Errors[name])
+	}
+	return fmt.Sprintf("%d files failed: %s", len(names), strings.Join(messages, "; "))
+}
+
 // Name returns the type of FS object this is: Fs.
 func (Fs) Name() string { return "s3" }
 
+// Region returns the region of the bucket, as configured in the session.
+func (fs *Fs) Region() string {
+	if fs.Session != nil {
+		return aws.StringValue(fs.Session.Config.Region)
+	}
+	if client, ok := fs.S3API.(*s3.S3); ok {
+		return aws.StringValue(client.Config.Region)
+	}
+	return ""
+}
+
+// BucketName returns the name of the bucket.
+func (fs *Fs) BucketName() string { return fs.Bucket }
+
 // Create a file.
 func (fs Fs) Create(name string) (afero.File, error) {
-	{ // It's faster to trigger an explicit empty put object than opening a file for write, closing it and re-opening it
-		req := &s3.PutObjectInput{
-			Bucket: aws.String(fs.Bucket),
-			Key:    aws.String(name),
-			Body:   bytes.NewReader([]byte{}),
-		}
+	name = fs.sanitize(name)
+	if isRoot(name) {
+		return nil, rootError("create", name)
+	}
+	if err := fs.checkBucket(); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	fs.invalidate(name)
 
-		if fs.FileProps != nil {
-			applyFileCreateProps(req, fs.FileProps)
+	found := false
+	if fs.CreateIfMissing || !fs.AllowFileOverDir {
+		var err error
+		if found, err = fs.exists(name); err != nil {
+			return nil, permissionError(err)
 		}
+	}
 
-		// If no Content-Type was specified, we'll guess one
-		if req.ContentType == nil {
-			req.ContentType = aws.String(mime.TypeByExtension(filepath.Ext(name)))
+	// Like os.Create, files can't replace directories. Their keys wouldn't collide, but they'd share their name. The
+	// directories are only looked up when there's no file with the name.
+	if !found && !fs.AllowFileOverDir {
+		if err := fs.checkNotDir(name); err != nil {
+			return nil, err
 		}
+	}
+	exists := found && fs.CreateIfMissing
 
-		_, errPut := fs.S3API.PutObject(req)
-		if errPut != nil {
-			return nil, errPut
+	// It's faster to trigger an explicit empty put object than opening a file for write, closing it and re-opening it
+	if !exists {
+		if _, err := fs.putObject(name, bytes.NewReader([]byte{})); err != nil {
+			return nil, permissionError(err)
 		}
 	}
 
@@ -91,19 +320,245 @@ func (fs Fs) Create(name string) (afero.File, error) {
 	if err != nil {
 		return file, err
 	}
+	if exists {
+		file.(*File).keepUnwritten = true
+	}
 
 	// Create(), like all of S3, is eventually consistent.
 	// To protect against unexpected behavior, have this method
 	// wait until S3 reports the object exists.
-	return file, fs.S3API.WaitUntilObjectExists(&s3.HeadObjectInput{
-		Bucket: aws.String(fs.Bucket),
-		Key:    aws.String(name),
+	return file, fs.S3API.WaitUntilObjectExistsWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+	}, request.WithWaiterRequestOptions(fs.requestOptions()...))
+}
+
+// checkNotDir checks that there's no directory with the name of a file being created. A missing bucket doesn't have
+// any, it's left to the write to report it, or to create it with AutoCreateBucket.
+func (fs Fs) checkNotDir(name string) error {
+	_, err := fs.statDirectory(name)
+	switch {
+	case err == nil:
+		return &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case errors.Is(err, os.ErrNotExist) && !isNoSuchBucket(err), isNoSuchBucket(err) && fs.AutoCreateBucket:
+		return nil
+	}
+
+	// statDirectory reports the name, with its own operation
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return &os.PathError{Op: "open", Path: name, Err: err}
+}
+
+// PutBytes writes a file with a single request, and returns the ETag of the new object.
+func (fs *Fs) PutBytes(name string, data []byte) (etag string, err error) {
+	name = fs.sanitize(name)
+	if isRoot(name) {
+		return "", rootError("put", name)
+	}
+	fs.invalidate(name)
+
+	out, err := fs.putObject(name, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.ETag), nil
+}
+
+// CompareAndSwap writes the content of a file only if its ETag is still expectedETag, and returns the ETag of the
+// new content. An empty expectedETag only writes the file if it doesn't exist. ErrConflict is returned when the file
+// changed. Backends supporting conditional writes check it atomically, the others only compare the ETag beforehand.
+func (fs *Fs) CompareAndSwap(name string, expectedETag string, data []byte) (newETag string, err error) {
+	name = fs.sanitize(name)
+	if isRoot(name) {
+		return "", rootError("put", name)
+	}
+	expectedETag = strings.Trim(expectedETag, "\"")
+
+	head, err := fs.S3API.HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+	}, fs.requestOptions()...)
+	switch {
+	case isNotFound(err):
+		if expectedETag != "" {
+			return "", ErrConflict
+		}
+	case err != nil:
+		return "", permissionError(err)
+	case expectedETag == "" || strings.Trim(aws.StringValue(head.ETag), "\"") != expectedETag:
+		return "", ErrConflict
+	}
+
+	fs.invalidate(name)
+	out, err := fs.putObject(name, bytes.NewReader(data), func(r *request.Request) {
+		if expectedETag == "" {
+			r.HTTPRequest.Header.Set("If-None-Match", "*")
+		} else {
+			r.HTTPRequest.Header.Set("If-Match", "\""+expectedETag+"\"")
+		}
 	})
+	if err != nil {
+		// A concurrent conditional write is reported with a 409
+		var errRequestFailure awserr.RequestFailure
+		if errors.As(err, &errRequestFailure) && (errRequestFailure.StatusCode() == http.StatusPreconditionFailed ||
+			errRequestFailure.StatusCode() == http.StatusConflict) {
+			return "", ErrConflict
+		}
+		return "", permissionError(err)
+	}
+	return aws.StringValue(out.ETag), nil
+}
+
+// UploadReaderAt writes a file from a ReaderAt of a given size. The parts are uploaded concurrently, and read
+// again from the ReaderAt when their upload is retried.
+func (fs *Fs) UploadReaderAt(name string, r io.ReaderAt, size int64) error {
+	name = fs.sanitize(name)
+	if isRoot(name) {
+		return rootError("upload", name)
+	}
+	fs.invalidate(name)
+
+	// A SectionReader is a ReadSeeker and a ReaderAt, which the uploader reads parts from without buffering them
+	return fs.upload(fs.uploadInput(name, io.NewSectionReader(r, 0, size)), fs.S3API)
+}
+
+// uploadInput prepares the upload of a file, applying the file properties
+func (fs Fs) uploadInput(name string, body io.Reader) *s3manager.UploadInput {
+	input := &s3manager.UploadInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+		Body:                 body,
+	}
+
+	if fs.FileProps != nil {
+		applyFileWriteProps(input, fs.FileProps)
+	}
+
+	// If no Content-Type was specified, we'll guess one
+	if input.ContentType == nil {
+		input.ContentType = aws.String(mime.TypeByExtension(filepath.Ext(name)))
+	}
+
+	return input
+}
+
+// upload writes a file with an uploader
+func (fs Fs) upload(input *s3manager.UploadInput, api s3iface.S3API, opts ...func(*s3manager.Uploader)) error {
+	api = fs.writeAPI(api)
+	var recorder *etagRecorder
+	if fs.VerifyMultipartETag {
+		recorder = newETagRecorder(api)
+		api = recorder
+	}
+
+	uploader := s3manager.NewUploaderWithClient(api, opts...)
+	uploader.RequestOptions = fs.uploadRequestOptions()
+
+	out, err := uploader.Upload(input)
+	if err != nil {
+		return permissionError(err)
+	}
+	if recorder != nil {
+		return recorder.verify(out)
+	}
+	return nil
 }
 
-// Mkdir makes a directory in S3.
+// PutSized writes a file from a reader of a known size with a single PutObject, which streams its content without
+// buffering it nor uploading it in parts. Files bigger than 5GB can't be written this way. The content of the readers
+// that can't seek is read only once and can't be signed, so it should be sent over HTTPS.
+func (fs *Fs) PutSized(name string, r io.Reader, size int64) error {
+	name = fs.sanitize(name)
+	if isRoot(name) {
+		return rootError("put", name)
+	}
+	if size < 0 {
+		return &os.PathError{Op: "put", Path: name, Err: os.ErrInvalid}
+	}
+	fs.invalidate(name)
+
+	opts := fs.uploadRequestOptions()
+	body, seekable := r.(io.ReadSeeker)
+	if !seekable {
+		body = aws.ReadSeekCloser(r)
+		opts = append(opts, unsignedPayload)
+	}
+
+	input := fs.putObjectInput(name, body)
+	input.ContentLength = aws.Int64(size)
+	_, err := fs.writeAPI(fs.S3API).PutObjectWithContext(aws.BackgroundContext(), input, opts...)
+	return permissionError(err)
+}
+
+// putObject writes a file with a single request, applying the file properties
+func (fs Fs) putObject(name string, body io.ReadSeeker, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	return fs.writeAPI(fs.S3API).PutObjectWithContext(
+		aws.BackgroundContext(), fs.putObjectInput(name, body), append(fs.uploadRequestOptions(), opts...)...,
+	)
+}
+
+// putObjectInput prepares the PutObject of a file, applying the file properties
+func (fs Fs) putObjectInput(name string, body io.ReadSeeker) *s3.PutObjectInput {
+	req := &s3.PutObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+		Body:                 body,
+	}
+
+	if fs.FileProps != nil {
+		applyFileCreateProps(req, fs.FileProps)
+	}
+
+	// If no Content-Type was specified, we'll guess one
+	if req.ContentType == nil {
+		req.ContentType = aws.String(mime.TypeByExtension(filepath.Ext(name)))
+	}
+
+	return req
+}
+
+// WaitForDeletion waits until S3 reports a removed file doesn't exist anymore, as deletions are eventually
+// consistent on some backends. It gives up with an error after the timeout.
+func (fs *Fs) WaitForDeletion(name string, timeout time.Duration) error {
+	if name = fs.sanitize(name); isRoot(name) {
+		return rootError("wait", name)
+	}
+
+	ctx, cancel := context.WithTimeout(aws.BackgroundContext(), timeout)
+	defer cancel()
+
+	return fs.S3API.WaitUntilObjectNotExistsWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+	}, request.WithWaiterRequestOptions(fs.requestOptions()...))
+}
+
+// Mkdir makes a directory in S3. Without directory markers it does nothing, as directories only exist through the
+// files they contain. The marker is created like a file, with the ACL of the file properties or the one derived from
+// the permissions with WithPermACL. The root always exists, it doesn't have any marker.
 func (fs Fs) Mkdir(name string, perm os.FileMode) error {
 	name = fs.sanitize(name)
+	if fs.DisableDirMarkers || isRoot(name) {
+		return nil
+	}
 	file, err := fs.OpenFile(fmt.Sprintf("%s/", path.Clean(name)), os.O_CREATE, perm)
 	if err == nil {
 		err = file.Close()
@@ -123,7 +578,7 @@ func (fs *Fs) Open(name string) (afero.File, error) {
 }
 
 // OpenFile opens a file.
-func (fs *Fs) OpenFile(name string, flag int, _ os.FileMode) (afero.File, error) {
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
 	name = fs.sanitize(name)
 	file := NewFile(fs, name)
 
@@ -148,61 +603,154 @@ func (fs *Fs) OpenFile(name string, flag int, _ os.FileMode) (afero.File, error)
 
 	// We either write
 	if flag&os.O_WRONLY != 0 {
+		if isRoot(name) {
+			return nil, rootError("open", name)
+		}
+		if err := fs.checkBucket(); err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		fs.invalidate(name)
+		if fs.PermACL && flag&os.O_CREATE != 0 && (fs.FileProps == nil || fs.FileProps.ACL == nil) {
+			file.acl = aws.String(permACL(perm))
+		}
 		return file, file.openWriteStream()
 	}
 
-	info, err := file.Stat()
-	if err != nil {
+	if err := file.openRead(); err != nil {
 		return nil, err
 	}
 
-	if info.IsDir() {
-		return file, nil
+	return file, nil
+}
+
+// OpenWithOptions opens a file for reading, the options only apply to the requests made for this file.
+func (fs *Fs) OpenWithOptions(name string, opts ...ReadOption) (afero.File, error) {
+	name = fs.sanitize(name)
+	file := NewFile(fs, name)
+
+	for _, opt := range opts {
+		opt(&file.readOptions)
 	}
 
-	return file, file.openReadStream(0)
+	if err := file.openRead(); err != nil {
+		return nil, err
+	}
+
+	return file, nil
 }
 
 // Remove a file
 func (fs Fs) Remove(name string) error {
 	name = fs.sanitize(name)
+	if isRoot(name) {
+		return rootError("remove", name)
+	}
 	if _, err := fs.Stat(name); err != nil {
 		return err
 	}
 	return fs.forceRemove(name)
 }
 
-// forceRemove doesn't error if a file does not exist.
+// forceRemove doesn't error if a file does not exist. With soft deletion, the file is moved to the trash instead,
+// unless it's already in it.
 func (fs Fs) forceRemove(name string) error {
-	_, err := fs.S3API.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(fs.Bucket),
-		Key:    aws.String(name),
-	})
-	return err
+	fs.invalidate(name)
+	if fs.TrashPrefix != "" && !fs.inTrash(name) {
+		return fs.moveToTrash(name)
+	}
+
+	_, err := fs.S3API.DeleteObjectWithContext(aws.BackgroundContext(), &s3.DeleteObjectInput{
+		Bucket:                    aws.String(fs.Bucket),
+		ExpectedBucketOwner:       fs.ExpectedBucketOwner,
+		Key:                       aws.String(fs.key(name)),
+		BypassGovernanceRetention: fs.bypassGovernanceRetention(),
+	}, fs.requestOptions()...)
+	return permissionError(err)
+}
+
+// moveToTrash moves a file to the trash, keeping its path
+func (fs Fs) moveToTrash(name string) error {
+	trashName := path.Join("/", fs.TrashPrefix, name)
+	if strings.HasSuffix(name, "/") {
+		trashName += "/"
+	}
+
+	fs.invalidate(trashName)
+	if err := fs.copy(name, trashName); err != nil {
+		return permissionError(err)
+	}
+
+	_, err := fs.S3API.DeleteObjectWithContext(aws.BackgroundContext(), &s3.DeleteObjectInput{
+		Bucket:                    aws.String(fs.Bucket),
+		ExpectedBucketOwner:       fs.ExpectedBucketOwner,
+		Key:                       aws.String(fs.key(name)),
+		BypassGovernanceRetention: fs.bypassGovernanceRetention(),
+	}, fs.requestOptions()...)
+	return permissionError(err)
 }
 
-// RemoveAll removes a path.
+// bypassGovernanceRetention returns the BypassGovernanceRetention of the removals
+func (fs Fs) bypassGovernanceRetention() *bool {
+	if !fs.BypassGovernance {
+		return nil
+	}
+	return aws.Bool(true)
+}
+
+// inTrash checks if a file is in the trash, or is the trash itself
+func (fs Fs) inTrash(name string) bool {
+	trash := "/" + strings.Trim(fs.TrashPrefix, "/")
+	name = "/" + strings.Trim(name, "/")
+	return name == trash || strings.HasPrefix(name, trash+"/")
+}
+
+// keptInTrash checks if a file is kept when removing the files under a prefix: with soft deletion, the trash is only
+// emptied when the prefix is in it
+func (fs Fs) keptInTrash(prefix, name string) bool {
+	return fs.TrashPrefix != "" && fs.inTrash(name) && !fs.inTrash(prefix)
+}
+
+// errRemoveRoot is returned when RemoveAll is given the root, which can only be emptied with Purge
+var errRemoveRoot = fmt.Errorf("%w: the root can only be emptied with Purge", os.ErrInvalid)
+
+// RemoveAll removes a path. Like os.RemoveAll, it succeeds if the path doesn't exist. The root is rejected, as
+// removing it is more likely to be a mistake: all the files of the bucket, or of the prefix, can be removed with
+// Purge. With soft deletion, the trash is only emptied when it's explicitly removed.
 func (fs *Fs) RemoveAll(name string) error {
 	name = fs.sanitize(name)
+	if isRoot(name) {
+		return &os.PathError{Op: "removeall", Path: name, Err: errRemoveRoot}
+	}
 	s3dir := NewFile(fs, name)
 	fis, err := s3dir.Readdir(0)
 	if err != nil {
+		// Some servers report the prefixes without any object as missing
+		if isNotFound(err) {
+			return nil
+		}
 		return err
 	}
 	for _, fi := range fis {
 		fullpath := path.Join(s3dir.Name(), fi.Name())
+		if fs.keptInTrash(name, fullpath) {
+			continue
+		}
 		if fi.IsDir() {
+			// Keys with empty path segments, like "dir//", can be listed as the directory itself
+			if fullpath == path.Clean(name) {
+				continue
+			}
 			if err := fs.RemoveAll(fullpath); err != nil {
 				return err
 			}
 		} else {
-			if err := fs.forceRemove(fullpath); err != nil {
+			if err := fs.forceRemove(fullpath); err != nil && !isNotFound(err) {
 				return err
 			}
 		}
 	}
-	// finally remove the "file" representing the directory
-	if err := fs.forceRemove(s3dir.Name() + "/"); err != nil {
+	// finally remove the "file" representing the directory, some servers fail to delete missing objects
+	if err := fs.forceRemove(s3dir.Name() + "/"); err != nil && !isNotFound(err) {
 		return err
 	}
 	return nil
@@ -213,35 +761,171 @@ func (fs *Fs) RemoveAll(name string) error {
 // will copy the file to an object with the new name and then delete
 // the original.
 func (fs Fs) Rename(oldname, newname string) error {
-	oldname = fs.sanitize(newname)
-	newname = fs.sanitize(oldname)
+	oldname = fs.sanitize(oldname)
+	newname = fs.sanitize(newname)
+	if isRoot(oldname) || isRoot(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrInvalid}
+	}
 
 	if oldname == newname {
 		return nil
 	}
-	_, err := fs.S3API.CopyObject(&s3.CopyObjectInput{
-		Bucket:     aws.String(fs.Bucket),
-		CopySource: aws.String(fs.Bucket + oldname),
-		Key:        aws.String(newname),
-	})
+	return fs.move(oldname, newname)
+}
+
+// Move a file, like Rename. If overwrite is false and the destination already exists, an error wrapping
+// os.ErrExist is returned.
+func (fs *Fs) Move(src, dst string, overwrite bool) error {
+	src = fs.sanitize(src)
+	dst = fs.sanitize(dst)
+	if isRoot(src) || isRoot(dst) {
+		return &os.LinkError{Op: "move", Old: src, New: dst, Err: os.ErrInvalid}
+	}
+
+	if src == dst {
+		return nil
+	}
+
+	if !overwrite {
+		exists, err := fs.exists(dst)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return &os.LinkError{Op: "move", Old: src, New: dst, Err: os.ErrExist}
+		}
+	}
+
+	return fs.move(src, dst)
+}
+
+// Copy a file server-side.
+func (fs *Fs) Copy(src, dst string) error {
+	src = fs.sanitize(src)
+	dst = fs.sanitize(dst)
+	if isRoot(src) || isRoot(dst) {
+		return &os.LinkError{Op: "copy", Old: src, New: dst, Err: os.ErrInvalid}
+	}
+
+	if src == dst {
+		return nil
+	}
+	fs.invalidate(dst)
+	return fs.copy(src, dst)
+}
+
+// exists checks if a file exists, without considering directories
+func (fs Fs) exists(name string) (bool, error) {
+	_, err := fs.S3API.HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+	}, fs.requestOptions()...)
+	if err == nil {
+		return true, nil
+	}
+	if isNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// copy a file, with a multipart copy if it's too big for a single CopyObject.
+func (fs Fs) copy(src, dst string) error {
+	head, err := fs.S3API.HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(src)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+	}, fs.requestOptions()...)
 	if err != nil {
 		return err
 	}
-	_, err = fs.S3API.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(fs.Bucket),
-		Key:    aws.String(oldname),
-	})
+	return copyObject(&fs, fs.key(src), &fs, fs.key(dst), aws.Int64Value(head.ContentLength), head.StorageClass)
+}
+
+// move copies a file to its new name and then deletes the original.
+func (fs Fs) move(src, dst string) error {
+	fs.invalidate(src)
+	fs.invalidate(dst)
+	if err := fs.copy(src, dst); err != nil {
+		return err
+	}
+	if err := fs.ensureDirMarker(path.Dir(dst)); err != nil {
+		return err
+	}
+	_, err := fs.S3API.DeleteObjectWithContext(aws.BackgroundContext(), &s3.DeleteObjectInput{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+		Key:                 aws.String(fs.key(src)),
+	}, fs.requestOptions()...)
+	return err
+}
+
+// ensureDirMarker creates the marker of a directory if it doesn't exist, so that it's immediately listed as such.
+// It has the ACL of the file properties, there are no permissions to derive one from. The root and the directories of
+// the trash, which isn't browsed like the other directories, don't get any.
+func (fs Fs) ensureDirMarker(dir string) error {
+	if fs.DisableDirMarkers || isRoot(dir) || (fs.TrashPrefix != "" && fs.inTrash(dir)) {
+		return nil
+	}
+
+	marker := strings.TrimSuffix(dir, "/") + "/"
+	exists, err := fs.exists(marker)
+	if err != nil || exists {
+		return err
+	}
+
+	fs.invalidate(dir)
+	_, err = fs.putObject(marker, bytes.NewReader([]byte{}))
 	return err
 }
 
 // Stat returns a FileInfo describing the named file.
 // If there is an error, it will be of type *os.PathError.
 func (fs Fs) Stat(name string) (os.FileInfo, error) {
-	name = fs.sanitize(name)
-	out, err := fs.S3API.HeadObject(&s3.HeadObjectInput{
-		Bucket: aws.String(fs.Bucket),
-		Key:    aws.String(name),
-	})
+	return fs.stat(fs.sanitize(name), &readOptions{})
+}
+
+// Size returns the size of a file with a single HeadObject, without looking directories up like Stat does
+func (fs *Fs) Size(name string) (int64, error) {
+	if name = fs.sanitize(name); isRoot(name) {
+		return 0, rootError("size", name)
+	}
+
+	head, err := fs.headObject(name)
+	if isNotFound(err) {
+		return 0, &os.PathError{Op: "size", Path: name, Err: os.ErrNotExist}
+	} else if err != nil {
+		return 0, &os.PathError{Op: "size", Path: name, Err: permissionError(err)}
+	}
+	return aws.Int64Value(head.ContentLength), nil
+}
+
+func (fs Fs) stat(name string, opts *readOptions) (os.FileInfo, error) {
+	// The root always exists, even when the bucket is empty
+	if isRoot(name) {
+		return fs.newFileInfo("/", true, 0, fs.now()), nil
+	}
+	if info, ok := fs.statCache.get(name); ok {
+		return info, nil
+	}
+	if entry, ok := fs.writeCache.get(name); ok {
+		return fs.withPerms(entry.info), nil
+	}
+
+	req := &s3.HeadObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+	}
+	opts.applyHeadObject(req)
+	out, err := fs.S3API.HeadObjectWithContext(aws.BackgroundContext(), req, fs.requestOptions()...)
 	if err != nil {
 		var errRequestFailure awserr.RequestFailure
 		if errors.As(err, &errRequestFailure) {
@@ -249,38 +933,81 @@ func (fs Fs) Stat(name string) (os.FileInfo, error) {
 				statDir, errStat := fs.statDirectory(name)
 				return statDir, errStat
 			}
+			if errRequestFailure.StatusCode() == http.StatusForbidden && fs.HeadObjectFallback {
+				return fs.statWithGet(name, opts)
+			}
 		}
 		return FileInfo{}, &os.PathError{
 			Op:   "stat",
 			Path: name,
-			Err:  err,
+			Err:  permissionError(err),
 		}
 	} else if strings.HasSuffix(name, "/") {
-		// user asked for a directory, but this is a file
-		return FileInfo{name: name}, nil
-		/*
-			return FileInfo{}, &os.PathError{
-				Op:   "stat",
-				Path: name,
-				Err:  os.ErrNotExist,
-			}
-		*/
+		// user asked for a directory, and this is its marker
+		return fs.newFileInfo(path.Base(name), true, 0, *out.LastModified), nil
 	}
-	return NewFileInfo(path.Base(name), false, *out.ContentLength, *out.LastModified), nil
+	// Some backends omit the length of empty files
+	info := fs.newFileInfo(path.Base(name), false, aws.Int64Value(out.ContentLength), *out.LastModified)
+	info.versionID = aws.StringValue(out.VersionId)
+	return info, nil
+}
+
+// statWithGet looks a file up with a GetObject of its first byte, for the buckets whose policy denies HeadObject
+// but allows GetObject
+func (fs Fs) statWithGet(name string, opts *readOptions) (os.FileInfo, error) {
+	req := &s3.GetObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+		Range:                aws.String("bytes=0-0"),
+	}
+	opts.applyGetObject(req)
+	out, err := fs.S3API.GetObjectWithContext(aws.BackgroundContext(), req, fs.requestOptions()...)
+	if isInvalidRange(err) {
+		// Empty files don't have any byte, their modification time is only returned without range
+		req.Range = nil
+		out, err = fs.S3API.GetObjectWithContext(aws.BackgroundContext(), req, fs.requestOptions()...)
+	}
+	switch {
+	case isNotFound(err):
+		return fs.statDirectory(name)
+	case err != nil:
+		return FileInfo{}, &os.PathError{Op: "stat", Path: name, Err: permissionError(err)}
+	}
+	_ = out.Body.Close()
+
+	if strings.HasSuffix(name, "/") {
+		return fs.newFileInfo(path.Base(name), true, 0, aws.TimeValue(out.LastModified)), nil
+	}
+	size := aws.Int64Value(out.ContentLength)
+	if req.Range != nil {
+		size = contentRangeSize(out, 0)
+	}
+	info := fs.newFileInfo(path.Base(name), false, size, aws.TimeValue(out.LastModified))
+	info.versionID = aws.StringValue(out.VersionId)
+	return info, nil
 }
 
 func (fs Fs) statDirectory(name string) (os.FileInfo, error) {
 	nameClean := path.Clean(name)
-	out, err := fs.S3API.ListObjectsV2(&s3.ListObjectsV2Input{
-		Bucket:  aws.String(fs.Bucket),
-		Prefix:  aws.String(strings.TrimPrefix(nameClean, "/")),
-		MaxKeys: aws.Int64(1),
+	// Only the keys inside the directory matter, an empty file or a file sharing its name as a prefix isn't one
+	prefix := strings.TrimPrefix(fs.key(nameClean), "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	out, err := fs.listObjects(&s3.ListObjectsV2Input{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+		Prefix:              aws.String(prefix),
+		MaxKeys:             aws.Int64(1),
 	})
 	if err != nil {
 		return FileInfo{}, &os.PathError{
 			Op:   "stat",
 			Path: name,
-			Err:  err,
+			Err:  permissionError(err),
 		}
 	}
 	if *out.KeyCount == 0 && name != "" {
@@ -290,32 +1017,42 @@ func (fs Fs) statDirectory(name string) (os.FileInfo, error) {
 			Err:  os.ErrNotExist,
 		}
 	}
-	return NewFileInfo(path.Base(name), true, 0, time.Unix(0, 0)), nil
+	return fs.newFileInfo(path.Base(name), true, 0, fs.now()), nil
 }
 
 // Chmod doesn't exists in S3 but could be implemented by analyzing ACLs
 func (fs Fs) Chmod(name string, mode os.FileMode) error {
 	name = fs.sanitize(name)
-	var acl string
+	if isRoot(name) {
+		return rootError("chmod", name)
+	}
+	return fs.putACL(name, permACL(mode))
+}
+
+// putACL sets the canned ACL of a file
+func (fs Fs) putACL(name, acl string) error {
+	_, err := fs.S3API.PutObjectAclWithContext(aws.BackgroundContext(), &s3.PutObjectAclInput{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+		Key:                 aws.String(fs.key(name)),
+		ACL:                 aws.String(acl),
+	}, fs.requestOptions()...)
+	return err
+}
 
+// permACL returns the canned ACL matching the permissions of others in a mode
+func permACL(mode os.FileMode) string {
 	otherRead := mode&(1<<2) != 0
 	otherWrite := mode&(1<<1) != 0
 
 	switch {
 	case otherRead && otherWrite:
-		acl = "public-read-write"
+		return "public-read-write"
 	case otherRead:
-		acl = "public-read"
+		return "public-read"
 	default:
-		acl = "private"
+		return "private"
 	}
-
-	_, err := fs.S3API.PutObjectAcl(&s3.PutObjectAclInput{
-		Bucket: aws.String(fs.Bucket),
-		Key:    aws.String(name),
-		ACL:    aws.String(acl),
-	})
-	return err
 }
 
 // Chown doesn't exist in S3 should probably NOT have been added to afero as it's POSIX-only concept.
@@ -329,6 +1066,90 @@ func (Fs) Chtimes(string, time.Time, time.Time) error {
 	return ErrNotSupported
 }
 
+// key returns the S3 key of a file, scoped to the Prefix if there's one.
+func (fs Fs) key(name string) string {
+	name = fs.encodeKey(name)
+	if fs.Prefix == "" {
+		return name
+	}
+	return strings.TrimSuffix(fs.Prefix, "/") + "/" + strings.TrimPrefix(name, "/")
+}
+
+// keyName returns the name of a file from its S3 key, it's the opposite of key.
+func (fs Fs) keyName(key string) string {
+	if fs.Prefix == "" {
+		return fs.decodeKey(key)
+	}
+	return fs.decodeKey(strings.TrimPrefix(key, strings.TrimSuffix(fs.Prefix, "/")+"/"))
+}
+
+// sseCustomerAlgorithm returns the algorithm of the SSE-C key, if any
+func (fs Fs) sseCustomerAlgorithm() *string {
+	if fs.SSECustomerKey == "" {
+		return nil
+	}
+	return aws.String(s3.ServerSideEncryptionAes256)
+}
+
+// sseCustomerKey returns the SSE-C key, if any. The client computes its MD5 and encodes it.
+func (fs Fs) sseCustomerKey() *string {
+	if fs.SSECustomerKey == "" {
+		return nil
+	}
+	return aws.String(fs.SSECustomerKey)
+}
+
+// invalidate drops the cached information about a file that changed
+func (fs Fs) invalidate(name string) {
+	fs.statCache.invalidate(name)
+	fs.writeCache.invalidate(name)
+}
+
+// requestOptions returns the options applied to all the requests we make.
+func (fs Fs) requestOptions() []request.Option {
+	opts := []request.Option{regionHint}
+
+	if fs.Retryer != nil {
+		retryer := fs.Retryer
+		opts = append(opts, func(r *request.Request) {
+			r.Retryer = retryer
+		})
+	}
+
+	if fs.RequestTimeout > 0 {
+		timeout := fs.RequestTimeout
+		opts = append(opts, func(r *request.Request) {
+			// The timeout only covers the time it takes to get a response, reading its body (like the content of a
+			// file) can take much longer.
+			ctx, cancel := context.WithCancel(r.Context())
+			timer := time.AfterFunc(timeout, cancel)
+			r.SetContext(ctx)
+			r.Handlers.Send.PushBack(func(*request.Request) {
+				timer.Stop()
+			})
+		})
+	}
+
+	return opts
+}
+
+// uploadRequestOptions returns the options applied to the requests sending the content of files
+func (fs Fs) uploadRequestOptions() []request.Option {
+	opts := fs.requestOptions()
+
+	if fs.UnsignedPayload {
+		opts = append(opts, unsignedPayload)
+	}
+
+	return opts
+}
+
+// unsignedPayload sends the content of an upload without signing it
+func unsignedPayload(r *request.Request) {
+	// The signer uses the hash set in this header instead of hashing the body
+	r.HTTPRequest.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+}
+
 // sanitize name if not in RawMode.
 func (fs Fs) sanitize(name string) string {
 	if fs.RawMode {
@@ -337,7 +1158,7 @@ func (fs Fs) sanitize(name string) string {
 	return sanitize(name)
 }
 
-// I couldn't find a way to make this code cleaner. It's basically a big copy-paste on two
+// I couldn't find a way to make this code cleaner. It's basically a big copy-paste on three
 // very similar structures.
 func applyFileCreateProps(req *s3.PutObjectInput, p *UploadedFileProperties) {
 	if p.ACL != nil {
@@ -355,6 +1176,30 @@ func applyFileCreateProps(req *s3.PutObjectInput, p *UploadedFileProperties) {
 	if p.ContentEncoding != nil {
 		req.ContentEncoding = p.ContentEncoding
 	}
+
+	if p.BucketKeyEnabled != nil {
+		req.BucketKeyEnabled = p.BucketKeyEnabled
+	}
+
+	if p.GrantRead != nil {
+		req.GrantRead = p.GrantRead
+	}
+
+	if p.GrantReadACP != nil {
+		req.GrantReadACP = p.GrantReadACP
+	}
+
+	if p.GrantWriteACP != nil {
+		req.GrantWriteACP = p.GrantWriteACP
+	}
+
+	if p.GrantFullControl != nil {
+		req.GrantFullControl = p.GrantFullControl
+	}
+
+	if p.Tagging != nil {
+		req.Tagging = p.Tagging
+	}
 }
 
 func applyFileWriteProps(req *s3manager.UploadInput, p *UploadedFileProperties) {
@@ -373,13 +1218,81 @@ func applyFileWriteProps(req *s3manager.UploadInput, p *UploadedFileProperties)
 	if p.ContentEncoding != nil {
 		req.ContentEncoding = p.ContentEncoding
 	}
+
+	if p.BucketKeyEnabled != nil {
+		req.BucketKeyEnabled = p.BucketKeyEnabled
+	}
+
+	if p.GrantRead != nil {
+		req.GrantRead = p.GrantRead
+	}
+
+	if p.GrantReadACP != nil {
+		req.GrantReadACP = p.GrantReadACP
+	}
+
+	if p.GrantWriteACP != nil {
+		req.GrantWriteACP = p.GrantWriteACP
+	}
+
+	if p.GrantFullControl != nil {
+		req.GrantFullControl = p.GrantFullControl
+	}
+
+	if p.Tagging != nil {
+		req.Tagging = p.Tagging
+	}
+}
+
+func applyFileCopyProps(req *s3.CopyObjectInput, p *UploadedFileProperties) {
+	if p.ACL != nil {
+		req.ACL = p.ACL
+	}
+
+	if p.CacheControl != nil {
+		req.CacheControl = p.CacheControl
+	}
+
+	if p.ContentType != nil {
+		req.ContentType = p.ContentType
+	}
+
+	if p.ContentEncoding != nil {
+		req.ContentEncoding = p.ContentEncoding
+	}
+
+	if p.BucketKeyEnabled != nil {
+		req.BucketKeyEnabled = p.BucketKeyEnabled
+	}
+
+	if p.GrantRead != nil {
+		req.GrantRead = p.GrantRead
+	}
+
+	if p.GrantReadACP != nil {
+		req.GrantReadACP = p.GrantReadACP
+	}
+
+	if p.GrantWriteACP != nil {
+		req.GrantWriteACP = p.GrantWriteACP
+	}
+
+	if p.GrantFullControl != nil {
+		req.GrantFullControl = p.GrantFullControl
+	}
+
+	// The tags are copied unless they are explicitly replaced
+	if p.Tagging != nil {
+		req.Tagging = p.Tagging
+		req.TaggingDirective = aws.String(s3.TaggingDirectiveReplace)
+	}
 }
 
 // volumePrefixRegex matches the windows volume identifier eg "C:".
 var volumePrefixRegex = regexp.MustCompile(`^[[:alpha:]]:`)
 
 // sanitize name to ensure it uses forward slash paths even on Windows
-// systems.
+// systems. Spaces and unicode characters are kept as they are, without any normalization.
 func sanitize(name string) string {
 	if strings.TrimSpace(name) == "" {
 		return name
@@ -387,8 +1300,16 @@ func sanitize(name string) string {
 	name = volumePrefixRegex.ReplaceAllString(name, "")
 	name = strings.ReplaceAll(name, "\\", "/")
 	hasTrailingSlash := strings.HasSuffix(name, "/")
-	name = path.Clean(name)
-	if hasTrailingSlash {
+	isRooted := strings.HasPrefix(name, "/")
+	// Cleaning a rooted path clamps the ".." to the root, so that keys never escape the bucket (or the prefix)
+	name = path.Clean("/" + name)
+	if !isRooted {
+		name = strings.TrimPrefix(name, "/")
+		if name == "" {
+			name = "."
+		}
+	}
+	if hasTrailingSlash && !strings.HasSuffix(name, "/") {
 		name += "/"
 	}
 	return name
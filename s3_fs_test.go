@@ -0,0 +1,1537 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMove(t *testing.T) {
+	req := require.New(t)
+
+	t.Run("NoOverwrite", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		mock.putObject("bucket", "src", []byte("src"), time.Now())
+		mock.putObject("bucket", "dst", []byte("dst"), time.Now())
+
+		err := fs.Move("src", "dst", false)
+		req.ErrorIs(err, os.ErrExist)
+		req.Equal("src", string(mock.getObject("bucket", "src").body))
+		req.Equal("dst", string(mock.getObject("bucket", "dst").body))
+		req.Zero(mock.count("CopyObject"))
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		mock.putObject("bucket", "src", []byte("src"), time.Now())
+		mock.putObject("bucket", "dst", []byte("dst"), time.Now())
+
+		req.NoError(fs.Move("src", "dst", true))
+		req.Nil(mock.getObject("bucket", "src"))
+		req.Equal("src", string(mock.getObject("bucket", "dst").body))
+		// Only the source is checked, to get its size
+		req.Equal(1, mock.count("HeadObject"))
+		req.Equal("src", aws.StringValue(mock.lastInput("HeadObject").(*s3.HeadObjectInput).Key))
+	})
+
+	t.Run("NoOverwriteMissingDestination", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		mock.putObject("bucket", "dir/src", []byte("src"), time.Now())
+
+		req.NoError(fs.Move("/dir/src", "/dir/dst", false))
+		req.Nil(mock.getObject("bucket", "dir/src"))
+		req.Equal("src", string(mock.getObject("bucket", "dir/dst").body))
+		req.Equal("bucket/dir/src", *mock.lastInput("CopyObject").(*s3.CopyObjectInput).CopySource)
+	})
+}
+
+func TestRenameMock(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "dir/file1", []byte("content"), time.Now())
+
+	req.NoError(fs.Rename("/dir/file1", "/dir/file2"))
+	req.Nil(mock.getObject("bucket", "dir/file1"))
+	req.Equal("content", string(mock.getObject("bucket", "dir/file2").body))
+	req.Equal("/dir/file2", aws.StringValue(mock.lastInput("CopyObject").(*s3.CopyObjectInput).Key))
+}
+
+func TestRenameIntoNewDir(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "file", []byte("content"), time.Now())
+
+	req.NoError(fs.Rename("/file", "/new/folder/file"))
+	req.NotNil(mock.getObject("bucket", "new/folder/"))
+	req.Equal("content", string(mock.getObject("bucket", "new/folder/file").body))
+
+	info, err := fs.Stat("/new/folder")
+	req.NoError(err)
+	req.True(info.IsDir())
+
+	// The marker is only created once
+	mock.resetCalls()
+	req.NoError(fs.Move("/new/folder/file", "/new/folder/other", true))
+	req.Zero(mock.count("PutObject"))
+}
+
+func TestDirMarkers(t *testing.T) {
+	req := require.New(t)
+
+	for _, tc := range []struct {
+		name    string
+		opts    []Option
+		markers bool
+	}{
+		{"Markers", nil, true},
+		{"NoMarkers", []Option{WithoutDirMarkers()}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, mock := newMockFs(t, tc.opts...)
+
+			req.NoError(fs.MkdirAll("/dir", 0o755))
+			req.Equal(tc.markers, mock.getObject("bucket", "dir/") != nil)
+
+			testCreateFile(t, fs, "/file", "content")
+			req.NoError(fs.Rename("/file", "/dir/sub/file"))
+			req.Equal(tc.markers, mock.getObject("bucket", "dir/sub/") != nil)
+
+			// The directories are detected from the files they contain
+			for _, dir := range []string{"/dir", "/dir/sub"} {
+				info, err := fs.Stat(dir)
+				req.NoError(err)
+				req.True(info.IsDir())
+			}
+
+			dir, err := fs.Open("/dir")
+			req.NoError(err)
+			fis, err := dir.Readdir(-1)
+			req.NoError(err)
+			req.Len(fis, 1)
+			req.Equal("sub", fis[0].Name())
+			req.True(fis[0].IsDir())
+		})
+	}
+
+	t.Run("EmptyDir", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithoutDirMarkers())
+		req.NoError(fs.Mkdir("/empty", 0o755))
+		req.Empty(mock.calls)
+		_, err := fs.Stat("/empty")
+		req.ErrorIs(err, os.ErrNotExist)
+	})
+
+	t.Run("ZeroValue", func(t *testing.T) {
+		mock := newMockS3()
+		fs := &Fs{Bucket: "bucket", S3API: mock}
+		req.NoError(fs.Mkdir("/dir", 0o755))
+		req.NotNil(mock.getObject("bucket", "dir/"))
+	})
+
+	t.Run("RootAndTrash", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithSoftDelete(".trash"))
+		testCreateFile(t, fs, "/file", "content")
+
+		mock.resetCalls()
+		req.NoError(fs.Rename("/file", "moved"))
+		req.Zero(mock.count("PutObject"))
+
+		req.NoError(fs.Rename("/moved", "/.trash/sub/moved"))
+		req.Zero(mock.count("PutObject"))
+		req.Nil(mock.getObject("bucket", ".trash/sub/"))
+		req.NotNil(mock.getObject("bucket", ".trash/sub/moved"))
+	})
+}
+
+func TestDirMarkerACL(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithFileProps(&UploadedFileProperties{ACL: aws.String("public-read")}))
+
+	req.NoError(fs.Mkdir("/public", 0o700))
+	req.Equal("public-read", aws.StringValue(mock.getObject("bucket", "public/").acl))
+
+	// The markers created when renaming files into new directories have it too
+	testCreateFile(t, fs, "/file", "content")
+	req.NoError(fs.Rename("/file", "/public/sub/file"))
+	req.Equal("public-read", aws.StringValue(mock.getObject("bucket", "public/sub/").acl))
+}
+
+func TestStatEmptyFile(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	testCreateFile(t, fs, "/empty", "")
+	info, err := fs.Stat("/empty")
+	req.NoError(err)
+	req.False(info.IsDir())
+	req.Equal(int64(0), info.Size())
+
+	// A file that isn't found yet isn't mistaken for a directory, even if its key is listed
+	mock.putObject("bucket", "empty-too", []byte{}, time.Now())
+	mock.hook = func(op string, input interface{}) error {
+		if op == "HeadObject" {
+			return mockNotFound("NotFound")
+		}
+		return nil
+	}
+	_, err = fs.Stat("/empty")
+	req.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestStatModTimeUTC(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	lastModified := time.Date(2021, 6, 1, 12, 30, 15, 500, time.FixedZone("UTC+5", 5*3600))
+	mock.putObject("bucket", "file", []byte("content"), lastModified)
+
+	info, err := fs.Stat("file")
+	req.NoError(err)
+	req.Equal(time.UTC, info.ModTime().Location())
+	req.True(info.ModTime().Equal(lastModified))
+}
+
+func TestFilePropsBucketKeyEnabled(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithFileProps(&UploadedFileProperties{BucketKeyEnabled: aws.Bool(true)}))
+
+	file, err := fs.Create("create")
+	req.NoError(err)
+	req.NoError(file.Close())
+	req.True(aws.BoolValue(mock.lastInput("PutObject").(*s3.PutObjectInput).BucketKeyEnabled))
+
+	mock.resetCalls()
+	testCreateFile(t, fs, "write", "content")
+	req.True(aws.BoolValue(mock.lastInput("PutObject").(*s3.PutObjectInput).BucketKeyEnabled))
+}
+
+func TestFilePropsGrants(t *testing.T) {
+	req := require.New(t)
+	grantee := "id=79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be"
+	fs, mock := newMockFs(t, WithFileProps(&UploadedFileProperties{
+		GrantRead:        aws.String(grantee),
+		GrantFullControl: aws.String(grantee),
+	}))
+
+	_, err := fs.Create("create")
+	req.NoError(err)
+	input := mock.lastInput("PutObject").(*s3.PutObjectInput)
+	req.Equal(grantee, aws.StringValue(input.GrantRead))
+	req.Equal(grantee, aws.StringValue(input.GrantFullControl))
+	req.Nil(input.GrantReadACP)
+	req.Nil(input.GrantWriteACP)
+
+	mock.resetCalls()
+	testCreateFile(t, fs, "write", "content")
+	req.Equal(grantee, aws.StringValue(mock.lastInput("PutObject").(*s3.PutObjectInput).GrantRead))
+}
+
+func TestRegionAndBucketName(t *testing.T) {
+	req := require.New(t)
+
+	sess, err := session.NewSession(&aws.Config{Region: aws.String("eu-west-3")})
+	req.NoError(err)
+
+	fs := NewFs("my-bucket", sess)
+	req.Equal("eu-west-3", fs.Region())
+	req.Equal("my-bucket", fs.BucketName())
+
+	fs = NewFsWithOptions("other-bucket", nil, WithS3API(s3.New(sess)))
+	req.Equal("eu-west-3", fs.Region())
+	req.Equal("other-bucket", fs.BucketName())
+
+	fs, _ = newMockFs(t)
+	req.Empty(fs.Region())
+}
+
+func TestDottedBucketPathStyle(t *testing.T) {
+	req := require.New(t)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+		Endpoint:    aws.String("http://localhost:9000"),
+		Region:      aws.String("eu-west-1"),
+	})
+	req.NoError(err)
+
+	objectURL := func(fs *Fs) string {
+		input := &s3.GetObjectInput{Bucket: aws.String(fs.Bucket), Key: aws.String("file")}
+		r, _ := fs.S3API.(*s3.S3).GetObjectRequest(input)
+		req.NoError(r.Build())
+		return r.HTTPRequest.URL.String()
+	}
+
+	// Dotted buckets are addressed path-style
+	fs := NewFs("my.bucket", sess)
+	req.True(aws.BoolValue(fs.S3API.(*s3.S3).Config.S3ForcePathStyle))
+	req.Equal("http://localhost:9000/my.bucket/file", objectURL(fs))
+	fs = NewFsWithOptions("my.bucket", sess)
+	req.Equal("http://localhost:9000/my.bucket/file", objectURL(fs))
+
+	// Others are left virtual-hosted-style
+	fs = NewFs("my-bucket", sess)
+	req.Nil(fs.S3API.(*s3.S3).Config.S3ForcePathStyle)
+	req.Equal("http://my-bucket.localhost:9000/file", objectURL(fs))
+
+	// The configuration of the session is kept
+	fs = NewFs("my.bucket", sess.Copy(&aws.Config{S3ForcePathStyle: aws.Bool(false)}))
+	req.False(aws.BoolValue(fs.S3API.(*s3.S3).Config.S3ForcePathStyle))
+}
+
+func TestExpectedBucketOwner(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithExpectedBucketOwner("111122223333"))
+
+	testCreateFile(t, fs, "/dir/file", "content")
+	req.Equal("111122223333", aws.StringValue(mock.lastInput("PutObject").(*s3.PutObjectInput).ExpectedBucketOwner))
+
+	_, err := fs.Stat("/dir/file")
+	req.NoError(err)
+	req.Equal("111122223333", aws.StringValue(mock.lastInput("HeadObject").(*s3.HeadObjectInput).ExpectedBucketOwner))
+
+	file, err := fs.Open("/dir/file")
+	req.NoError(err)
+	_, err = io.ReadAll(file)
+	req.NoError(err)
+	req.NoError(file.Close())
+	req.Equal("111122223333", aws.StringValue(mock.lastInput("GetObject").(*s3.GetObjectInput).ExpectedBucketOwner))
+
+	req.NoError(fs.Rename("/dir/file", "/dir/renamed"))
+	copyInput := mock.lastInput("CopyObject").(*s3.CopyObjectInput)
+	req.Equal("111122223333", aws.StringValue(copyInput.ExpectedBucketOwner))
+	req.Equal("111122223333", aws.StringValue(copyInput.ExpectedSourceBucketOwner))
+	req.Equal("111122223333", aws.StringValue(mock.lastInput("DeleteObject").(*s3.DeleteObjectInput).ExpectedBucketOwner))
+
+	_, err = fs.Stat("/dir")
+	req.NoError(err)
+	req.Equal("111122223333", aws.StringValue(mock.lastInput("ListObjectsV2").(*s3.ListObjectsV2Input).ExpectedBucketOwner))
+}
+
+func TestWaitForDeletion(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "file", []byte("content"), time.Now())
+
+	// The object is still reported twice after being deleted
+	heads := 0
+	mock.hook = func(op string, input interface{}) error {
+		if op == "HeadObject" {
+			heads++
+			if heads == 3 {
+				delete(mock.bucket(aws.String("bucket")), "file")
+			}
+		}
+		return nil
+	}
+
+	req.NoError(fs.WaitForDeletion("/file", time.Second))
+	req.Equal(3, mock.count("HeadObject"))
+
+	t.Run("Timeout", func(t *testing.T) {
+		mock.hook = nil
+		mock.putObject("bucket", "other", []byte("content"), time.Now())
+		req.Error(fs.WaitForDeletion("/other", 0))
+	})
+}
+
+func TestFilePropsTagging(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithFileProps(&UploadedFileProperties{
+		Tagging: aws.String("retention=short&team=data"),
+	}))
+
+	t.Run("SinglePart", func(t *testing.T) {
+		_, err := fs.Create("create")
+		req.NoError(err)
+		req.Equal("retention=short&team=data", aws.StringValue(mock.getObject("bucket", "create").tagging))
+
+		testCreateFile(t, fs, "write", "content")
+		req.Equal("retention=short&team=data", aws.StringValue(mock.getObject("bucket", "write").tagging))
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		testCreateFile(t, fs, "big", strings.Repeat("a", 6*1024*1024))
+		input := mock.lastInput("CreateMultipartUpload").(*s3.CreateMultipartUploadInput)
+		req.Equal("retention=short&team=data", aws.StringValue(input.Tagging))
+		req.Equal("retention=short&team=data", aws.StringValue(mock.getObject("bucket", "big").tagging))
+	})
+
+	req.Zero(mock.count("PutObjectTagging"))
+}
+
+func TestCreateIfMissing(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithCreateIfMissing())
+
+	file, err := fs.Create("/file")
+	req.NoError(err)
+	req.NoError(file.Close())
+	req.Equal(2, mock.count("PutObject"))
+	req.Empty(mock.getObject("bucket", "file").body)
+
+	// The content is written before Create is retried
+	mock.putObject("bucket", "file", []byte("content"), time.Now())
+	mock.resetCalls()
+
+	file, err = fs.Create("/file")
+	req.NoError(err)
+	req.NoError(file.Close())
+	req.Zero(mock.count("PutObject"))
+	req.Equal("content", string(mock.getObject("bucket", "file").body))
+
+	// Writing to the existing file replaces it
+	file, err = fs.Create("/file")
+	req.NoError(err)
+	_, err = file.WriteString("new")
+	req.NoError(err)
+	req.NoError(file.Close())
+	req.Equal("new", string(mock.getObject("bucket", "file").body))
+
+	t.Run("TempFileWrites", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithCreateIfMissing(), WithTempFileWrites(t.TempDir()))
+		mock.putObject("bucket", "file", []byte("content"), time.Now())
+
+		file, err := fs.Create("/file")
+		req.NoError(err)
+		req.NoError(file.Close())
+		req.Zero(mock.count("PutObject"))
+		req.Equal("content", string(mock.getObject("bucket", "file").body))
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		mock.putObject("bucket", "file", []byte("content"), time.Now())
+
+		file, err := fs.Create("/file")
+		req.NoError(err)
+		req.NoError(file.Close())
+		req.Empty(mock.getObject("bucket", "file").body)
+	})
+}
+
+func TestCreateOverDir(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "dir/file", []byte("content"), time.Now())
+	mock.putObject("bucket", "empty/", nil, time.Now())
+
+	for _, name := range []string{"/dir", "/empty", "/dir/"} {
+		_, err := fs.Create(name)
+		req.ErrorIs(err, syscall.EISDIR, name)
+	}
+	req.Nil(mock.getObject("bucket", "dir"))
+	req.Nil(mock.getObject("bucket", "empty"))
+
+	// Files sharing the name of a directory as a prefix aren't affected
+	file, err := fs.Create("/di")
+	req.NoError(err)
+	req.NoError(file.Close())
+
+	t.Run("Allowed", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithFileOverDir())
+		mock.putObject("bucket", "dir/file", []byte("content"), time.Now())
+		mock.resetCalls()
+
+		file, err := fs.Create("/dir")
+		req.NoError(err)
+		req.NoError(file.Close())
+		req.NotNil(mock.getObject("bucket", "dir"))
+		req.Zero(mock.count("ListObjectsV2"))
+	})
+
+	t.Run("ExistingFile", func(t *testing.T) {
+		mock.resetCalls()
+		file, err := fs.Create("/di")
+		req.NoError(err)
+		req.NoError(file.Close())
+		req.Zero(mock.count("ListObjectsV2"))
+	})
+
+	t.Run("ListingError", func(t *testing.T) {
+		mock.hook = func(op string, _ interface{}) error {
+			if op == "ListObjectsV2" {
+				return awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "mock")
+			}
+			return nil
+		}
+		defer func() { mock.hook = nil }()
+
+		_, err := fs.Create("/new")
+		req.ErrorIs(err, os.ErrPermission)
+		var pathErr *os.PathError
+		req.ErrorAs(err, &pathErr)
+		req.Equal("open", pathErr.Op)
+		req.Nil(mock.getObject("bucket", "new"))
+	})
+
+	t.Run("AutoCreateBucket", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithAutoCreateBucket())
+		missingBucket(mock)
+
+		file, err := fs.Create("/file")
+		req.NoError(err)
+		req.NoError(file.Close())
+		req.Equal(1, mock.count("CreateBucket"))
+		req.NotNil(mock.getObject("bucket", "file"))
+	})
+}
+
+func TestPutBytes(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithFileProps(&UploadedFileProperties{CacheControl: aws.String("no-cache")}))
+
+	etag, err := fs.PutBytes("/dir/file.json", []byte(`{"a":1}`))
+	req.NoError(err)
+
+	obj := mock.getObject("bucket", "dir/file.json")
+	req.Equal(obj.etag, etag)
+	req.Equal(mockETag([]byte(`{"a":1}`)), etag)
+	req.Equal(`{"a":1}`, string(obj.body))
+	req.Equal("application/json", aws.StringValue(obj.contentType))
+	req.Equal("no-cache", aws.StringValue(obj.cacheControl))
+}
+
+func TestSanitize(t *testing.T) {
+	req := require.New(t)
+
+	for name, expected := range map[string]string{
+		"file":                "file",
+		"/dir/file":           "/dir/file",
+		"dir/":                "dir/",
+		"/":                   "/",
+		"a/../../secret":      "secret",
+		"/a/../../secret":     "/secret",
+		"../secret":           "secret",
+		"..":                  ".",
+		"dir/./../../../etc/": "etc/",
+		"C:\\dir\\..\\..\\f":  "/f",
+	} {
+		req.Equal(expected, sanitize(name), name)
+	}
+
+	fs, mock := newMockFs(t, WithPrefix("tenant"))
+	_, err := fs.PutBytes("../../secret", []byte("content"))
+	req.NoError(err)
+	req.NotNil(mock.getObject("bucket", "tenant/secret"))
+}
+
+func TestKeyFidelity(t *testing.T) {
+	req := require.New(t)
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Sanitized", nil},
+		{"RawMode", []Option{WithRawMode()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, mock := newMockFs(t, tc.opts...)
+
+			for _, name := range []string{
+				"My File (copy).jpg",
+				"photos/🎉 party/été  2021.png",
+				"music/Sigur Rós - Hoppípolla.flac",
+				"trailing space ",
+				"café́.txt", // Not normalized
+			} {
+				req.Equal(name, sanitize(name))
+
+				testCreateFile(t, fs, name, "content of "+name)
+				req.NotNil(mock.getObject("bucket", name), name)
+
+				info, err := fs.Stat(name)
+				req.NoError(err, name)
+				req.Equal(path.Base(name), info.Name())
+
+				file, err := fs.Open(name)
+				req.NoError(err, name)
+				content, err := io.ReadAll(file)
+				req.NoError(err)
+				req.Equal("content of "+name, string(content))
+				req.NoError(file.Close())
+			}
+
+			dir, err := fs.Open("photos/🎉 party")
+			req.NoError(err)
+			names, err := dir.Readdirnames(-1)
+			req.NoError(err)
+			req.Equal([]string{"été  2021.png"}, names)
+			req.NoError(dir.Close())
+		})
+	}
+}
+
+func TestPermissionError(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "file", []byte("content"), time.Now())
+	mock.hook = func(op string, input interface{}) error {
+		return awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "mock")
+	}
+
+	_, err := fs.Stat("/file")
+	req.ErrorIs(err, os.ErrPermission)
+	var permissionErr *PermissionError
+	req.ErrorAs(err, &permissionErr)
+	var awsErr awserr.Error
+	req.ErrorAs(err, &awsErr)
+	req.Equal("AccessDenied", awsErr.Code())
+
+	_, err = fs.Open("/file")
+	req.ErrorIs(err, os.ErrPermission)
+
+	_, err = fs.Create("/file")
+	req.ErrorIs(err, os.ErrPermission)
+
+	req.ErrorIs(fs.Remove("/file"), os.ErrPermission)
+
+	file, err := fs.OpenFile("/file", os.O_WRONLY, 0)
+	req.NoError(err)
+	req.ErrorIs(file.Close(), os.ErrPermission)
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		// Reading is denied, but not the metadata
+		mock.hook = func(op string, input interface{}) error {
+			if op == "GetObject" {
+				return awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "mock")
+			}
+			return nil
+		}
+		file, err := fs.Open("/file")
+		req.NoError(err)
+		_, err = io.ReadAll(file)
+		req.ErrorIs(err, os.ErrPermission)
+		req.NoError(file.Close())
+	})
+
+	t.Run("OtherErrors", func(t *testing.T) {
+		mock.hook = nil
+		_, err := fs.Stat("/missing")
+		req.ErrorIs(err, os.ErrNotExist)
+		req.NotErrorIs(err, os.ErrPermission)
+	})
+}
+
+// countingReaderAt counts the reads of each part of a ReaderAt
+type countingReaderAt struct {
+	io.ReaderAt
+	mu    sync.Mutex
+	reads map[int64]int
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	r.reads[off/s3manager.DefaultUploadPartSize]++
+	r.mu.Unlock()
+	return r.ReaderAt.ReadAt(p, off)
+}
+
+func (r *countingReaderAt) count(part int64) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reads[part]
+}
+
+func TestUploadReaderAt(t *testing.T) {
+	req := require.New(t)
+
+	t.Run("Content", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		content := bytes.Repeat([]byte("0123456789"), 1200*1024)
+
+		req.NoError(fs.UploadReaderAt("/big.bin", bytes.NewReader(content), int64(len(content))))
+		req.Equal(content, mock.getObject("bucket", "big.bin").body)
+		req.Equal(3, mock.count("UploadPart"))
+
+		req.NoError(fs.UploadReaderAt("/small.txt", strings.NewReader("small"), 5))
+		req.Equal("small", string(mock.getObject("bucket", "small.txt").body))
+		req.Equal("text/plain; charset=utf-8", aws.StringValue(mock.getObject("bucket", "small.txt").contentType))
+	})
+
+	t.Run("RetriedParts", func(t *testing.T) {
+		sess, err := session.NewSession(&aws.Config{
+			Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+			Endpoint:    aws.String("http://localhost:9000"),
+			Region:      aws.String("eu-west-1"),
+			MaxRetries:  aws.Int(3),
+		})
+		req.NoError(err)
+
+		content := bytes.Repeat([]byte("abcdefghij"), 1200*1024)
+		reader := &countingReaderAt{ReaderAt: bytes.NewReader(content), reads: map[int64]int{}}
+
+		// The upload of the second part fails once
+		var mu sync.Mutex
+		parts := map[int64][]byte{}
+		failed := false
+		readsBeforeRetry := 0
+		api := s3.New(sess)
+		api.Handlers.Send.Clear()
+		api.Handlers.Send.PushBack(func(r *request.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			r.HTTPResponse = &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}
+			switch r.Operation.Name {
+			case "CreateMultipartUpload":
+				r.HTTPResponse.Body = io.NopCloser(strings.NewReader(
+					"<InitiateMultipartUploadResult><UploadId>upload</UploadId></InitiateMultipartUploadResult>",
+				))
+			case "UploadPart":
+				partNumber := aws.Int64Value(r.Params.(*s3.UploadPartInput).PartNumber)
+				body, err := io.ReadAll(r.HTTPRequest.Body)
+				req.NoError(err)
+				if partNumber == 2 && !failed {
+					failed = true
+					readsBeforeRetry = reader.count(1)
+					r.HTTPResponse.StatusCode = http.StatusInternalServerError
+					r.HTTPResponse.Body = io.NopCloser(strings.NewReader("<Error><Code>InternalError</Code></Error>"))
+					return
+				}
+				parts[partNumber] = body
+				r.HTTPResponse.Header.Set("ETag", mockETag(body))
+			case "CompleteMultipartUpload":
+				r.HTTPResponse.Body = io.NopCloser(strings.NewReader(
+					"<CompleteMultipartUploadResult><ETag>\"etag-3\"</ETag></CompleteMultipartUploadResult>",
+				))
+			}
+		})
+
+		fs := NewFsWithOptions("bucket", sess, WithS3API(api))
+		req.NoError(fs.UploadReaderAt("/big.bin", reader, int64(len(content))))
+
+		req.True(failed)
+		req.Greater(reader.count(1), readsBeforeRetry)
+		req.Len(parts, 3)
+		req.Equal(content, append(append(parts[1], parts[2]...), parts[3]...))
+	})
+}
+
+func TestStatNameMatchesReaddir(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	mock.putObject("bucket", "a/file", []byte("content"), time.Now())
+	mock.putObject("bucket", "a/marked/", nil, time.Now())
+	mock.putObject("bucket", "a/marked/file", []byte("content"), time.Now())
+	mock.putObject("bucket", "a/unmarked/file", []byte("content"), time.Now())
+
+	dir, err := fs.Open("/a")
+	req.NoError(err)
+	fis, err := dir.Readdir(-1)
+	req.NoError(err)
+	req.NoError(dir.Close())
+	req.Len(fis, 3)
+
+	for _, fi := range fis {
+		for _, name := range []string{"/a/" + fi.Name(), "a/" + fi.Name(), "/a/" + fi.Name() + "/"} {
+			if !fi.IsDir() && strings.HasSuffix(name, "/") {
+				continue
+			}
+			info, err := fs.Stat(name)
+			req.NoError(err, name)
+			req.Equal(fi.Name(), info.Name(), name)
+			req.Equal(fi.IsDir(), info.IsDir(), name)
+		}
+	}
+
+	info, err := fs.Stat("/a/")
+	req.NoError(err)
+	req.Equal("a", info.Name())
+}
+
+func TestUnsignedPayload(t *testing.T) {
+	req := require.New(t)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+		Endpoint:    aws.String("http://localhost:9000"),
+		Region:      aws.String("eu-west-1"),
+		MaxRetries:  aws.Int(0),
+	})
+	req.NoError(err)
+
+	hashes := map[string]string{}
+	api := s3.New(sess)
+	api.Handlers.Send.Clear()
+	api.Handlers.Send.PushBack(func(r *request.Request) {
+		hashes[r.Operation.Name] = r.HTTPRequest.Header.Get("X-Amz-Content-Sha256")
+		r.HTTPResponse = &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Etag":           []string{`"etag"`},
+				"Content-Length": []string{"7"},
+				"Last-Modified":  []string{time.Now().UTC().Format(http.TimeFormat)},
+			},
+			Body: http.NoBody,
+		}
+	})
+
+	// The content is signed by default
+	fs := NewFsWithOptions("bucket", sess, WithS3API(api))
+	_, err = fs.PutBytes("/file.txt", []byte("content"))
+	req.NoError(err)
+	req.NotEqual("UNSIGNED-PAYLOAD", hashes["PutObject"])
+	req.NotEmpty(hashes["PutObject"])
+
+	fs = NewFsWithOptions("bucket", sess, WithS3API(api), WithUnsignedPayload())
+	_, err = fs.PutBytes("/file.txt", []byte("content"))
+	req.NoError(err)
+	req.Equal("UNSIGNED-PAYLOAD", hashes["PutObject"])
+
+	delete(hashes, "PutObject")
+	req.NoError(fs.UploadReaderAt("/other.txt", strings.NewReader("content"), 7))
+	req.Equal("UNSIGNED-PAYLOAD", hashes["PutObject"])
+
+	// Only the uploads are affected
+	_, err = fs.Stat("/file.txt")
+	req.NoError(err)
+	req.NotEqual("UNSIGNED-PAYLOAD", hashes["HeadObject"])
+}
+
+func TestRootNames(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	for _, name := range []string{"", ".", "/", "./"} {
+		// The root is a directory, even when the bucket is empty
+		info, err := fs.Stat(name)
+		req.NoError(err)
+		req.True(info.IsDir())
+
+		dir, err := fs.Open(name)
+		req.NoError(err)
+		fis, err := dir.Readdir(-1)
+		req.NoError(err)
+		req.Empty(fis)
+
+		req.NoError(fs.Mkdir(name, 0o755))
+		req.NoError(fs.MkdirAll(name, 0o755))
+
+		// No operation on files applies to it
+		_, err = fs.Create(name)
+		req.ErrorIs(err, os.ErrInvalid)
+		_, err = fs.OpenFile(name, os.O_WRONLY, 0o644)
+		req.ErrorIs(err, os.ErrInvalid)
+		_, err = fs.PutBytes(name, []byte("content"))
+		req.ErrorIs(err, os.ErrInvalid)
+		req.ErrorIs(fs.Remove(name), os.ErrInvalid)
+		req.ErrorIs(fs.Rename(name, "/dst"), os.ErrInvalid)
+		req.ErrorIs(fs.Rename("/src", name), os.ErrInvalid)
+		req.ErrorIs(fs.Copy(name, "/dst"), os.ErrInvalid)
+		req.ErrorIs(fs.Chmod(name, 0o644), os.ErrInvalid)
+		req.ErrorIs(fs.Touch(name), os.ErrInvalid)
+		req.ErrorIs(fs.RemoveAll(name), os.ErrInvalid)
+	}
+	// Only the root was listed
+	req.Len(mock.calls, 4)
+	req.Equal(4, mock.count("ListObjectsV2"))
+}
+
+func TestRemoveAllRoot(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	mock.putObject("bucket", "file", []byte("content"), time.Now())
+	mock.putObject("bucket", "dir/", nil, time.Now())
+	mock.putObject("bucket", "dir/file", []byte("content"), time.Now())
+
+	// Blank names are likely to be mistakes, they don't remove anything
+	for _, name := range []string{"", " ", ".", "./"} {
+		req.ErrorIs(fs.RemoveAll(name), os.ErrInvalid)
+		_, err := fs.RemoveMatching(name, func(os.FileInfo) bool { return true })
+		req.ErrorIs(err, os.ErrInvalid)
+	}
+
+	// Removing everything requires Purge
+	err := fs.RemoveAll("/")
+	req.ErrorIs(err, os.ErrInvalid)
+	req.EqualError(err, "removeall /: invalid argument: the root can only be emptied with Purge")
+	req.Empty(mock.calls)
+	req.Len(mock.buckets["bucket"], 3)
+
+	removed, err := fs.Purge("/", true)
+	req.NoError(err)
+	req.Equal(3, removed)
+	req.Empty(mock.buckets["bucket"])
+}
+
+func TestRemoveAllSelfReference(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	// Endless recursions are reported instead of overflowing the stack
+	listings := 0
+	mock.hook = func(op string, _ interface{}) error {
+		if op == "ListObjectsV2" {
+			if listings++; listings > 20 {
+				return errors.New("too many listings")
+			}
+		}
+		return nil
+	}
+
+	for _, key := range []string{"foo/", "foo//", "foo/a", "foo/foo/", "foo/foo/b"} {
+		mock.putObject("bucket", key, nil, time.Now())
+	}
+
+	req.NoError(fs.RemoveAll("/foo"))
+	for _, key := range []string{"foo/", "foo/a", "foo/foo/", "foo/foo/b"} {
+		req.Nil(mock.getObject("bucket", key), key)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithSoftDelete(".trash"))
+
+	mock.putObject("bucket", "file", []byte("file"), time.Now())
+	mock.putObject("bucket", "dir/", nil, time.Now())
+	mock.putObject("bucket", "dir/a", []byte("a"), time.Now())
+	mock.putObject("bucket", "dir/sub/b", []byte("b"), time.Now())
+
+	req.NoError(fs.Remove("/file"))
+	req.Nil(mock.getObject("bucket", "file"))
+	req.Equal("file", string(mock.getObject("bucket", ".trash/file").body))
+
+	req.NoError(fs.RemoveAll("/dir"))
+	for _, key := range []string{"dir/", "dir/a", "dir/sub/b"} {
+		req.Nil(mock.getObject("bucket", key), key)
+	}
+	req.NotNil(mock.getObject("bucket", ".trash/dir/"))
+	req.Equal("a", string(mock.getObject("bucket", ".trash/dir/a").body))
+	req.Equal("b", string(mock.getObject("bucket", ".trash/dir/sub/b").body))
+
+	// Removing everything keeps the trash
+	mock.putObject("bucket", "other", []byte("other"), time.Now())
+	_, err := fs.Purge("/", true)
+	req.NoError(err)
+	req.Nil(mock.getObject("bucket", "other"))
+	req.NotNil(mock.getObject("bucket", ".trash/other"))
+	req.NotNil(mock.getObject("bucket", ".trash/file"))
+
+	// The files removed from the trash are deleted
+	req.NoError(fs.Remove("/.trash/file"))
+	req.Nil(mock.getObject("bucket", ".trash/file"))
+	req.Nil(mock.getObject("bucket", ".trash/.trash/file"))
+	req.NoError(fs.RemoveAll("/.trash"))
+	req.Empty(mock.buckets["bucket"])
+}
+
+func TestRemoveAllMissing(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	req.NoError(fs.RemoveAll("/missing"))
+	req.NoError(fs.RemoveAll("/missing/sub/dir"))
+
+	// Some servers report missing prefixes and objects as not found
+	mock.hook = func(op string, input interface{}) error {
+		if op == "ListObjectsV2" || op == "DeleteObject" {
+			return mockNotFound("NoSuchKey")
+		}
+		return nil
+	}
+	req.NoError(fs.RemoveAll("/missing"))
+
+	mock.hook = func(op string, input interface{}) error {
+		if op == "DeleteObject" {
+			return mockNotFound("NoSuchKey")
+		}
+		return nil
+	}
+	req.NoError(fs.RemoveAll("/missing"))
+
+	mock.hook = func(op string, input interface{}) error {
+		if op == "ListObjectsV2" {
+			return awserr.NewRequestFailure(awserr.New("InternalError", "Internal Error", nil), 500, "mock")
+		}
+		return nil
+	}
+	req.Error(fs.RemoveAll("/missing"))
+}
+
+func TestKeySanitizer(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithPrefix("data"), WithKeySanitizer(SafeKeySanitizer{}))
+
+	for name, key := range map[string]string{
+		"/dir/a#b.txt":            "data/dir/a%23b.txt",
+		"/dir/what?.txt":          "data/dir/what%3F.txt",
+		"/dir/bell\a\x7f.txt":     "data/dir/bell%07%7F.txt",
+		"/dir/100%.txt":           "data/dir/100%25.txt",
+		"/dir/sub#1/été (1).txt":  "data/dir/sub%231/été (1).txt",
+		"/dir/new\nline/file.txt": "data/dir/new%0Aline/file.txt",
+	} {
+		testCreateFile(t, fs, name, "content")
+		req.NotNil(mock.getObject("bucket", key), key)
+
+		info, err := fs.Stat(name)
+		req.NoError(err)
+		req.Equal(path.Base(name), info.Name())
+
+		content, err := afero.ReadFile(fs, name)
+		req.NoError(err)
+		req.Equal("content", string(content))
+	}
+
+	dir, err := fs.Open("/dir")
+	req.NoError(err)
+	names, err := dir.Readdirnames(0)
+	req.NoError(err)
+	req.ElementsMatch([]string{"a#b.txt", "what?.txt", "bell\a\x7f.txt", "100%.txt", "sub#1", "new\nline"}, names)
+
+	dirs, err := fs.ListDirs("/dir")
+	req.NoError(err)
+	req.ElementsMatch([]string{"sub#1", "new\nline"}, dirs)
+
+	fis, err := fs.ReaddirAll("/dir/sub#1")
+	req.NoError(err)
+	req.Equal([]string{"été (1).txt"}, fileInfoNames(fis))
+
+	t.Run("Decoding", func(t *testing.T) {
+		sanitizer := SafeKeySanitizer{}
+		req.Equal("a%zz", sanitizer.DecodeKey("a%zz"))
+		req.Equal(`\{}^%[]"<>~#|?`, sanitizer.DecodeKey(sanitizer.EncodeKey(`\{}^%[]"<>~#|?`)))
+		req.Equal("a+b&c=d", sanitizer.EncodeKey("a+b&c=d"))
+	})
+}
+
+func TestPermACL(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithPermACL())
+
+	// Only the permissions of others matter, like with Chmod
+	for name, perm := range map[string]os.FileMode{"/shared": 0o644, "/other": 0o604, "/private": 0o640} {
+		req.NoError(afero.WriteFile(fs, name, []byte("content"), perm))
+	}
+	req.Equal("public-read", aws.StringValue(mock.getObject("bucket", "shared").acl))
+	req.Equal("public-read", aws.StringValue(mock.getObject("bucket", "other").acl))
+	req.Equal("private", aws.StringValue(mock.getObject("bucket", "private").acl))
+
+	req.NoError(fs.Mkdir("/dir", 0o777))
+	req.Equal("public-read-write", aws.StringValue(mock.getObject("bucket", "dir/").acl))
+
+	t.Run("FileProps", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithPermACL(), WithFileProps(&UploadedFileProperties{
+			ACL: aws.String("bucket-owner-full-control"),
+		}))
+		req.NoError(afero.WriteFile(fs, "/file", []byte("content"), 0o644))
+		req.Equal("bucket-owner-full-control", aws.StringValue(mock.getObject("bucket", "file").acl))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		req.NoError(afero.WriteFile(fs, "/file", []byte("content"), 0o644))
+		req.Nil(mock.getObject("bucket", "file").acl)
+	})
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	// Creating the file requires it not to exist
+	etag, err := fs.CompareAndSwap("/config.json", "", []byte(`{"version":1}`))
+	req.NoError(err)
+	req.Equal(mock.getObject("bucket", "config.json").etag, etag)
+	_, err = fs.CompareAndSwap("/config.json", "", []byte(`{"version":0}`))
+	req.ErrorIs(err, ErrConflict)
+
+	newETag, err := fs.CompareAndSwap("/config.json", etag, []byte(`{"version":2}`))
+	req.NoError(err)
+	req.NotEqual(etag, newETag)
+	req.Equal(`{"version":2}`, string(mock.getObject("bucket", "config.json").body))
+
+	t.Run("Mismatch", func(t *testing.T) {
+		_, err := fs.CompareAndSwap("/config.json", etag, []byte(`{"version":3}`))
+		req.ErrorIs(err, ErrConflict)
+		req.Equal(`{"version":2}`, string(mock.getObject("bucket", "config.json").body))
+
+		_, err = fs.CompareAndSwap("/missing.json", etag, []byte(`{"version":3}`))
+		req.ErrorIs(err, ErrConflict)
+		req.Nil(mock.getObject("bucket", "missing.json"))
+	})
+
+	t.Run("ConcurrentWrite", func(t *testing.T) {
+		// The file changes between the comparison and the write, the backend rejects it
+		mock.hook = func(op string, input interface{}) error {
+			if op == "PutObject" {
+				mock.bucket(aws.String("bucket"))["config.json"].etag = mockETag([]byte("concurrent"))
+			}
+			return nil
+		}
+		defer func() { mock.hook = nil }()
+
+		_, err := fs.CompareAndSwap("/config.json", newETag, []byte(`{"version":3}`))
+		req.ErrorIs(err, ErrConflict)
+		req.Equal(`{"version":2}`, string(mock.getObject("bucket", "config.json").body))
+	})
+}
+
+func TestSSECustomerKey(t *testing.T) {
+	req := require.New(t)
+	key := bytes.Repeat([]byte("k"), 32)
+	fs, mock := newMockFs(t, WithSSECustomerKey(key))
+
+	testCreateFile(t, fs, "/secret.txt", "content")
+	req.Equal(string(key), mock.getObject("bucket", "secret.txt").sseCustomerKey)
+
+	info, err := fs.Stat("/secret.txt")
+	req.NoError(err)
+	req.Equal(int64(7), info.Size())
+	input := mock.lastInput("HeadObject").(*s3.HeadObjectInput)
+	req.Equal("AES256", aws.StringValue(input.SSECustomerAlgorithm))
+	req.Equal(string(key), aws.StringValue(input.SSECustomerKey))
+
+	content, err := afero.ReadFile(fs, "/secret.txt")
+	req.NoError(err)
+	req.Equal("content", string(content))
+
+	file, err := fs.OpenWithOptions("/secret.txt", WithReadAhead(4))
+	req.NoError(err)
+	buf := make([]byte, 3)
+	_, err = file.ReadAt(buf, 4)
+	req.NoError(err)
+	req.Equal("ent", string(buf))
+	req.NoError(file.Close())
+
+	req.NoError(fs.Rename("/secret.txt", "/dir/secret.txt"))
+	content, err = afero.ReadFile(fs, "/dir/secret.txt")
+	req.NoError(err)
+	req.Equal("content", string(content))
+	req.Equal(string(key), mock.getObject("bucket", "dir/").sseCustomerKey)
+
+	t.Run("WithoutKey", func(t *testing.T) {
+		other := NewFsWithOptions("bucket", nil, WithS3API(mock))
+		_, err := other.Stat("/dir/secret.txt")
+		req.Error(err)
+		_, err = afero.ReadFile(other, "/dir/secret.txt")
+		req.Error(err)
+	})
+}
+
+// v2Client has the shape of the aws-sdk-go-v2 client: the context comes first and there are no request options
+type v2Client interface {
+	HeadObject(ctx context.Context, in *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, in *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, in *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	DeleteObject(ctx context.Context, in *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
+	CreateMultipartUpload(
+		ctx context.Context, in *s3.CreateMultipartUploadInput,
+	) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, in *s3.UploadPartInput) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(
+		ctx context.Context, in *s3.CompleteMultipartUploadInput,
+	) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(
+		ctx context.Context, in *s3.AbortMultipartUploadInput,
+	) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// v2MockClient is a v2Client storing the files in a mockS3
+type v2MockClient struct {
+	mock *mockS3
+}
+
+func (c v2MockClient) HeadObject(ctx context.Context, in *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return c.mock.HeadObjectWithContext(ctx, in)
+}
+
+func (c v2MockClient) GetObject(ctx context.Context, in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return c.mock.GetObjectWithContext(ctx, in)
+}
+
+func (c v2MockClient) PutObject(ctx context.Context, in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	return c.mock.PutObjectWithContext(ctx, in)
+}
+
+func (c v2MockClient) DeleteObject(ctx context.Context, in *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	return c.mock.DeleteObjectWithContext(ctx, in)
+}
+
+func (c v2MockClient) ListObjectsV2(
+	ctx context.Context, in *s3.ListObjectsV2Input,
+) (*s3.ListObjectsV2Output, error) {
+	return c.mock.ListObjectsV2WithContext(ctx, in)
+}
+
+func (c v2MockClient) CreateMultipartUpload(
+	ctx context.Context, in *s3.CreateMultipartUploadInput,
+) (*s3.CreateMultipartUploadOutput, error) {
+	return c.mock.CreateMultipartUploadWithContext(ctx, in)
+}
+
+func (c v2MockClient) UploadPart(ctx context.Context, in *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	return c.mock.UploadPartWithContext(ctx, in)
+}
+
+func (c v2MockClient) CompleteMultipartUpload(
+	ctx context.Context, in *s3.CompleteMultipartUploadInput,
+) (*s3.CompleteMultipartUploadOutput, error) {
+	return c.mock.CompleteMultipartUploadWithContext(ctx, in)
+}
+
+func (c v2MockClient) AbortMultipartUpload(
+	ctx context.Context, in *s3.AbortMultipartUploadInput,
+) (*s3.AbortMultipartUploadOutput, error) {
+	return c.mock.AbortMultipartUploadWithContext(ctx, in)
+}
+
+// v2Adapter plugs a v2Client into an Fs, it only implements the API interface
+type v2Adapter struct {
+	client v2Client
+}
+
+var _ API = v2Adapter{}
+
+func (a v2Adapter) HeadObjectWithContext(
+	ctx aws.Context, in *s3.HeadObjectInput, _ ...request.Option,
+) (*s3.HeadObjectOutput, error) {
+	return a.client.HeadObject(ctx, in)
+}
+
+func (a v2Adapter) GetObjectWithContext(
+	ctx aws.Context, in *s3.GetObjectInput, _ ...request.Option,
+) (*s3.GetObjectOutput, error) {
+	return a.client.GetObject(ctx, in)
+}
+
+func (a v2Adapter) PutObjectWithContext(
+	ctx aws.Context, in *s3.PutObjectInput, _ ...request.Option,
+) (*s3.PutObjectOutput, error) {
+	return a.client.PutObject(ctx, in)
+}
+
+func (a v2Adapter) DeleteObjectWithContext(
+	ctx aws.Context, in *s3.DeleteObjectInput, _ ...request.Option,
+) (*s3.DeleteObjectOutput, error) {
+	return a.client.DeleteObject(ctx, in)
+}
+
+func (a v2Adapter) ListObjectsV2WithContext(
+	ctx aws.Context, in *s3.ListObjectsV2Input, _ ...request.Option,
+) (*s3.ListObjectsV2Output, error) {
+	return a.client.ListObjectsV2(ctx, in)
+}
+
+func (a v2Adapter) CreateMultipartUploadWithContext(
+	ctx aws.Context, in *s3.CreateMultipartUploadInput, _ ...request.Option,
+) (*s3.CreateMultipartUploadOutput, error) {
+	return a.client.CreateMultipartUpload(ctx, in)
+}
+
+func (a v2Adapter) UploadPartWithContext(
+	ctx aws.Context, in *s3.UploadPartInput, _ ...request.Option,
+) (*s3.UploadPartOutput, error) {
+	return a.client.UploadPart(ctx, in)
+}
+
+func (a v2Adapter) CompleteMultipartUploadWithContext(
+	ctx aws.Context, in *s3.CompleteMultipartUploadInput, _ ...request.Option,
+) (*s3.CompleteMultipartUploadOutput, error) {
+	return a.client.CompleteMultipartUpload(ctx, in)
+}
+
+func (a v2Adapter) AbortMultipartUploadWithContext(
+	ctx aws.Context, in *s3.AbortMultipartUploadInput, _ ...request.Option,
+) (*s3.AbortMultipartUploadOutput, error) {
+	return a.client.AbortMultipartUpload(ctx, in)
+}
+
+func TestNewFsWithAPI(t *testing.T) {
+	req := require.New(t)
+	mock := newMockS3()
+	fs := NewFsWithAPI("bucket", v2Adapter{client: v2MockClient{mock: mock}}, WithoutDirMarkers())
+
+	testCreateFile(t, fs, "/dir/file", "content")
+	req.Equal("content", string(mock.getObject("bucket", "dir/file").body))
+
+	data, err := afero.ReadFile(fs, "/dir/file")
+	req.NoError(err)
+	req.Equal("content", string(data))
+
+	info, err := fs.Stat("/dir")
+	req.NoError(err)
+	req.True(info.IsDir())
+
+	file, err := fs.Create("/dir/created")
+	req.NoError(err)
+	_, err = file.WriteString("created")
+	req.NoError(err)
+	req.NoError(file.Close())
+	req.Equal("created", string(mock.getObject("bucket", "dir/created").body))
+
+	fis, err := afero.ReadDir(fs, "/dir")
+	req.NoError(err)
+	req.Equal([]string{"created", "file"}, fileInfoNames(fis))
+
+	req.NoError(fs.Remove("/dir/file"))
+	_, err = fs.Stat("/dir/file")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	t.Run("Multipart", func(t *testing.T) {
+		content := append(bytes.Repeat([]byte("a"), partSize), []byte("b")...)
+		req.NoError(afero.WriteFile(fs, "/big", content, 0o644))
+		req.Equal(2, mock.count("UploadPart"))
+		req.Equal(content, mock.getObject("bucket", "big").body)
+	})
+
+	t.Run("NotImplemented", func(t *testing.T) {
+		req.ErrorIs(fs.Rename("/dir/created", "/dir/renamed"), ErrNotImplemented)
+		req.ErrorIs(fs.Ping(), ErrNotImplemented)
+		req.NotNil(mock.getObject("bucket", "dir/created"))
+	})
+
+	t.Run("S3API", func(t *testing.T) {
+		req.Same(mock, NewFsWithAPI("bucket", mock).S3API)
+	})
+}
+
+func TestClock(t *testing.T) {
+	req := require.New(t)
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	fs, mock := newMockFs(t, WithClock(func() time.Time { return now }))
+	mock.putObject("bucket", "dir/sub/file", []byte("content"), time.Now())
+
+	for _, name := range []string{"/", "/dir", "/dir/sub"} {
+		info, err := fs.Stat(name)
+		req.NoError(err)
+		req.True(info.IsDir())
+		req.Equal(now, info.ModTime(), name)
+	}
+
+	dir, err := fs.Open("/dir")
+	req.NoError(err)
+	fis, err := dir.Readdir(-1)
+	req.NoError(err)
+	req.NoError(dir.Close())
+	req.Len(fis, 1)
+	req.True(fis[0].IsDir())
+	req.Equal(now, fis[0].ModTime())
+}
+
+func TestBypassGovernanceRetention(t *testing.T) {
+	req := require.New(t)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+		Endpoint:    aws.String("http://localhost:9000"),
+		Region:      aws.String("eu-west-1"),
+		MaxRetries:  aws.Int(0),
+	})
+	req.NoError(err)
+
+	headers := map[string]string{}
+	api := s3.New(sess)
+	api.Handlers.Send.Clear()
+	api.Handlers.Send.PushBack(func(r *request.Request) {
+		headers[r.Operation.Name] = r.HTTPRequest.Header.Get("X-Amz-Bypass-Governance-Retention")
+		r.HTTPResponse = &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Etag":           []string{`"etag"`},
+				"Content-Length": []string{"7"},
+				"Last-Modified":  []string{time.Now().UTC().Format(http.TimeFormat)},
+			},
+			Body: http.NoBody,
+		}
+	})
+
+	// The lock is enforced by default
+	fs := NewFsWithOptions("bucket", sess, WithS3API(api))
+	req.NoError(fs.Remove("/file.txt"))
+	req.Empty(headers["DeleteObject"])
+
+	fs = NewFsWithOptions("bucket", sess, WithS3API(api), WithBypassGovernanceRetention())
+	req.NoError(fs.Remove("/file.txt"))
+	req.Equal("true", headers["DeleteObject"])
+
+	t.Run("RemoveAll", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithBypassGovernanceRetention())
+		mock.putObject("bucket", "dir/a", []byte("a"), time.Now())
+		mock.putObject("bucket", "dir/b", []byte("b"), time.Now())
+		req.NoError(fs.RemoveAll("/dir"))
+		req.Len(mock.inputs["DeleteObject"], 3)
+		for _, input := range mock.inputs["DeleteObject"] {
+			req.True(aws.BoolValue(input.(*s3.DeleteObjectInput).BypassGovernanceRetention))
+		}
+
+		mock.putObject("bucket", "dir/c", []byte("c"), time.Now())
+		_, err := fs.Purge("/dir", true)
+		req.NoError(err)
+		req.True(aws.BoolValue(mock.lastInput("DeleteObjects").(*s3.DeleteObjectsInput).BypassGovernanceRetention))
+	})
+
+	t.Run("MoveTo", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithBypassGovernanceRetention())
+		mock.putObject("bucket", "file", []byte("file"), time.Now())
+		req.NoError(fs.MoveTo(fs, "/file", "/moved"))
+		req.True(aws.BoolValue(mock.lastInput("DeleteObject").(*s3.DeleteObjectInput).BypassGovernanceRetention))
+	})
+}
+
+func TestDefaultPerms(t *testing.T) {
+	req := require.New(t)
+
+	t.Run("Default", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		mock.putObject("bucket", "dir/file", []byte("content"), time.Now())
+
+		info, err := fs.Stat("/dir/file")
+		req.NoError(err)
+		req.Equal(os.FileMode(0o644), info.Mode())
+		info, err = fs.Stat("/dir")
+		req.NoError(err)
+		req.Equal(os.FileMode(0o755), info.Mode())
+	})
+
+	fs, mock := newMockFs(t, WithDefaultPerms(0o600, 0o700))
+	mock.putObject("bucket", "dir/file", []byte("content"), time.Now())
+	mock.putObject("bucket", "dir/sub/other", []byte("content"), time.Now())
+
+	info, err := fs.Stat("/dir/file")
+	req.NoError(err)
+	req.Equal(os.FileMode(0o600), info.Mode())
+	info, err = fs.Stat("/dir")
+	req.NoError(err)
+	req.Equal(os.FileMode(0o700), info.Mode())
+	info, err = fs.Stat("/")
+	req.NoError(err)
+	req.Equal(os.FileMode(0o700), info.Mode())
+
+	dir, err := fs.Open("/dir")
+	req.NoError(err)
+	fis, err := dir.Readdir(-1)
+	req.NoError(err)
+	req.NoError(dir.Close())
+	req.Len(fis, 2)
+	for _, fi := range fis {
+		if fi.IsDir() {
+			req.Equal(os.FileMode(0o700), fi.Mode(), fi.Name())
+		} else {
+			req.Equal(os.FileMode(0o600), fi.Mode(), fi.Name())
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "dir/file", []byte("content"), time.Now())
+
+	size, err := fs.Size("/dir/file")
+	req.NoError(err)
+	req.Equal(int64(7), size)
+	req.Equal([]string{"HeadObject"}, mock.calls)
+
+	_, err = fs.Size("/missing")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	// Directories aren't files
+	_, err = fs.Size("/dir")
+	req.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestPutSized(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	// Bigger than a part, and not seekable
+	content := bytes.Repeat([]byte("a"), 6*1024*1024)
+	req.NoError(fs.PutSized("/file", io.MultiReader(bytes.NewReader(content)), int64(len(content))))
+	req.Equal([]string{"PutObject"}, mock.calls)
+	req.Equal(int64(len(content)), aws.Int64Value(mock.lastInput("PutObject").(*s3.PutObjectInput).ContentLength))
+	req.Equal(content, mock.getObject("bucket", "file").body)
+
+	t.Run("Request", func(t *testing.T) {
+		sess, err := session.NewSession(&aws.Config{
+			Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+			Endpoint:    aws.String("http://localhost:9000"),
+			Region:      aws.String("eu-west-1"),
+			MaxRetries:  aws.Int(0),
+		})
+		req.NoError(err)
+
+		var sent *http.Request
+		var body []byte
+		api := s3.New(sess)
+		api.Handlers.Send.Clear()
+		api.Handlers.Send.PushBack(func(r *request.Request) {
+			sent = r.HTTPRequest
+			body, err = io.ReadAll(r.HTTPRequest.Body)
+			req.NoError(err)
+			r.HTTPResponse = &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}
+		})
+
+		fs := NewFsWithOptions("bucket", sess, WithS3API(api))
+		req.NoError(fs.PutSized("/file.txt", io.MultiReader(strings.NewReader("content")), 7))
+		req.Equal(int64(7), sent.ContentLength)
+		req.Equal("UNSIGNED-PAYLOAD", sent.Header.Get("X-Amz-Content-Sha256"))
+		req.Equal("content", string(body))
+
+		// Seekable readers are signed
+		req.NoError(fs.PutSized("/file.txt", strings.NewReader("content"), 7))
+		req.NotEqual("UNSIGNED-PAYLOAD", sent.Header.Get("X-Amz-Content-Sha256"))
+	})
+}
+
+func TestHeadObjectFallback(t *testing.T) {
+	req := require.New(t)
+	modTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	fs, mock := newMockFs(t, WithHeadObjectFallback())
+	mock.putObject("bucket", "file", []byte("content"), modTime)
+	mock.putObject("bucket", "empty", nil, modTime)
+	mock.putObject("bucket", "dir/file", []byte("content"), modTime)
+	mock.hook = func(op string, _ interface{}) error {
+		if op == "HeadObject" {
+			return awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), http.StatusForbidden, "mock")
+		}
+		return nil
+	}
+
+	info, err := fs.Stat("/file")
+	req.NoError(err)
+	req.False(info.IsDir())
+	req.Equal(int64(7), info.Size())
+	req.Equal(modTime, info.ModTime())
+	req.Equal("bytes=0-0", aws.StringValue(mock.lastInput("GetObject").(*s3.GetObjectInput).Range))
+
+	info, err = fs.Stat("/empty")
+	req.NoError(err)
+	req.Zero(info.Size())
+	req.Equal(modTime, info.ModTime())
+
+	info, err = fs.Stat("/dir")
+	req.NoError(err)
+	req.True(info.IsDir())
+
+	_, err = fs.Stat("/missing")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	t.Run("Disabled", func(t *testing.T) {
+		fs := NewFsWithOptions("bucket", nil, WithS3API(mock))
+		_, err := fs.Stat("/file")
+		req.ErrorIs(err, os.ErrPermission)
+	})
+}
@@ -0,0 +1,63 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// KeySanitizer encodes the names of the files into S3 keys, and decodes the keys back into names when listing.
+// The slashes separating directories must be kept as they are.
+type KeySanitizer interface {
+	EncodeKey(name string) string // EncodeKey returns the key of a file name
+	DecodeKey(key string) string  // DecodeKey returns the file name of a key
+}
+
+// keyUnsafeChars are the characters S3 recommends avoiding in keys, with "?" that breaks many URLs and "%" that
+// introduces the encoded characters
+const keyUnsafeChars = "\\{}^%`[]\"<>~#|?"
+
+// SafeKeySanitizer percent-encodes the control characters and the characters S3 recommends avoiding in keys, like
+// "#" or "?". Other characters, including non-ASCII ones, are kept as they are. Existing keys containing "%" followed
+// by two hexadecimal digits are listed with these characters decoded.
+type SafeKeySanitizer struct{}
+
+// EncodeKey percent-encodes the unsafe characters of a name
+func (SafeKeySanitizer) EncodeKey(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 0x20 || c == 0x7f || strings.IndexByte(keyUnsafeChars, c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// DecodeKey decodes the percent-encoded characters of a key, keys that aren't correctly encoded are kept as is
+func (SafeKeySanitizer) DecodeKey(key string) string {
+	name, err := url.PathUnescape(key)
+	if err != nil {
+		return key
+	}
+	return name
+}
+
+// encodeKey encodes a name with the KeySanitizer, if any
+func (fs Fs) encodeKey(name string) string {
+	if fs.KeySanitizer == nil {
+		return name
+	}
+	return fs.KeySanitizer.EncodeKey(name)
+}
+
+// decodeKey decodes a key, or a part of a key, with the KeySanitizer, if any
+func (fs Fs) decodeKey(key string) string {
+	if fs.KeySanitizer == nil {
+		return key
+	}
+	return fs.KeySanitizer.DecodeKey(key)
+}
@@ -0,0 +1,24 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"syscall"
+)
+
+// LineReader opens a file for scanning its lines, like logs or CSV records, as its content is streamed. The returned
+// closer releases the stream and must be called once done. Lines longer than bufio.MaxScanTokenSize fail the scan
+// with bufio.ErrTooLong, unless a larger buffer is given to the scanner with Buffer before scanning.
+func (fs *Fs) LineReader(name string) (*bufio.Scanner, io.Closer, error) {
+	name = fs.sanitize(name)
+	file := NewFile(fs, name)
+	if err := file.openRead(); err != nil {
+		return nil, nil, err
+	}
+	if file.isDir {
+		return nil, nil, &os.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	}
+	return bufio.NewScanner(file), file, nil
+}
@@ -0,0 +1,54 @@
+package s3
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineReader(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "data.csv", []byte("id,name\n1,alice\n2,bob\n3,carol"), time.Now())
+
+	scanner, closer, err := fs.LineReader("/data.csv")
+	req.NoError(err)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	req.NoError(scanner.Err())
+	req.NoError(closer.Close())
+	req.Equal([]string{"id,name", "1,alice", "2,bob", "3,carol"}, lines)
+
+	t.Run("LongLines", func(t *testing.T) {
+		long := strings.Repeat("x", bufio.MaxScanTokenSize+1)
+		mock.putObject("bucket", "long.log", []byte(long+"\nshort\n"), time.Now())
+
+		scanner, closer, err := fs.LineReader("/long.log")
+		req.NoError(err)
+		defer func() { req.NoError(closer.Close()) }()
+		scanner.Buffer(nil, 2*bufio.MaxScanTokenSize)
+		req.True(scanner.Scan())
+		req.Equal(long, scanner.Text())
+		req.True(scanner.Scan())
+		req.Equal("short", scanner.Text())
+		req.False(scanner.Scan())
+		req.NoError(scanner.Err())
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		_, _, err := fs.LineReader("/missing.csv")
+		req.ErrorIs(err, os.ErrNotExist)
+	})
+
+	t.Run("Directory", func(t *testing.T) {
+		_, _, err := fs.LineReader("/")
+		req.ErrorIs(err, syscall.EISDIR)
+	})
+}
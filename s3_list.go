@@ -0,0 +1,290 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ListModifiedSince lists all the files under a prefix that were modified after a given time. As the listing is
+// recursive, the names of the returned FileInfo are the full paths of the files.
+func (fs *Fs) ListModifiedSince(prefix string, since time.Time) ([]os.FileInfo, error) {
+	var fis []os.FileInfo
+	err := fs.walkObjects(fs.sanitize(prefix), func(obj *s3.Object) error {
+		if obj.LastModified.After(since) {
+			fis = append(fis, fs.newFileInfo(fs.keyName(*obj.Key), false, *obj.Size, *obj.LastModified))
+		}
+		return nil
+	})
+	return fis, err
+}
+
+// ReaddirAll lists all the files under a directory recursively. The names of the returned FileInfo are the paths of
+// the files relative to the directory.
+func (fs *Fs) ReaddirAll(name string) ([]os.FileInfo, error) {
+	dir := strings.Trim(fs.sanitize(name), "/")
+	if dir != "" {
+		dir += "/"
+	}
+
+	var fis []os.FileInfo
+	err := fs.walkObjects(dir, func(obj *s3.Object) error {
+		name := strings.TrimPrefix(fs.keyName(*obj.Key), dir)
+		fis = append(fis, fs.newFileInfo(name, false, *obj.Size, *obj.LastModified))
+		return nil
+	})
+	return fis, err
+}
+
+// ReaddirPage lists up to max entries of a directory, directories first in each page, starting after the entry given
+// by startAfter. It returns the startAfter of the next page, which is empty once the whole directory is listed. Unlike
+// with Readdir, the listing can be resumed from anywhere, like from another process or request. An empty startAfter
+// lists the first page, and max defaults to the ListPageSize if it's not positive.
+func (fs *Fs) ReaddirPage(prefix, startAfter string, max int) ([]os.FileInfo, string, error) {
+	dir := strings.TrimPrefix(fs.key(fs.sanitize(prefix)), "/")
+	if dir != "" && !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+		Prefix:              aws.String(dir),
+		Delimiter:           aws.String("/"),
+		MaxKeys:             aws.Int64(fs.listPageSize()),
+	}
+	if max > 0 {
+		input.MaxKeys = aws.Int64(int64(max))
+	}
+	if startAfter != "" {
+		input.StartAfter = aws.String(dir + startAfter)
+	}
+	for {
+		output, err := fs.listObjects(input)
+		if err != nil {
+			return nil, "", permissionError(err)
+		}
+
+		fis := fs.listingInfos(output)
+		if !aws.BoolValue(output.IsTruncated) {
+			return fis, "", nil
+		}
+
+		// The common prefixes are skipped as a whole when listing after them
+		last := lastListed(output)
+		if len(fis) > 0 {
+			return fis, strings.TrimPrefix(last, dir), nil
+		}
+		// A page only listing the marker of the directory is skipped
+		input.StartAfter = aws.String(last)
+	}
+}
+
+// ListRaw performs a listing and returns its output as is, for the details FileInfo doesn't provide, like the owner
+// or the storage class of the objects. The bucket of the Fs is set on a copy of the input, the keys aren't scoped to
+// the prefix of the Fs nor decoded, and the pagination is left to the caller.
+func (fs *Fs) ListRaw(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	in := *input
+	in.Bucket = aws.String(fs.Bucket)
+	if in.ExpectedBucketOwner == nil {
+		in.ExpectedBucketOwner = fs.ExpectedBucketOwner
+	}
+
+	output, err := fs.listObjects(&in)
+	return output, permissionError(err)
+}
+
+// lastListed returns the last key or common prefix of a listing
+func lastListed(output *s3.ListObjectsV2Output) string {
+	var last string
+	if n := len(output.Contents); n > 0 {
+		last = aws.StringValue(output.Contents[n-1].Key)
+	}
+	if n := len(output.CommonPrefixes); n > 0 && aws.StringValue(output.CommonPrefixes[n-1].Prefix) > last {
+		last = aws.StringValue(output.CommonPrefixes[n-1].Prefix)
+	}
+	return last
+}
+
+// MultipartUploadInfo describes a multipart upload that was neither completed nor aborted
+type MultipartUploadInfo struct {
+	Name      string    // Name of the file being uploaded
+	UploadID  string    // UploadID identifies the upload
+	Initiated time.Time // Initiated is when the upload was created
+}
+
+// ListMultipartUploads lists the incomplete multipart uploads of the files under a prefix
+func (fs *Fs) ListMultipartUploads(prefix string) ([]MultipartUploadInfo, error) {
+	input := &s3.ListMultipartUploadsInput{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+		Prefix:              aws.String(strings.TrimPrefix(fs.key(fs.sanitize(prefix)), "/")),
+	}
+
+	var uploads []MultipartUploadInfo
+	for {
+		output, err := fs.S3API.ListMultipartUploadsWithContext(aws.BackgroundContext(), input, fs.requestOptions()...)
+		if err != nil {
+			return nil, permissionError(err)
+		}
+
+		for _, upload := range output.Uploads {
+			uploads = append(uploads, MultipartUploadInfo{
+				Name:      fs.keyName(aws.StringValue(upload.Key)),
+				UploadID:  aws.StringValue(upload.UploadId),
+				Initiated: aws.TimeValue(upload.Initiated),
+			})
+		}
+
+		if !aws.BoolValue(output.IsTruncated) {
+			return uploads, nil
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.UploadIdMarker = output.NextUploadIdMarker
+	}
+}
+
+// listObjects lists objects with ListObjectsV2, or with the legacy ListObjects for the servers that don't
+// implement it. The listing of ListObjects is converted to a ListObjectsV2 one, markers being used as continuation
+// tokens.
+func (fs Fs) listObjects(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	if !fs.ListObjectsV1 {
+		output, err := fs.S3API.ListObjectsV2WithContext(aws.BackgroundContext(), input, fs.requestOptions()...)
+		if !isNotImplemented(err) {
+			return output, err
+		}
+	}
+
+	marker := input.StartAfter
+	if input.ContinuationToken != nil {
+		marker = input.ContinuationToken
+	}
+	output, err := fs.S3API.ListObjectsWithContext(aws.BackgroundContext(), &s3.ListObjectsInput{
+		Bucket:              input.Bucket,
+		ExpectedBucketOwner: input.ExpectedBucketOwner,
+		Prefix:              input.Prefix,
+		Delimiter:           input.Delimiter,
+		MaxKeys:             input.MaxKeys,
+		Marker:              marker,
+		RequestPayer:        input.RequestPayer,
+	}, fs.requestOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	outputV2 := &s3.ListObjectsV2Output{
+		Name:           output.Name,
+		Prefix:         output.Prefix,
+		Delimiter:      output.Delimiter,
+		MaxKeys:        output.MaxKeys,
+		Contents:       output.Contents,
+		CommonPrefixes: output.CommonPrefixes,
+		IsTruncated:    aws.Bool(aws.BoolValue(output.IsTruncated)),
+		KeyCount:       aws.Int64(int64(len(output.Contents) + len(output.CommonPrefixes))),
+	}
+	if *outputV2.IsTruncated {
+		// NextMarker is only returned with a delimiter, otherwise the last key is the marker
+		outputV2.NextContinuationToken = output.NextMarker
+		if outputV2.NextContinuationToken == nil && len(output.Contents) > 0 {
+			outputV2.NextContinuationToken = output.Contents[len(output.Contents)-1].Key
+		}
+	}
+	return outputV2, nil
+}
+
+// isNotImplemented checks if an error means the server doesn't implement the operation
+func isNotImplemented(err error) bool {
+	var errRequestFailure awserr.RequestFailure
+	if errors.As(err, &errRequestFailure) && errRequestFailure.StatusCode() == http.StatusNotImplemented {
+		return true
+	}
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == "NotImplemented"
+}
+
+// ListDirs lists the names of the immediate sub-directories of a directory, ignoring the files it contains.
+func (fs *Fs) ListDirs(prefix string) ([]string, error) {
+	dir := strings.Trim(fs.key(fs.sanitize(prefix)), "/")
+	if dir != "" {
+		dir += "/"
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+		Prefix:              aws.String(dir),
+		Delimiter:           aws.String("/"),
+		MaxKeys:             aws.Int64(fs.listPageSize()),
+	}
+	var dirs []string
+	for {
+		output, err := fs.listObjects(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, commonPrefix := range output.CommonPrefixes {
+			dirs = append(dirs, fs.decodeKey(strings.TrimSuffix(strings.TrimPrefix(*commonPrefix.Prefix, dir), "/")))
+		}
+
+		if !aws.BoolValue(output.IsTruncated) {
+			return dirs, nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
+
+// walkObjects calls fn on every object under a prefix, directory markers excluded. It goes through all the pages
+// of the listing.
+func (fs *Fs) walkObjects(prefix string, fn func(obj *s3.Object) error) error {
+	return fs.walkAllObjects(prefix, func(obj *s3.Object) error {
+		if strings.HasSuffix(*obj.Key, "/") {
+			return nil
+		}
+		return fn(obj)
+	})
+}
+
+// dirPrefix returns the prefix of the files under a directory, with a trailing slash so that the files sharing its
+// name as a prefix, like "dir-other/file" for "dir", aren't listed. The root gives an empty prefix.
+func (fs *Fs) dirPrefix(name string) string {
+	dir := strings.Trim(fs.sanitize(name), "/")
+	if dir != "" {
+		dir += "/"
+	}
+	return dir
+}
+
+// walkAllObjects calls fn on every object under a prefix, directory markers included
+func (fs *Fs) walkAllObjects(prefix string, fn func(obj *s3.Object) error) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+		Prefix:              aws.String(strings.TrimPrefix(fs.key(prefix), "/")),
+		MaxKeys:             aws.Int64(fs.listPageSize()),
+	}
+	for {
+		output, err := fs.listObjects(input)
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range output.Contents {
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+
+		if !aws.BoolValue(output.IsTruncated) {
+			return nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
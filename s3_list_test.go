@@ -0,0 +1,316 @@
+package s3
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func fileInfoNames(fis []os.FileInfo) []string {
+	names := make([]string, len(fis))
+	for i, fi := range fis {
+		names[i] = fi.Name()
+	}
+	return names
+}
+
+func TestListModifiedSince(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	cutoff := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	mock.putObject("bucket", "logs/old", []byte("old"), cutoff.Add(-time.Hour))
+	mock.putObject("bucket", "logs/new", []byte("new"), cutoff.Add(time.Hour))
+	mock.putObject("bucket", "logs/2021/newer", []byte("newer"), cutoff.Add(2*time.Hour))
+	mock.putObject("bucket", "logs/2021/", nil, cutoff.Add(2*time.Hour))
+	mock.putObject("bucket", "other/new", []byte("new"), cutoff.Add(time.Hour))
+
+	fis, err := fs.ListModifiedSince("logs/", cutoff)
+	req.NoError(err)
+	req.Equal([]string{"logs/2021/newer", "logs/new"}, fileInfoNames(fis))
+	req.Equal(int64(5), fis[0].Size())
+	req.Equal(cutoff.Add(2*time.Hour), fis[0].ModTime())
+
+	t.Run("Paging", func(t *testing.T) {
+		for i := 0; i < 1500; i++ {
+			mock.putObject("bucket", "many/"+time.Duration(i).String(), nil, cutoff.Add(time.Minute))
+		}
+		mock.resetCalls()
+
+		fis, err := fs.ListModifiedSince("many", cutoff)
+		req.NoError(err)
+		req.Len(fis, 1500)
+		req.Equal(2, mock.count("ListObjectsV2"))
+	})
+}
+
+func TestListDirs(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	mock.putObject("bucket", "data/file", []byte("file"), time.Now())
+	mock.putObject("bucket", "data/2020/file", []byte("file"), time.Now())
+	mock.putObject("bucket", "data/2021/", nil, time.Now())
+	mock.putObject("bucket", "data/2021/01/file", []byte("file"), time.Now())
+	mock.putObject("bucket", "other/file", []byte("file"), time.Now())
+
+	dirs, err := fs.ListDirs("/data")
+	req.NoError(err)
+	req.Equal([]string{"2020", "2021"}, dirs)
+
+	dirs, err = fs.ListDirs("/")
+	req.NoError(err)
+	req.Equal([]string{"data", "other"}, dirs)
+
+	dirs, err = fs.ListDirs("/data/2020")
+	req.NoError(err)
+	req.Empty(dirs)
+}
+
+func TestListObjectsV1(t *testing.T) {
+	req := require.New(t)
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Fallback", nil},
+		{"Forced", []Option{WithListObjectsV1()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, mock := newMockFs(t, tc.opts...)
+			mock.hook = func(op string, input interface{}) error {
+				if op == "ListObjectsV2" {
+					return awserr.NewRequestFailure(awserr.New("NotImplemented", "Not Implemented", nil), 501, "mock")
+				}
+				return nil
+			}
+
+			for i := 0; i < 150; i++ {
+				mock.putObject("bucket", fmt.Sprintf("dir/file-%03d", i), []byte("content"), time.Now())
+			}
+			mock.putObject("bucket", "dir/sub/file", []byte("content"), time.Now())
+
+			info, err := fs.Stat("/dir")
+			req.NoError(err)
+			req.True(info.IsDir())
+
+			dir, err := fs.Open("/dir")
+			req.NoError(err)
+			fis, err := dir.Readdir(-1)
+			req.NoError(err)
+			req.Len(fis, 151)
+			req.Contains(fileInfoNames(fis), "sub")
+			req.NoError(dir.Close())
+
+			fis, err = fs.ListModifiedSince("/dir", time.Time{})
+			req.NoError(err)
+			req.Len(fis, 151)
+
+			if tc.opts != nil {
+				req.Zero(mock.count("ListObjectsV2"))
+			}
+			req.NotZero(mock.count("ListObjects"))
+		})
+	}
+
+	t.Run("OtherErrors", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		mock.hook = func(op string, input interface{}) error {
+			return awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "mock")
+		}
+		_, err := fs.ListDirs("/")
+		req.Error(err)
+		req.Zero(mock.count("ListObjects"))
+	})
+}
+
+func TestReaddirAllRecursive(t *testing.T) {
+	req := require.New(t)
+
+	for _, prefix := range []string{"", "tenant"} {
+		t.Run("Prefix="+prefix, func(t *testing.T) {
+			fs, mock := newMockFs(t, WithPrefix(prefix))
+			key := func(name string) string {
+				if prefix == "" {
+					return name
+				}
+				return prefix + "/" + name
+			}
+
+			for _, name := range []string{"export/a", "export/sub/b", "export/sub/deeper/c", "exported", "other/d"} {
+				mock.putObject("bucket", key(name), []byte(name), time.Now())
+			}
+			mock.putObject("bucket", key("export/sub/"), nil, time.Now())
+
+			fis, err := fs.ReaddirAll("/export")
+			req.NoError(err)
+			req.Equal([]string{"a", "sub/b", "sub/deeper/c"}, fileInfoNames(fis))
+			req.EqualValues(len("export/sub/b"), fis[1].Size())
+
+			fis, err = fs.ReaddirAll("/export/sub/")
+			req.NoError(err)
+			req.Equal([]string{"b", "deeper/c"}, fileInfoNames(fis))
+
+			fis, err = fs.ReaddirAll("/")
+			req.NoError(err)
+			req.Len(fis, 5)
+		})
+	}
+}
+
+func TestListMultipartUploads(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithPrefix("data"))
+
+	initiated := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, key := range []string{"data/logs/b.log", "data/logs/a.log", "data/other/c.log"} {
+		out, err := mock.CreateMultipartUploadWithContext(aws.BackgroundContext(), &s3.CreateMultipartUploadInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String(key),
+		})
+		req.NoError(err)
+		mock.uploads[*out.UploadId].initiated = initiated.Add(time.Duration(i) * time.Hour)
+	}
+
+	uploads, err := fs.ListMultipartUploads("/logs")
+	req.NoError(err)
+	req.Len(uploads, 2)
+	req.Equal("logs/a.log", uploads[0].Name)
+	req.Equal(initiated.Add(time.Hour), uploads[0].Initiated)
+	req.Equal("logs/b.log", uploads[1].Name)
+	req.Equal(initiated, uploads[1].Initiated)
+	req.NotEqual(uploads[0].UploadID, uploads[1].UploadID)
+	req.Equal("data/logs/a.log", mock.uploads[uploads[0].UploadID].key)
+	req.Equal("data/logs/b.log", mock.uploads[uploads[1].UploadID].key)
+	req.Equal("data/logs", aws.StringValue(mock.lastInput("ListMultipartUploads").(*s3.ListMultipartUploadsInput).Prefix))
+}
+
+func TestReaddirPage(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	for _, key := range []string{"dir/", "dir/a", "dir/b", "dir/c", "dir/d", "dir/sub/x", "dir/sub/y", "dir/z", "other"} {
+		mock.putObject("bucket", key, nil, time.Now())
+	}
+
+	// The marker of the directory takes a place in the first page
+	fis, next, err := fs.ReaddirPage("/dir", "", 3)
+	req.NoError(err)
+	req.Equal([]string{"a", "b"}, fileInfoNames(fis))
+	req.Equal("b", next)
+
+	fis, next, err = fs.ReaddirPage("/dir", next, 3)
+	req.NoError(err)
+	req.Equal([]string{"sub", "c", "d"}, fileInfoNames(fis))
+	req.True(fis[0].IsDir())
+	req.Equal("sub/", next)
+
+	// The files of the sub-directory aren't listed again
+	fis, next, err = fs.ReaddirPage("/dir", next, 3)
+	req.NoError(err)
+	req.Equal([]string{"z"}, fileInfoNames(fis))
+	req.Empty(next)
+
+	t.Run("MarkerOnlyPage", func(t *testing.T) {
+		mock.resetCalls()
+		fis, next, err := fs.ReaddirPage("/dir", "", 1)
+		req.NoError(err)
+		req.Equal([]string{"a"}, fileInfoNames(fis))
+		req.Equal("a", next)
+		req.Equal(2, mock.count("ListObjectsV2"))
+
+		// Readdir skips it too
+		dir, err := fs.Open("/dir")
+		req.NoError(err)
+		fis, err = dir.Readdir(1)
+		req.NoError(err)
+		req.Equal([]string{"a"}, fileInfoNames(fis))
+		req.NoError(dir.Close())
+	})
+
+	t.Run("ListObjectsV1", func(t *testing.T) {
+		fs := NewFsWithOptions("bucket", nil, WithS3API(mock), WithListObjectsV1())
+		fis, next, err := fs.ReaddirPage("/dir", "b", 2)
+		req.NoError(err)
+		req.Equal([]string{"c", "d"}, fileInfoNames(fis))
+		req.Equal("d", next)
+	})
+}
+
+func TestListPageSize(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithListPageSize(2))
+	for _, key := range []string{"dir/a", "dir/b", "dir/c", "dir/sub/d", "dir/sub/e"} {
+		mock.putObject("bucket", key, nil, time.Now())
+	}
+
+	maxKeys := func() []int64 {
+		var sizes []int64
+		for _, input := range mock.inputs["ListObjectsV2"] {
+			sizes = append(sizes, aws.Int64Value(input.(*s3.ListObjectsV2Input).MaxKeys))
+		}
+		mock.resetCalls()
+		return sizes
+	}
+
+	dir, err := fs.Open("/dir")
+	req.NoError(err)
+	mock.resetCalls()
+	fis, err := dir.Readdir(0)
+	req.NoError(err)
+	req.Len(fis, 4)
+	req.Equal([]int64{2, 2}, maxKeys())
+
+	fis, err = fs.ReaddirAll("/dir")
+	req.NoError(err)
+	req.Len(fis, 5)
+	req.Equal([]int64{2, 2, 2}, maxKeys())
+
+	req.NoError(fs.RemoveAll("/dir"))
+	req.Empty(mock.buckets["bucket"])
+	for _, size := range maxKeys() {
+		req.Equal(int64(2), size)
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, size := range []int64{-1, 0, 1001} {
+			fs, mock := newMockFs(t, WithListPageSize(size))
+			_, err := fs.ReaddirAll("/")
+			req.NoError(err)
+			req.Equal(int64(1000), aws.Int64Value(mock.lastInput("ListObjectsV2").(*s3.ListObjectsV2Input).MaxKeys))
+		}
+	})
+}
+
+func TestListRaw(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "dir/a", []byte("a"), time.Now()).storageClass = aws.String(s3.StorageClassGlacier)
+	mock.putObject("bucket", "dir/b", []byte("bb"), time.Now())
+	mock.putObject("bucket", "other", nil, time.Now())
+
+	input := &s3.ListObjectsV2Input{Prefix: aws.String("dir/"), MaxKeys: aws.Int64(1)}
+	output, err := fs.ListRaw(input)
+	req.NoError(err)
+	req.Nil(input.Bucket)
+	req.Equal("bucket", aws.StringValue(mock.lastInput("ListObjectsV2").(*s3.ListObjectsV2Input).Bucket))
+
+	req.Len(output.Contents, 1)
+	req.Equal("dir/a", aws.StringValue(output.Contents[0].Key))
+	req.Equal(s3.StorageClassGlacier, aws.StringValue(output.Contents[0].StorageClass))
+	req.True(aws.BoolValue(output.IsTruncated))
+
+	input.ContinuationToken = output.NextContinuationToken
+	output, err = fs.ListRaw(input)
+	req.NoError(err)
+	req.Len(output.Contents, 1)
+	req.Equal("dir/b", aws.StringValue(output.Contents[0].Key))
+	req.Equal(int64(2), aws.Int64Value(output.Contents[0].Size))
+	req.False(aws.BoolValue(output.IsTruncated))
+}
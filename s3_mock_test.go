@@ -0,0 +1,917 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5" //nolint: gosec
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// mockObject is an object stored by the mockS3
+type mockObject struct {
+	lastModified    time.Time
+	contentType     *string
+	cacheControl    *string
+	contentEncoding *string
+	acl             *string
+	metadata        map[string]*string
+	etag            string
+	body            []byte
+	fakeSize        int64 // fakeSize replaces the size of the body when set, to simulate huge objects
+	checksumSHA256  *string
+	tagging         *string
+	grants          []*s3.Grant
+	sseCustomerKey  string // sseCustomerKey is the SSE-C key the object is encrypted with
+	storageClass    *string
+	versionID       *string // versionID is returned with the object, as if the bucket was versioned
+	expires         *string
+}
+
+func (o *mockObject) size() int64 {
+	if o.fakeSize > 0 {
+		return o.fakeSize
+	}
+	return int64(len(o.body))
+}
+
+// mockUpload is a multipart upload in progress in the mockS3
+type mockUpload struct {
+	bucket    string
+	key       string
+	object    *mockObject
+	initiated time.Time
+	parts     map[int64][]byte
+	sizes     map[int64]int64
+}
+
+// mockS3 is an in-memory S3 that only implements the calls performed by the Fs. Calling anything else panics
+// because of the nil embedded interface.
+type mockS3 struct {
+	s3iface.S3API
+	mu      sync.Mutex
+	buckets map[string]map[string]*mockObject
+	uploads map[string]*mockUpload
+	calls   []string
+	inputs  map[string][]interface{}
+	// hook is called with the lock held before each call is performed, the call fails with the error it returns
+	hook func(op string, input interface{}) error
+}
+
+func newMockS3() *mockS3 {
+	return &mockS3{
+		buckets: map[string]map[string]*mockObject{},
+		uploads: map[string]*mockUpload{},
+		inputs:  map[string][]interface{}{},
+	}
+}
+
+// newMockFs creates a Fs backed by a new mockS3
+func newMockFs(t *testing.T, opts ...Option) (*Fs, *mockS3) {
+	t.Helper()
+	mock := newMockS3()
+	fs := NewFsWithOptions("bucket", nil, append([]Option{WithS3API(mock)}, opts...)...)
+	return fs, mock
+}
+
+// record saves a call and its input, and runs the hook. It must be called with the lock held.
+func (m *mockS3) record(op string, input interface{}) error {
+	m.calls = append(m.calls, op)
+	m.inputs[op] = append(m.inputs[op], input)
+	if m.hook != nil {
+		return m.hook(op, input)
+	}
+	return nil
+}
+
+// count returns the number of times an operation was called
+func (m *mockS3) count(op string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.inputs[op])
+}
+
+// lastInput returns the input of the last call of an operation
+func (m *mockS3) lastInput(op string) interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inputs := m.inputs[op]
+	if len(inputs) == 0 {
+		return nil
+	}
+	return inputs[len(inputs)-1]
+}
+
+// resetCalls forgets about all the calls performed so far
+func (m *mockS3) resetCalls() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+	m.inputs = map[string][]interface{}{}
+}
+
+// mockKey mimics the SDK URI cleaning, which makes "/file" and "file" the same key
+func mockKey(key *string) string {
+	return strings.TrimLeft(aws.StringValue(key), "/")
+}
+
+func (m *mockS3) bucket(name *string) map[string]*mockObject {
+	b, ok := m.buckets[aws.StringValue(name)]
+	if !ok {
+		b = map[string]*mockObject{}
+		m.buckets[aws.StringValue(name)] = b
+	}
+	return b
+}
+
+// object returns an object, it must be called with the lock held
+func (m *mockS3) object(bucket, key *string) *mockObject {
+	return m.bucket(bucket)[mockKey(key)]
+}
+
+// putObject stores an object directly, bypassing the calls recording
+func (m *mockS3) putObject(bucket, key string, body []byte, lastModified time.Time) *mockObject {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj := &mockObject{body: body, lastModified: lastModified, etag: mockETag(body)}
+	m.bucket(aws.String(bucket))[mockKey(aws.String(key))] = obj
+	return obj
+}
+
+// getObject returns an object directly, bypassing the calls recording
+func (m *mockS3) getObject(bucket, key string) *mockObject {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.object(aws.String(bucket), aws.String(key))
+}
+
+func mockETag(body []byte) string {
+	sum := md5.Sum(body) //nolint: gosec
+	return "\"" + hex.EncodeToString(sum[:]) + "\""
+}
+
+// mockHeaders returns the headers the request options set
+func mockHeaders(opts []request.Option) http.Header {
+	r := &request.Request{HTTPRequest: &http.Request{Header: http.Header{}}}
+	r.ApplyOptions(opts...)
+	return r.HTTPRequest.Header
+}
+
+// checkConditions fails like S3 when the If-Match or If-None-Match headers of a write don't match an object
+func checkConditions(obj *mockObject, header http.Header) error {
+	ifMatch := header.Get("If-Match")
+	ifNoneMatch := header.Get("If-None-Match")
+	if (ifMatch != "" && (obj == nil || obj.etag != ifMatch)) || (ifNoneMatch == "*" && obj != nil) {
+		return awserr.NewRequestFailure(
+			awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil),
+			http.StatusPreconditionFailed, "mock",
+		)
+	}
+	return nil
+}
+
+// checkSSECustomerKey fails like S3 when an object isn't accessed with the SSE-C key it's encrypted with
+func checkSSECustomerKey(obj *mockObject, key *string) error {
+	if obj.sseCustomerKey != aws.StringValue(key) {
+		return awserr.NewRequestFailure(awserr.New("InvalidRequest", "The SSE-C key doesn't match", nil), 400, "mock")
+	}
+	return nil
+}
+
+func mockNotFound(code string) error {
+	return awserr.NewRequestFailure(awserr.New(code, "Not Found", nil), 404, "mock")
+}
+
+func (m *mockS3) HeadObjectWithContext(
+	_ aws.Context, in *s3.HeadObjectInput, _ ...request.Option,
+) (*s3.HeadObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("HeadObject", in); err != nil {
+		return nil, err
+	}
+	obj := m.object(in.Bucket, in.Key)
+	if obj == nil {
+		return nil, mockNotFound("NotFound")
+	}
+	if err := checkSSECustomerKey(obj, in.SSECustomerKey); err != nil {
+		return nil, err
+	}
+	return &s3.HeadObjectOutput{
+		ContentLength:   aws.Int64(obj.size()),
+		LastModified:    aws.Time(obj.lastModified),
+		ContentType:     obj.contentType,
+		CacheControl:    obj.cacheControl,
+		ContentEncoding: obj.contentEncoding,
+		Metadata:        obj.metadata,
+		ETag:            aws.String(obj.etag),
+		StorageClass:    obj.storageClass,
+		VersionId:       obj.versionID,
+		Expires:         obj.expires,
+	}, nil
+}
+
+func (m *mockS3) WaitUntilObjectExistsWithContext(
+	ctx aws.Context, in *s3.HeadObjectInput, _ ...request.WaiterOption,
+) error {
+	_, err := m.HeadObjectWithContext(ctx, in)
+	return err
+}
+
+// WaitUntilObjectNotExistsWithContext polls HeadObject like the SDK waiter, without any delay between attempts
+func (m *mockS3) WaitUntilObjectNotExistsWithContext(
+	ctx aws.Context, in *s3.HeadObjectInput, opts ...request.WaiterOption,
+) error {
+	w := request.Waiter{
+		Name:        "WaitUntilObjectNotExists",
+		MaxAttempts: 20,
+		Acceptors: []request.WaiterAcceptor{
+			{State: request.SuccessWaiterState, Matcher: request.StatusWaiterMatch, Expected: 404},
+		},
+		NewRequest: func(_ []request.Option) (*request.Request, error) {
+			req := request.New(
+				aws.Config{}, metadata.ClientInfo{Endpoint: "http://mock"}, request.Handlers{}, nil,
+				&request.Operation{Name: "HeadObject"}, in, &s3.HeadObjectOutput{},
+			)
+			req.SetContext(ctx)
+			req.Handlers.Send.PushBack(func(r *request.Request) {
+				r.HTTPResponse = &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}
+				if _, err := m.HeadObjectWithContext(r.Context(), in); err != nil {
+					r.Error = err
+					var reqErr awserr.RequestFailure
+					if errors.As(err, &reqErr) {
+						r.HTTPResponse.StatusCode = reqErr.StatusCode()
+					}
+				}
+			})
+			return req, nil
+		},
+	}
+	w.ApplyOptions(opts...)
+	w.Delay = request.ConstantWaiterDelay(0)
+	return w.WaitWithContext(ctx)
+}
+
+// parseRange parses a "bytes=start-end" header
+func parseRange(rng string, size int64) (int64, int64, error) {
+	bounds := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	end := size - 1
+	if len(bounds) == 2 && bounds[1] != "" {
+		if end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	if end >= size {
+		end = size - 1
+	}
+	return start, end, nil
+}
+
+func (m *mockS3) GetObjectWithContext(
+	_ aws.Context, in *s3.GetObjectInput, _ ...request.Option,
+) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("GetObject", in); err != nil {
+		return nil, err
+	}
+	obj := m.object(in.Bucket, in.Key)
+	if obj == nil {
+		return nil, mockNotFound("NoSuchKey")
+	}
+	if err := checkSSECustomerKey(obj, in.SSECustomerKey); err != nil {
+		return nil, err
+	}
+	body := obj.body
+	var contentRange *string
+	if in.Range != nil {
+		start, end, err := parseRange(*in.Range, int64(len(body)))
+		if err != nil {
+			return nil, err
+		}
+		if start >= int64(len(body)) {
+			return nil, awserr.NewRequestFailure(awserr.New("InvalidRange", "Range Not Satisfiable", nil),
+				http.StatusRequestedRangeNotSatisfiable, "mock")
+		}
+		body = body[start : end+1]
+		contentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj.body)))
+	}
+	var checksumSHA256 *string
+	if aws.StringValue(in.ChecksumMode) == s3.ChecksumModeEnabled {
+		checksumSHA256 = obj.checksumSHA256
+	}
+	return &s3.GetObjectOutput{
+		ChecksumSHA256:  checksumSHA256,
+		Body:            io.NopCloser(iotest.DataErrReader(bytes.NewReader(body))),
+		ContentLength:   aws.Int64(int64(len(body))),
+		ContentRange:    contentRange,
+		LastModified:    aws.Time(obj.lastModified),
+		ContentType:     obj.contentType,
+		CacheControl:    obj.cacheControl,
+		ContentEncoding: obj.contentEncoding,
+		Metadata:        obj.metadata,
+		ETag:            aws.String(obj.etag),
+		VersionId:       obj.versionID,
+	}, nil
+}
+
+// GetObjectRequest is only used by the uploader to build the location of multipart uploads
+func (m *mockS3) GetObjectRequest(in *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	out := &s3.GetObjectOutput{}
+	return request.New(
+		aws.Config{}, metadata.ClientInfo{Endpoint: "http://mock"}, request.Handlers{}, nil,
+		&request.Operation{Name: "GetObject"}, in, out,
+	), out
+}
+
+func (m *mockS3) PutObjectWithContext(
+	_ aws.Context, in *s3.PutObjectInput, opts ...request.Option,
+) (*s3.PutObjectOutput, error) {
+	var body []byte
+	if in.Body != nil {
+		var err error
+		if body, err = io.ReadAll(in.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("PutObject", in); err != nil {
+		return nil, err
+	}
+	if err := checkConditions(m.object(in.Bucket, in.Key), mockHeaders(opts)); err != nil {
+		return nil, err
+	}
+	obj := &mockObject{
+		body:            body,
+		lastModified:    time.Now().UTC(),
+		contentType:     in.ContentType,
+		cacheControl:    in.CacheControl,
+		contentEncoding: in.ContentEncoding,
+		acl:             in.ACL,
+		metadata:        in.Metadata,
+		etag:            mockETag(body),
+		tagging:         in.Tagging,
+		sseCustomerKey:  aws.StringValue(in.SSECustomerKey),
+		storageClass:    in.StorageClass,
+		grants:          mockGrants(in.GrantRead, in.GrantReadACP, in.GrantWriteACP, in.GrantFullControl),
+		expires:         mockExpires(in.Expires),
+	}
+	m.bucket(in.Bucket)[mockKey(in.Key)] = obj
+	return &s3.PutObjectOutput{ETag: aws.String(obj.etag)}, nil
+}
+
+// PutObjectRequest is used by the uploader for uploads fitting in a single part
+func (m *mockS3) PutObjectRequest(in *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput) {
+	out := &s3.PutObjectOutput{}
+	req := request.New(
+		aws.Config{}, metadata.ClientInfo{Endpoint: "http://mock"}, request.Handlers{}, nil,
+		&request.Operation{Name: "PutObject"}, in, out,
+	)
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		resp, err := m.PutObjectWithContext(r.Context(), in)
+		if err != nil {
+			r.Error = err
+			return
+		}
+		*out = *resp
+	})
+	return req, out
+}
+
+// mockGrants converts the x-amz-grant headers of a write, given in the order of their permissions, into the grants of
+// the ACL of the object
+func mockGrants(read, readACP, writeACP, fullControl *string) []*s3.Grant {
+	var grants []*s3.Grant
+	permissions := []string{s3.PermissionRead, s3.PermissionReadAcp, s3.PermissionWriteAcp, s3.PermissionFullControl}
+	for i, header := range []*string{read, readACP, writeACP, fullControl} {
+		if header == nil {
+			continue
+		}
+		for _, grantee := range strings.Split(*header, ",") {
+			kind, value, _ := strings.Cut(strings.TrimSpace(grantee), "=")
+			value = strings.Trim(value, `"`)
+			g := &s3.Grant{Permission: aws.String(permissions[i]), Grantee: &s3.Grantee{}}
+			switch kind {
+			case "id":
+				g.Grantee.Type, g.Grantee.ID = aws.String(s3.TypeCanonicalUser), aws.String(value)
+			case "uri":
+				g.Grantee.Type, g.Grantee.URI = aws.String(s3.TypeGroup), aws.String(value)
+			case "emailAddress":
+				g.Grantee.Type, g.Grantee.EmailAddress = aws.String(s3.TypeAmazonCustomerByEmail), aws.String(value)
+			}
+			grants = append(grants, g)
+		}
+	}
+	return grants
+}
+
+// mockExpires formats the Expires header of a write, as S3 returns it
+func mockExpires(expires *time.Time) *string {
+	if expires == nil {
+		return nil
+	}
+	return aws.String(expires.UTC().Format(http.TimeFormat))
+}
+
+func (m *mockS3) CreateMultipartUploadWithContext(
+	_ aws.Context, in *s3.CreateMultipartUploadInput, _ ...request.Option,
+) (*s3.CreateMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("CreateMultipartUpload", in); err != nil {
+		return nil, err
+	}
+	uploadID := fmt.Sprintf("upload-%d", len(m.calls))
+	m.uploads[uploadID] = &mockUpload{
+		bucket: aws.StringValue(in.Bucket),
+		key:    mockKey(in.Key),
+		object: &mockObject{
+			contentType:     in.ContentType,
+			cacheControl:    in.CacheControl,
+			contentEncoding: in.ContentEncoding,
+			acl:             in.ACL,
+			metadata:        in.Metadata,
+			tagging:         in.Tagging,
+			sseCustomerKey:  aws.StringValue(in.SSECustomerKey),
+			storageClass:    in.StorageClass,
+			grants:          mockGrants(in.GrantRead, in.GrantReadACP, in.GrantWriteACP, in.GrantFullControl),
+			expires:         mockExpires(in.Expires),
+		},
+		initiated: time.Now(),
+		parts:     map[int64][]byte{},
+		sizes:     map[int64]int64{},
+	}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(uploadID)}, nil
+}
+
+func (m *mockS3) UploadPartWithContext(
+	_ aws.Context, in *s3.UploadPartInput, _ ...request.Option,
+) (*s3.UploadPartOutput, error) {
+	body, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("UploadPart", in); err != nil {
+		return nil, err
+	}
+	upload, ok := m.uploads[aws.StringValue(in.UploadId)]
+	if !ok {
+		return nil, mockNotFound("NoSuchUpload")
+	}
+	upload.parts[aws.Int64Value(in.PartNumber)] = body
+	upload.sizes[aws.Int64Value(in.PartNumber)] = int64(len(body))
+	return &s3.UploadPartOutput{ETag: aws.String(mockETag(body))}, nil
+}
+
+func (m *mockS3) CompleteMultipartUploadWithContext(
+	_ aws.Context, in *s3.CompleteMultipartUploadInput, _ ...request.Option,
+) (*s3.CompleteMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("CompleteMultipartUpload", in); err != nil {
+		return nil, err
+	}
+	upload, ok := m.uploads[aws.StringValue(in.UploadId)]
+	if !ok {
+		return nil, mockNotFound("NoSuchUpload")
+	}
+	delete(m.uploads, aws.StringValue(in.UploadId))
+
+	var body []byte
+	var size int64
+	var sums []byte
+	for _, part := range in.MultipartUpload.Parts {
+		content := upload.parts[aws.Int64Value(part.PartNumber)]
+		sum := md5.Sum(content) //nolint: gosec
+		body = append(body, content...)
+		size += upload.sizes[aws.Int64Value(part.PartNumber)]
+		sums = append(sums, sum[:]...)
+	}
+	obj := upload.object
+	obj.body = body
+	if size != int64(len(body)) {
+		obj.fakeSize = size
+	}
+	obj.lastModified = time.Now().UTC()
+	obj.etag = fmt.Sprintf("%s-%d\"", strings.TrimSuffix(mockETag(sums), "\""), len(in.MultipartUpload.Parts))
+	m.bucket(aws.String(upload.bucket))[upload.key] = obj
+	return &s3.CompleteMultipartUploadOutput{ETag: aws.String(obj.etag)}, nil
+}
+
+func (m *mockS3) AbortMultipartUploadWithContext(
+	_ aws.Context, in *s3.AbortMultipartUploadInput, _ ...request.Option,
+) (*s3.AbortMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("AbortMultipartUpload", in); err != nil {
+		return nil, err
+	}
+	delete(m.uploads, aws.StringValue(in.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (m *mockS3) ListMultipartUploadsWithContext(
+	_ aws.Context, in *s3.ListMultipartUploadsInput, _ ...request.Option,
+) (*s3.ListMultipartUploadsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("ListMultipartUploads", in); err != nil {
+		return nil, err
+	}
+
+	out := &s3.ListMultipartUploadsOutput{Bucket: in.Bucket, Prefix: in.Prefix}
+	for id, upload := range m.uploads {
+		if upload.bucket == aws.StringValue(in.Bucket) && strings.HasPrefix(upload.key, aws.StringValue(in.Prefix)) {
+			out.Uploads = append(out.Uploads, &s3.MultipartUpload{
+				Key:       aws.String(upload.key),
+				UploadId:  aws.String(id),
+				Initiated: aws.Time(upload.initiated),
+			})
+		}
+	}
+	sort.Slice(out.Uploads, func(i, j int) bool {
+		return *out.Uploads[i].Key < *out.Uploads[j].Key
+	})
+	return out, nil
+}
+
+func (m *mockS3) HeadBucketWithContext(
+	_ aws.Context, in *s3.HeadBucketInput, _ ...request.Option,
+) (*s3.HeadBucketOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("HeadBucket", in); err != nil {
+		return nil, err
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (m *mockS3) CreateBucketWithContext(
+	_ aws.Context, in *s3.CreateBucketInput, _ ...request.Option,
+) (*s3.CreateBucketOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("CreateBucket", in); err != nil {
+		return nil, err
+	}
+	if _, ok := m.buckets[aws.StringValue(in.Bucket)]; ok {
+		return nil, awserr.NewRequestFailure(
+			awserr.New(s3.ErrCodeBucketAlreadyOwnedByYou, "Bucket already owned by you", nil), http.StatusConflict, "mock",
+		)
+	}
+	m.bucket(in.Bucket)
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func (m *mockS3) GetObjectTaggingWithContext(
+	_ aws.Context, in *s3.GetObjectTaggingInput, _ ...request.Option,
+) (*s3.GetObjectTaggingOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("GetObjectTagging", in); err != nil {
+		return nil, err
+	}
+	obj := m.object(in.Bucket, in.Key)
+	if obj == nil {
+		return nil, mockNotFound("NoSuchKey")
+	}
+	tags, err := url.ParseQuery(aws.StringValue(obj.tagging))
+	if err != nil {
+		return nil, err
+	}
+	out := &s3.GetObjectTaggingOutput{TagSet: []*s3.Tag{}}
+	for key, values := range tags {
+		out.TagSet = append(out.TagSet, &s3.Tag{Key: aws.String(key), Value: aws.String(values[0])})
+	}
+	return out, nil
+}
+
+func (m *mockS3) PutObjectTaggingWithContext(
+	_ aws.Context, in *s3.PutObjectTaggingInput, _ ...request.Option,
+) (*s3.PutObjectTaggingOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("PutObjectTagging", in); err != nil {
+		return nil, err
+	}
+	obj := m.object(in.Bucket, in.Key)
+	if obj == nil {
+		return nil, mockNotFound("NoSuchKey")
+	}
+	tags := url.Values{}
+	for _, tag := range in.Tagging.TagSet {
+		tags.Add(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+	}
+	obj.tagging = aws.String(tags.Encode())
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+func (m *mockS3) DeleteObjectWithContext(
+	_ aws.Context, in *s3.DeleteObjectInput, _ ...request.Option,
+) (*s3.DeleteObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("DeleteObject", in); err != nil {
+		return nil, err
+	}
+	delete(m.bucket(in.Bucket), mockKey(in.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (m *mockS3) DeleteObjectsWithContext(
+	_ aws.Context, in *s3.DeleteObjectsInput, _ ...request.Option,
+) (*s3.DeleteObjectsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("DeleteObjects", in); err != nil {
+		return nil, err
+	}
+	out := &s3.DeleteObjectsOutput{}
+	for _, obj := range in.Delete.Objects {
+		// The keys are sent as is in the body, they can't start with a slash
+		if strings.HasPrefix(*obj.Key, "/") {
+			out.Errors = append(out.Errors, &s3.Error{Key: obj.Key, Code: aws.String("NoSuchKey")})
+			continue
+		}
+		delete(m.bucket(in.Bucket), *obj.Key)
+		if !aws.BoolValue(in.Delete.Quiet) {
+			out.Deleted = append(out.Deleted, &s3.DeletedObject{Key: obj.Key})
+		}
+	}
+	return out, nil
+}
+
+func (m *mockS3) CopyObjectWithContext(
+	_ aws.Context, in *s3.CopyObjectInput, _ ...request.Option,
+) (*s3.CopyObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("CopyObject", in); err != nil {
+		return nil, err
+	}
+	src, err := m.copySource(in.CopySource)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSSECustomerKey(src, in.CopySourceSSECustomerKey); err != nil {
+		return nil, err
+	}
+	if src.size() > 5*1024*1024*1024 {
+		return nil, awserr.NewRequestFailure(awserr.New("InvalidRequest", "copy source is too large", nil), 400, "mock")
+	}
+	if src == m.object(in.Bucket, in.Key) && aws.StringValue(in.MetadataDirective) != s3.MetadataDirectiveReplace {
+		return nil, awserr.NewRequestFailure(awserr.New("InvalidRequest",
+			"This copy request is illegal because it is trying to copy an object to itself", nil), 400, "mock")
+	}
+	dst := *src
+	dst.lastModified = time.Now().UTC()
+	if aws.StringValue(in.MetadataDirective) == s3.MetadataDirectiveReplace {
+		dst.contentType = in.ContentType
+		dst.cacheControl = in.CacheControl
+		dst.contentEncoding = in.ContentEncoding
+		dst.metadata = in.Metadata
+	}
+	dst.sseCustomerKey = aws.StringValue(in.SSECustomerKey)
+	// Copies are STANDARD unless told otherwise, and keep their tags unless they are replaced
+	dst.storageClass = in.StorageClass
+	if aws.StringValue(in.TaggingDirective) == s3.TaggingDirectiveReplace {
+		dst.tagging = in.Tagging
+	}
+	if in.ACL != nil {
+		dst.acl = in.ACL
+	}
+	m.bucket(in.Bucket)[mockKey(in.Key)] = &dst
+	return &s3.CopyObjectOutput{CopyObjectResult: &s3.CopyObjectResult{
+		ETag:         aws.String(dst.etag),
+		LastModified: aws.Time(dst.lastModified),
+	}}, nil
+}
+
+// copySource returns the object a CopySource refers to, it must be called with the lock held
+func (m *mockS3) copySource(copySource *string) (*mockObject, error) {
+	// Like S3, "+" is decoded as a space and the key must be URL-encoded
+	if strings.ContainsAny(aws.StringValue(copySource), " ?#") {
+		return nil, awserr.New("InvalidArgument", "invalid copy source encoding", nil)
+	}
+	source, err := url.QueryUnescape(aws.StringValue(copySource))
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+	if len(parts) != 2 {
+		return nil, awserr.New("InvalidArgument", "invalid copy source", nil)
+	}
+	src := m.object(aws.String(parts[0]), aws.String(parts[1]))
+	if src == nil {
+		return nil, mockNotFound("NoSuchKey")
+	}
+	return src, nil
+}
+
+func (m *mockS3) UploadPartCopyWithContext(
+	_ aws.Context, in *s3.UploadPartCopyInput, _ ...request.Option,
+) (*s3.UploadPartCopyOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("UploadPartCopy", in); err != nil {
+		return nil, err
+	}
+	upload, ok := m.uploads[aws.StringValue(in.UploadId)]
+	if !ok {
+		return nil, mockNotFound("NoSuchUpload")
+	}
+	src, err := m.copySource(in.CopySource)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSSECustomerKey(src, in.CopySourceSSECustomerKey); err != nil {
+		return nil, err
+	}
+	start, end, err := parseRange(aws.StringValue(in.CopySourceRange), src.size())
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	if src.fakeSize == 0 {
+		body = src.body[start : end+1]
+	}
+	upload.parts[aws.Int64Value(in.PartNumber)] = body
+	upload.sizes[aws.Int64Value(in.PartNumber)] = end - start + 1
+	return &s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String(mockETag(body))}}, nil
+}
+
+func (m *mockS3) PutObjectAclWithContext(
+	_ aws.Context, in *s3.PutObjectAclInput, _ ...request.Option,
+) (*s3.PutObjectAclOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("PutObjectAcl", in); err != nil {
+		return nil, err
+	}
+	obj := m.object(in.Bucket, in.Key)
+	if obj == nil {
+		return nil, mockNotFound("NoSuchKey")
+	}
+	obj.acl = in.ACL
+	return &s3.PutObjectAclOutput{}, nil
+}
+
+func (m *mockS3) GetObjectAclWithContext(
+	_ aws.Context, in *s3.GetObjectAclInput, _ ...request.Option,
+) (*s3.GetObjectAclOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("GetObjectAcl", in); err != nil {
+		return nil, err
+	}
+	obj := m.object(in.Bucket, in.Key)
+	if obj == nil {
+		return nil, mockNotFound("NoSuchKey")
+	}
+	return &s3.GetObjectAclOutput{Grants: obj.grants}, nil
+}
+
+func (m *mockS3) ListObjectsV2WithContext(
+	_ aws.Context, in *s3.ListObjectsV2Input, _ ...request.Option,
+) (*s3.ListObjectsV2Output, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("ListObjectsV2", in); err != nil {
+		return nil, err
+	}
+
+	after := aws.StringValue(in.StartAfter)
+	if in.ContinuationToken != nil {
+		after = *in.ContinuationToken
+	}
+	list := m.list(in.Bucket, aws.StringValue(in.Prefix), aws.StringValue(in.Delimiter), after, in.MaxKeys)
+
+	out := &s3.ListObjectsV2Output{
+		Name:           in.Bucket,
+		Prefix:         in.Prefix,
+		Contents:       list.contents,
+		CommonPrefixes: list.commonPrefixes,
+		IsTruncated:    aws.Bool(list.truncated),
+		KeyCount:       aws.Int64(int64(len(list.contents) + len(list.commonPrefixes))),
+	}
+	if list.truncated {
+		out.NextContinuationToken = aws.String(list.last)
+	}
+	return out, nil
+}
+
+func (m *mockS3) ListObjectsWithContext(
+	_ aws.Context, in *s3.ListObjectsInput, _ ...request.Option,
+) (*s3.ListObjectsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("ListObjects", in); err != nil {
+		return nil, err
+	}
+
+	list := m.list(
+		in.Bucket, aws.StringValue(in.Prefix), aws.StringValue(in.Delimiter), aws.StringValue(in.Marker), in.MaxKeys,
+	)
+
+	out := &s3.ListObjectsOutput{
+		Name:           in.Bucket,
+		Prefix:         in.Prefix,
+		Marker:         in.Marker,
+		Contents:       list.contents,
+		CommonPrefixes: list.commonPrefixes,
+		IsTruncated:    aws.Bool(list.truncated),
+	}
+	// Like S3, NextMarker is only returned with a delimiter
+	if list.truncated && in.Delimiter != nil {
+		out.NextMarker = aws.String(list.last)
+	}
+	return out, nil
+}
+
+// mockListing is a page of the listing of a bucket
+type mockListing struct {
+	contents       []*s3.Object
+	commonPrefixes []*s3.CommonPrefix
+	truncated      bool
+	last           string // last is the last key or common prefix listed
+}
+
+// list lists a page of a bucket after a key, it must be called with the lock held
+func (m *mockS3) list(bucketName *string, prefix, delimiter, after string, maxKeysParam *int64) mockListing {
+	bucket := m.bucket(bucketName)
+	keys := make([]string, 0, len(bucket))
+	for key := range bucket {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	maxKeys := aws.Int64Value(maxKeysParam)
+	if maxKeysParam == nil {
+		maxKeys = 1000
+	}
+
+	var list mockListing
+	var count int64
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix := key[:len(prefix)+i+len(delimiter)]
+				if commonPrefix == list.last || commonPrefix <= after {
+					continue
+				}
+				if count == maxKeys {
+					list.truncated = true
+					break
+				}
+				list.commonPrefixes = append(list.commonPrefixes, &s3.CommonPrefix{Prefix: aws.String(commonPrefix)})
+				count++
+				list.last = commonPrefix
+				continue
+			}
+		}
+		if count == maxKeys {
+			list.truncated = true
+			break
+		}
+		obj := bucket[key]
+		list.contents = append(list.contents, &s3.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(obj.size()),
+			LastModified: aws.Time(obj.lastModified),
+			ETag:         aws.String(obj.etag),
+			StorageClass: obj.storageClass,
+		})
+		count++
+		list.last = key
+	}
+	return list
+}
@@ -0,0 +1,260 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Option configures an Fs created with NewFsWithOptions
+type Option func(*Fs)
+
+// WithRawMode disables the path sanitation
+func WithRawMode() Option {
+	return func(fs *Fs) {
+		fs.RawMode = true
+	}
+}
+
+// WithKeySanitizer encodes the names into keys with a KeySanitizer, like SafeKeySanitizer, and decodes the listed keys
+func WithKeySanitizer(sanitizer KeySanitizer) Option {
+	return func(fs *Fs) {
+		fs.KeySanitizer = sanitizer
+	}
+}
+
+// WithPermACL sets the ACL of the files created with OpenFile or Mkdir from the permissions they are created with,
+// like Chmod does, unless the file properties define an ACL. Create doesn't have any permissions and isn't affected.
+func WithPermACL() Option {
+	return func(fs *Fs) {
+		fs.PermACL = true
+	}
+}
+
+// WithLazyOpen makes opening a file for reading perform no request. The first read fetches its content and its
+// FileInfo with a single GetObject, instead of a HeadObject followed by a GetObject. Missing files are only reported
+// by the first read, with an error matching os.ErrNotExist.
+func WithLazyOpen() Option {
+	return func(fs *Fs) {
+		fs.LazyOpen = true
+	}
+}
+
+// WithoutDirMarkers doesn't create the empty "dir/" objects marking the directories. Directories then only exist
+// through the files they contain, and Mkdir does nothing.
+func WithoutDirMarkers() Option {
+	return func(fs *Fs) {
+		fs.DisableDirMarkers = true
+	}
+}
+
+// WithSSECustomerKey encrypts the files with a 256-bit key provided by the customer (SSE-C). The key is sent with all
+// the requests reading, writing or copying files, which requires HTTPS.
+func WithSSECustomerKey(key []byte) Option {
+	return func(fs *Fs) {
+		fs.SSECustomerKey = string(key)
+	}
+}
+
+// WithMaxObjectSize aborts the writes of the files bigger than size bytes: the write exceeding it and all the
+// following ones fail with ErrObjectTooLarge, and the file isn't uploaded.
+func WithMaxObjectSize(size int64) Option {
+	return func(fs *Fs) {
+		fs.MaxObjectSize = size
+	}
+}
+
+// WithSoftDelete makes Remove, RemoveAll and the bulk removals, like RemoveMatching, Purge and SweepExpired, move the
+// files under a trash directory, like ".trash", instead of deleting them, so that they can be recovered. The files keep
+// their path in the trash, and are deleted when they are removed from it.
+func WithSoftDelete(trashPrefix string) Option {
+	return func(fs *Fs) {
+		fs.TrashPrefix = trashPrefix
+	}
+}
+
+// WithMultipartETagVerification checks that the ETag of the files uploaded in parts is the one expected from the MD5
+// of their parts, and makes the upload fail with ErrChecksumMismatch otherwise. The object is then left as it was
+// uploaded, to be written again or removed. The files encrypted with SSE-KMS or SSE-C don't have such ETags and
+// aren't verified.
+func WithMultipartETagVerification() Option {
+	return func(fs *Fs) {
+		fs.VerifyMultipartETag = true
+	}
+}
+
+// WithClock defines the clock giving the times S3 doesn't store, like the modification time of the directories,
+// instead of time.Now. A fixed clock makes them deterministic.
+func WithClock(clock func() time.Time) Option {
+	return func(fs *Fs) {
+		fs.Clock = clock
+	}
+}
+
+// WithBypassGovernanceRetention makes the removals of files bypass their governance-mode object lock, which
+// requires the s3:BypassGovernanceRetention permission. Files under compliance-mode locks still can't be removed.
+func WithBypassGovernanceRetention() Option {
+	return func(fs *Fs) {
+		fs.BypassGovernance = true
+	}
+}
+
+// WithDefaultPerms defines the mode of the files and directories reported by their FileInfo, instead of 0644 and 0755.
+// S3 doesn't store any permissions, this only helps the code checking them.
+func WithDefaultPerms(filePerm, dirPerm os.FileMode) Option {
+	return func(fs *Fs) {
+		fs.DefaultFilePerm = filePerm
+		fs.DefaultDirPerm = dirPerm
+	}
+}
+
+// WithAutoCreateBucket creates the bucket when writing a file fails because it doesn't exist, and retries the write
+// once. This is meant for development environments, the bucket is created with the default settings.
+func WithAutoCreateBucket() Option {
+	return func(fs *Fs) {
+		fs.AutoCreateBucket = true
+	}
+}
+
+// WithListPageSize defines the number of keys listed per request, from 1 to 1000, instead of 1000. Smaller pages
+// are returned faster, at the cost of more requests. It applies to the listings of Readdir, RemoveAll and the
+// recursive listings, except when Readdir is given a number of entries.
+func WithListPageSize(size int64) Option {
+	return func(fs *Fs) {
+		fs.ListPageSize = size
+	}
+}
+
+// WithHeadObjectFallback makes Stat look files up with a GetObject of their first byte when HeadObject is denied, for
+// the buckets whose policy only allows GetObject. It costs a request more for the files that can't be read either.
+func WithHeadObjectFallback() Option {
+	return func(fs *Fs) {
+		fs.HeadObjectFallback = true
+	}
+}
+
+// WithFileOverDir lets Create write a file named like an existing directory, like "dir" when "dir/file" exists,
+// instead of failing with syscall.EISDIR. This saves the listing checking it.
+func WithFileOverDir() Option {
+	return func(fs *Fs) {
+		fs.AllowFileOverDir = true
+	}
+}
+
+// WithBucketCheck makes the first write check that the bucket exists with a HeadBucket, so that writing to a missing
+// bucket fails right away with ErrNoSuchBucket, without uploading anything. Creating or opening a file for writing
+// fails instead of its first write. The bucket is checked until it's found to exist. It has no effect with
+// WithAutoCreateBucket.
+func WithBucketCheck() Option {
+	return func(fs *Fs) {
+		fs.bucketCheck = &bucketCheck{}
+	}
+}
+
+// WithMaxConcurrentUploads limits the number of requests sending the content of files at the same time, across all
+// the files written with the Fs, like with UploadTree or many open files. Each upload still sends its parts
+// concurrently, but waits for a free slot to send each of them. A limit of 0 or less means no limit.
+func WithMaxConcurrentUploads(limit int) Option {
+	return func(fs *Fs) {
+		if limit > 0 {
+			fs.uploadSlots = make(chan struct{}, limit)
+		} else {
+			fs.uploadSlots = nil
+		}
+	}
+}
+
+// WithFileProps defines the file properties to set for all new files
+func WithFileProps(props *UploadedFileProperties) Option {
+	return func(fs *Fs) {
+		fs.FileProps = props
+	}
+}
+
+// WithPrefix scopes all the keys to a prefix of the bucket
+func WithPrefix(prefix string) Option {
+	return func(fs *Fs) {
+		fs.Prefix = prefix
+	}
+}
+
+// WithRequestTimeout aborts the requests that aren't answered within the timeout
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(fs *Fs) {
+		fs.RequestTimeout = timeout
+	}
+}
+
+// WithS3API defines the client performing the requests, instead of creating one from the session
+func WithS3API(api s3iface.S3API) Option {
+	return func(fs *Fs) {
+		fs.S3API = api
+	}
+}
+
+// WithStatCache makes Stat use the entries listed by Readdir during the ttl, instead of performing any request
+func WithStatCache(ttl time.Duration) Option {
+	return func(fs *Fs) {
+		fs.statCache = newStatCache(ttl)
+	}
+}
+
+// WithWriteCache keeps the content of the files written during the ttl, so that reading them right after they are
+// closed doesn't perform any request. The least recently used files are evicted once more than maxBytes are kept,
+// and larger files aren't cached.
+func WithWriteCache(ttl time.Duration, maxBytes int64) Option {
+	return func(fs *Fs) {
+		fs.writeCache = newWriteCache(ttl, maxBytes)
+	}
+}
+
+// WithTempFileWrites buffers the content written to files in temporary files of a directory, instead of memory.
+// They are uploaded when the files are closed. An empty dir means the default temporary directory.
+func WithTempFileWrites(dir string) Option {
+	return func(fs *Fs) {
+		fs.TempFileWrites = true
+		fs.TempDir = dir
+	}
+}
+
+// WithExpectedBucketOwner makes all the requests fail if the bucket isn't owned by this account id
+func WithExpectedBucketOwner(accountID string) Option {
+	return func(fs *Fs) {
+		fs.ExpectedBucketOwner = &accountID
+	}
+}
+
+// WithRetryer replaces the retry policy of the client for all the requests, like with a SlowDownRetryer
+func WithRetryer(retryer request.Retryer) Option {
+	return func(fs *Fs) {
+		fs.Retryer = retryer
+	}
+}
+
+// WithCreateIfMissing makes Create keep the content of existing files, instead of resetting them with an empty
+// object, unless something is written to them. This makes retrying a Create safe when the content might have been
+// written in between.
+func WithCreateIfMissing() Option {
+	return func(fs *Fs) {
+		fs.CreateIfMissing = true
+	}
+}
+
+// WithListObjectsV1 lists with the legacy ListObjects, for the servers that don't implement ListObjectsV2. Without
+// it, listings fall back to ListObjects when ListObjectsV2 is reported as not implemented, at the cost of a request.
+func WithListObjectsV1() Option {
+	return func(fs *Fs) {
+		fs.ListObjectsV1 = true
+	}
+}
+
+// WithUnsignedPayload sends the content of files with an "UNSIGNED-PAYLOAD" hash, instead of signing it. This avoids
+// reading it twice, and helps with the proxies that reject the chunk-signed uploads. It should only be used over HTTPS.
+func WithUnsignedPayload() Option {
+	return func(fs *Fs) {
+		fs.UnsignedPayload = true
+	}
+}
@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFsWithOptions(t *testing.T) {
+	req := require.New(t)
+
+	t.Run("Defaults", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		req.Equal("bucket", fs.Bucket)
+		req.Equal(mock, fs.S3API)
+		req.False(fs.RawMode)
+		req.False(fs.DisableDirMarkers)
+		req.Nil(fs.FileProps)
+		req.Empty(fs.Prefix)
+		req.Len(fs.requestOptions(), 1)
+	})
+
+	t.Run("FileProps", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithFileProps(&UploadedFileProperties{CacheControl: aws.String("max-age=300")}))
+
+		testCreateFile(t, fs, "file", "content")
+
+		req.Equal("max-age=300", aws.StringValue(mock.getObject("bucket", "file").cacheControl))
+	})
+
+	t.Run("Prefix", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithPrefix("scope/"))
+
+		testCreateFile(t, fs, "/dir/file", "content")
+		req.NotNil(mock.getObject("bucket", "scope/dir/file"))
+
+		info, err := fs.Stat("/dir/file")
+		req.NoError(err)
+		req.Equal(int64(7), info.Size())
+
+		dir, err := fs.Open("/dir")
+		req.NoError(err)
+		names, err := dir.Readdirnames(-1)
+		req.NoError(err)
+		req.Equal([]string{"file"}, names)
+	})
+
+	t.Run("RawMode", func(t *testing.T) {
+		fs, mock := newMockFs(t, WithRawMode())
+
+		_, err := fs.Stat("dir\\file")
+		req.Error(err)
+		req.Equal("dir\\file", *mock.lastInput("HeadObject").(*s3.HeadObjectInput).Key)
+	})
+
+	t.Run("RequestTimeout", func(t *testing.T) {
+		fs, _ := newMockFs(t, WithRequestTimeout(time.Second))
+		req.Equal(time.Second, fs.RequestTimeout)
+		req.Len(fs.requestOptions(), 2)
+	})
+}
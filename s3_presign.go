@@ -0,0 +1,126 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const postPolicyAlgorithm = "AWS4-HMAC-SHA256"
+
+// PostCondition restricts the form fields a presigned POST accepts
+type PostCondition struct {
+	condition interface{} // condition as it appears in the policy document
+	field     string      // field is a form field the condition requires, if any
+	value     string      // value of the required field
+}
+
+// PostEquals requires a form field, like "Content-Type" or "acl", to have a value. The field is part of the
+// returned form fields.
+func PostEquals(field, value string) PostCondition {
+	return PostCondition{
+		condition: []string{"eq", "$" + field, value},
+		field:     field,
+		value:     value,
+	}
+}
+
+// PostStartsWith requires a form field to start with a prefix, an empty prefix allows any value
+func PostStartsWith(field, prefix string) PostCondition {
+	return PostCondition{condition: []string{"starts-with", "$" + field, prefix}}
+}
+
+// PostContentLengthRange requires the size of the uploaded file to be between min and max bytes
+func PostContentLengthRange(min, max int64) PostCondition {
+	return PostCondition{condition: []interface{}{"content-length-range", min, max}}
+}
+
+// PresignPost creates a presigned POST allowing browsers to upload a file with an HTML form. The form is sent to
+// the returned URL, with the returned fields and the content of the file in a last "file" field.
+func (fs *Fs) PresignPost(
+	name string, expiry time.Duration, conditions ...PostCondition,
+) (url string, fields map[string]string, err error) {
+	if name = fs.sanitize(name); isRoot(name) {
+		return "", nil, rootError("presign", name)
+	}
+
+	// The request is only built to get the URL of the bucket and the signing configuration of the client
+	r, _ := fs.S3API.HeadBucketRequest(&s3.HeadBucketInput{Bucket: aws.String(fs.Bucket)})
+	if err := r.Build(); err != nil {
+		return "", nil, err
+	}
+
+	creds, err := r.Config.Credentials.GetWithContext(aws.BackgroundContext())
+	if err != nil {
+		return "", nil, err
+	}
+
+	region := r.ClientInfo.SigningRegion
+	if region == "" {
+		region = aws.StringValue(r.Config.Region)
+	}
+
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, region)
+
+	fields = map[string]string{
+		"key":              strings.TrimPrefix(fs.key(name), "/"),
+		"x-amz-algorithm":  postPolicyAlgorithm,
+		"x-amz-credential": creds.AccessKeyID + "/" + scope,
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+	}
+
+	policyConditions := []interface{}{map[string]string{"bucket": fs.Bucket}}
+	for field, value := range fields {
+		policyConditions = append(policyConditions, map[string]string{field: value})
+	}
+	for _, c := range conditions {
+		policyConditions = append(policyConditions, c.condition)
+		if c.field != "" {
+			fields[c.field] = c.value
+		}
+	}
+
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": now.Add(expiry).Format("2006-01-02T15:04:05.000Z"),
+		"conditions": policyConditions,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	fields["policy"] = base64.StdEncoding.EncodeToString(policy)
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(postSigningKey(creds.SecretAccessKey, date, region),
+		fields["policy"]))
+
+	u := *r.HTTPRequest.URL
+	u.RawQuery = ""
+	return u.String(), fields, nil
+}
+
+// postSigningKey derives the Signature Version 4 key signing the policies of a day
+func postSigningKey(secret, date, region string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
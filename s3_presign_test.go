@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresignPost(t *testing.T) {
+	req := require.New(t)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+		Endpoint:         aws.String("http://localhost:9000"),
+		Region:           aws.String("eu-west-1"),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	req.NoError(err)
+	fs := NewFsWithOptions("bucket", sess, WithPrefix("uploads"))
+
+	url, fields, err := fs.PresignPost("/dir/file.png", time.Hour,
+		PostEquals("Content-Type", "image/png"),
+		PostContentLengthRange(1, 1024),
+	)
+	req.NoError(err)
+	req.Equal("http://localhost:9000/bucket", url)
+	req.Equal("uploads/dir/file.png", fields["key"])
+	req.Equal("image/png", fields["Content-Type"])
+	req.Equal("AWS4-HMAC-SHA256", fields["x-amz-algorithm"])
+	req.True(strings.HasPrefix(fields["x-amz-credential"], "key/"))
+	req.True(strings.HasSuffix(fields["x-amz-credential"], "/eu-west-1/s3/aws4_request"))
+	req.NotContains(fields, "x-amz-security-token")
+
+	date := fields["x-amz-date"][:8]
+	req.Equal(
+		hex.EncodeToString(hmacSHA256(postSigningKey("secret", date, "eu-west-1"), fields["policy"])),
+		fields["x-amz-signature"],
+	)
+
+	raw, err := base64.StdEncoding.DecodeString(fields["policy"])
+	req.NoError(err)
+	var policy struct {
+		Expiration time.Time       `json:"expiration"`
+		Conditions json.RawMessage `json:"conditions"`
+	}
+	req.NoError(json.Unmarshal(raw, &policy))
+	req.WithinDuration(time.Now().Add(time.Hour), policy.Expiration, time.Minute)
+	req.Contains(string(policy.Conditions), `{"bucket":"bucket"}`)
+	req.Contains(string(policy.Conditions), `{"key":"uploads/dir/file.png"}`)
+	req.Contains(string(policy.Conditions), `["eq","$Content-Type","image/png"]`)
+	req.Contains(string(policy.Conditions), `["content-length-range",1,1024]`)
+}
+
+func TestPresignPostWithoutPrefix(t *testing.T) {
+	req := require.New(t)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+		Endpoint:         aws.String("http://localhost:9000"),
+		Region:           aws.String("eu-west-1"),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	req.NoError(err)
+	fs := NewFsWithOptions("bucket", sess)
+
+	_, fields, err := fs.PresignPost("/dir/file.png", time.Hour)
+	req.NoError(err)
+	req.Equal("dir/file.png", fields["key"])
+
+	raw, err := base64.StdEncoding.DecodeString(fields["policy"])
+	req.NoError(err)
+	req.Contains(string(raw), `{"key":"dir/file.png"}`)
+}
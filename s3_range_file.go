@@ -0,0 +1,213 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/spf13/afero"
+)
+
+// RangeFile is a file opened for reading only a range of its content, with OpenRange
+type RangeFile struct {
+	*File
+	start  int64 // start is the offset of the range in the file
+	length int64 // length of the range
+	offset int64 // offset of the next read in the range
+}
+
+// OpenRange opens a file for reading only length bytes from start. The reads and seeks are relative to the range,
+// and the end of the range is the end of the returned file. The range is cut to the size of the file.
+func (fs *Fs) OpenRange(name string, start, length int64) (afero.File, error) {
+	name = fs.sanitize(name)
+	if start < 0 || length < 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrInvalidSeek}
+	}
+
+	file := NewFile(fs, name)
+	if err := file.openRead(); err != nil {
+		return nil, err
+	}
+	if file.isDir {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	if err := file.lookup(); err != nil {
+		return nil, err
+	}
+
+	size := file.cachedInfo.Size()
+	if start > size {
+		start = size
+	}
+	if length > size-start {
+		length = size - start
+	}
+
+	// Only the range is fetched
+	file.rangeEnd = start + length
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return &RangeFile{File: file, start: start, length: length}, nil
+}
+
+// Peek reads the first n bytes of a file with a single ranged request, like the magic bytes telling the type of its
+// content. Fewer bytes are returned for smaller files.
+func (fs *Fs) Peek(name string, n int) ([]byte, error) {
+	if n <= 0 {
+		n = 0
+	}
+	buf := make([]byte, n)
+	read, err := fs.ReadInto(name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+// ReadInto reads the beginning of a file into a buffer with a single ranged request, so that buffers can be reused.
+// It fills the buffer, unless the file is smaller, and returns the number of bytes read.
+func (fs *Fs) ReadInto(name string, buf []byte) (int, error) {
+	name = fs.sanitize(name)
+	if isRoot(name) {
+		return 0, rootError("read", name)
+	}
+	return fs.readRange(name, buf, 0)
+}
+
+// SectionReader returns a reader of the content of a file, of the size Stat gives. Its ReadAt performs a ranged
+// request per call and keeps no state, so that it can be called concurrently, like by the readers of different
+// sections of the file created with io.NewSectionReader over it. Its Read and Seek can't.
+func (fs *Fs) SectionReader(name string) (*io.SectionReader, error) {
+	name = fs.sanitize(name)
+	info, err := fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	return io.NewSectionReader(&objectReaderAt{fs: fs, name: name}, 0, info.Size()), nil
+}
+
+// objectReaderAt reads a file with a ranged request per ReadAt
+type objectReaderAt struct {
+	fs   *Fs
+	name string
+}
+
+func (r *objectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.fs.readRange(r.name, p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readRange reads the content of a file from an offset into a buffer, with a single ranged request. It fills the
+// buffer, unless the file ends before.
+func (fs *Fs) readRange(name string, buf []byte, off int64) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	out, err := fs.S3API.GetObjectWithContext(aws.BackgroundContext(), &s3.GetObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+		Range:                aws.String(fmt.Sprintf("bytes=%d-%d", off, off+int64(len(buf))-1)),
+	}, fs.requestOptions()...)
+	switch {
+	case isInvalidRange(err):
+		// The file ends before the offset
+		return 0, nil
+	case isNotFound(err):
+		return 0, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	case err != nil:
+		return 0, &os.PathError{Op: "read", Path: name, Err: permissionError(err)}
+	}
+	defer func() {
+		_ = out.Body.Close()
+	}()
+
+	n, err := io.ReadFull(out.Body, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return n, &os.PathError{Op: "read", Path: name, Err: err}
+	}
+	return n, nil
+}
+
+// Read reads up to len(p) bytes from the range, io.EOF is returned at its end
+func (f *RangeFile) Read(p []byte) (int, error) {
+	if f.offset >= f.length {
+		return 0, io.EOF
+	}
+	if remaining := f.length - f.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := f.File.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+// ReadAt reads len(p) bytes from an offset of the range, with a ranged request. Like io.ReaderAt, it doesn't change
+// the offset of the reads.
+func (f *RangeFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+	if off >= f.length {
+		return 0, io.EOF
+	}
+
+	buf := p
+	if remaining := f.length - off; int64(len(buf)) > remaining {
+		buf = buf[:remaining]
+	}
+	n, err := f.fs.readRange(f.name, buf, f.start+off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next read in the range. Contrary to File.Seek, offsets from io.SeekEnd are added to the
+// end of the range, following io.Seeker.
+func (f *RangeFile) Seek(offset int64, whence int) (int64, error) {
+	newOffset := offset
+	switch whence {
+	case io.SeekCurrent:
+		newOffset = f.offset + offset
+	case io.SeekEnd:
+		newOffset = f.length + offset
+	}
+
+	if newOffset < 0 {
+		return newOffset, ErrInvalidSeek
+	}
+
+	if _, err := f.File.Seek(f.start+newOffset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	f.offset = newOffset
+	return newOffset, nil
+}
+
+// Stat returns the FileInfo of the range, its size being the length of the range
+func (f *RangeFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return f.fs.newFileInfo(path.Base(f.Name()), false, f.length, info.ModTime()), nil
+}
@@ -0,0 +1,245 @@
+package s3
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenRange(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "file", []byte("0123456789abcdef"), time.Now())
+
+	file, err := fs.OpenRange("/file", 4, 8)
+	req.NoError(err)
+	defer func() { req.NoError(file.Close()) }()
+
+	info, err := file.Stat()
+	req.NoError(err)
+	req.Equal(int64(8), info.Size())
+
+	// Only the range is fetched
+	data, err := io.ReadAll(file)
+	req.NoError(err)
+	req.Equal("456789ab", string(data))
+	req.Equal("bytes=4-11", aws.StringValue(mock.lastInput("GetObject").(*s3.GetObjectInput).Range))
+
+	n, err := file.Read(make([]byte, 4))
+	req.ErrorIs(err, io.EOF)
+	req.Zero(n)
+
+	// Seeks are relative to the range
+	pos, err := file.Seek(2, io.SeekStart)
+	req.NoError(err)
+	req.Equal(int64(2), pos)
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(file, buf)
+	req.NoError(err)
+	req.Equal("678", string(buf))
+
+	pos, err = file.Seek(-4, io.SeekCurrent)
+	req.NoError(err)
+	req.Equal(int64(1), pos)
+	data, err = io.ReadAll(file)
+	req.NoError(err)
+	req.Equal("56789ab", string(data))
+
+	// Like io.Seeker, negative offsets go back from the end
+	pos, err = file.Seek(-3, io.SeekEnd)
+	req.NoError(err)
+	req.Equal(int64(5), pos)
+	data, err = io.ReadAll(file)
+	req.NoError(err)
+	req.Equal("9ab", string(data))
+
+	_, err = file.Seek(-1, io.SeekStart)
+	req.ErrorIs(err, ErrInvalidSeek)
+	_, err = file.Seek(-9, io.SeekEnd)
+	req.ErrorIs(err, ErrInvalidSeek)
+
+	n, err = file.ReadAt(buf, 6)
+	req.ErrorIs(err, io.EOF)
+	req.Equal("ab", string(buf[:n]))
+	req.Equal("bytes=10-11", aws.StringValue(mock.lastInput("GetObject").(*s3.GetObjectInput).Range))
+
+	// ReadAt doesn't move the offset of the reads
+	_, err = file.Seek(1, io.SeekStart)
+	req.NoError(err)
+	n, err = file.ReadAt(buf, 3)
+	req.NoError(err)
+	req.Equal("789", string(buf[:n]))
+	_, err = io.ReadFull(file, buf)
+	req.NoError(err)
+	req.Equal("567", string(buf))
+	pos, err = file.Seek(0, io.SeekCurrent)
+	req.NoError(err)
+	req.Equal(int64(4), pos)
+}
+
+func TestOpenRangeBounds(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "file", []byte("0123456789"), time.Now())
+
+	// The range is cut to the size of the file
+	file, err := fs.OpenRange("/file", 6, 100)
+	req.NoError(err)
+	data, err := io.ReadAll(file)
+	req.NoError(err)
+	req.Equal("6789", string(data))
+	req.NoError(file.Close())
+
+	file, err = fs.OpenRange("/file", 20, 5)
+	req.NoError(err)
+	data, err = io.ReadAll(file)
+	req.NoError(err)
+	req.Empty(data)
+	req.NoError(file.Close())
+
+	_, err = fs.OpenRange("/file", -1, 5)
+	req.ErrorIs(err, ErrInvalidSeek)
+
+	_, err = fs.OpenRange("/missing", 0, 5)
+	req.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestPeek(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	mock.putObject("bucket", "image.png", png, time.Now())
+
+	data, err := fs.Peek("/image.png", 8)
+	req.NoError(err)
+	req.Equal([]byte("\x89PNG\r\n\x1a\n"), data)
+	req.Equal("bytes=0-7", aws.StringValue(mock.lastInput("GetObject").(*s3.GetObjectInput).Range))
+
+	t.Run("Small", func(t *testing.T) {
+		mock.putObject("bucket", "small", []byte("abc"), time.Now())
+		data, err := fs.Peek("/small", 8)
+		req.NoError(err)
+		req.Equal([]byte("abc"), data)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		mock.putObject("bucket", "empty", nil, time.Now())
+		data, err := fs.Peek("/empty", 8)
+		req.NoError(err)
+		req.Empty(data)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := fs.Peek("/missing", 8)
+		req.ErrorIs(err, os.ErrNotExist)
+	})
+}
+
+func TestReadInto(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "large", []byte("0123456789abcdef"), time.Now())
+	mock.putObject("bucket", "small", []byte("0123"), time.Now())
+
+	buf := make([]byte, 8)
+	n, err := fs.ReadInto("/large", buf)
+	req.NoError(err)
+	req.Equal(8, n)
+	req.Equal([]byte("01234567"), buf)
+	req.Equal("bytes=0-7", aws.StringValue(mock.lastInput("GetObject").(*s3.GetObjectInput).Range))
+
+	// The buffer is reused
+	n, err = fs.ReadInto("/small", buf)
+	req.NoError(err)
+	req.Equal(4, n)
+	req.Equal([]byte("0123"), buf[:n])
+
+	_, err = fs.ReadInto("/missing", buf)
+	req.ErrorIs(err, os.ErrNotExist)
+}
+
+// trickleS3 returns the content of the objects one byte per read
+type trickleS3 struct {
+	*mockS3
+}
+
+func (m trickleS3) GetObjectWithContext(
+	ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option,
+) (*s3.GetObjectOutput, error) {
+	out, err := m.mockS3.GetObjectWithContext(ctx, in, opts...)
+	if err == nil {
+		out.Body = io.NopCloser(iotest.OneByteReader(out.Body))
+	}
+	return out, err
+}
+
+func TestReadFillsBuffer(t *testing.T) {
+	req := require.New(t)
+	mock := newMockS3()
+	fs := NewFsWithOptions("bucket", nil, WithS3API(trickleS3{mock}))
+	mock.putObject("bucket", "file", []byte("0123456789"), time.Now())
+
+	file, err := fs.Open("/file")
+	req.NoError(err)
+	defer func() { req.NoError(file.Close()) }()
+
+	buf := make([]byte, 8)
+	n, err := file.Read(buf)
+	req.NoError(err)
+	req.Equal(8, n)
+	req.Equal([]byte("01234567"), buf)
+
+	n, err = file.Read(buf)
+	req.Equal(2, n)
+	req.Equal([]byte("89"), buf[:n])
+	if err == nil {
+		_, err = file.Read(buf)
+	}
+	req.ErrorIs(err, io.EOF)
+}
+
+func TestSectionReader(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	mock.putObject("bucket", "data.bin", content, time.Now())
+	mock.putObject("bucket", "dir/file", nil, time.Now())
+
+	sr, err := fs.SectionReader("/data.bin")
+	req.NoError(err)
+	req.Equal(int64(len(content)), sr.Size())
+	req.NoError(iotest.TestReader(sr, content))
+
+	// The sections are read concurrently, each with their own requests
+	half := int64(len(content) / 2)
+	sections := make([][]byte, 2)
+	errs := make([]error, 2)
+	wg := sync.WaitGroup{}
+	for i := range sections {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sections[i], errs[i] = io.ReadAll(io.NewSectionReader(sr, int64(i)*half, half))
+		}(i)
+	}
+	wg.Wait()
+	req.NoError(errs[0])
+	req.NoError(errs[1])
+	req.Equal(content[:half], sections[0])
+	req.Equal(content[half:], sections[1])
+
+	_, err = fs.SectionReader("/dir")
+	req.ErrorIs(err, syscall.EISDIR)
+	_, err = fs.SectionReader("/missing")
+	req.ErrorIs(err, os.ErrNotExist)
+}
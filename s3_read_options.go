@@ -0,0 +1,252 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/sha1" //nolint: gosec
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ErrChecksumMismatch is returned when the content read doesn't match the checksum of the object
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrIdleTimeout is returned when reading a file stalls for longer than its idle timeout. It matches
+// os.ErrDeadlineExceeded.
+var ErrIdleTimeout = fmt.Errorf("idle timeout: %w", os.ErrDeadlineExceeded)
+
+// ReadOption alters the requests performed to read a file opened with OpenWithOptions
+type ReadOption func(*readOptions)
+
+// readOptions holds the per-file settings applied to read requests
+type readOptions struct {
+	requestPayer     *string       // requestPayer confirms the requester knows it will be charged for the request
+	validateChecksum bool          // validateChecksum checks the content against the additional checksum of the object
+	blockSize        int64         // blockSize is the size of the aligned blocks ReadAt fetches, when set
+	idleTimeout      time.Duration // idleTimeout aborts the reads stalling for longer, when set
+	decoders         decoderSet    // decoders decode the content according to its Content-Encoding, when set
+}
+
+// ContentDecoder decodes a content of a given Content-Encoding, like a brotli reader does for "br"
+type ContentDecoder func(io.Reader) (io.Reader, error)
+
+// decoderSet indexes the content decoders by Content-Encoding
+type decoderSet map[string]ContentDecoder
+
+// WithRequestPayer makes the requester pay for the requests performed on this file only
+func WithRequestPayer() ReadOption {
+	return func(o *readOptions) {
+		o.requestPayer = aws.String(s3.RequestPayerRequester)
+	}
+}
+
+// WithChecksumValidation validates the content read against the additional checksum (CRC32, CRC32C, SHA1 or
+// SHA256) the object was uploaded with. Reading the end of the file returns ErrChecksumMismatch if it doesn't match.
+// Objects without additional checksum, multipart checksums, and reads starting after a Seek aren't validated.
+func WithChecksumValidation() ReadOption {
+	return func(o *readOptions) {
+		o.validateChecksum = true
+	}
+}
+
+// WithReadAhead makes ReadAt fetch the content in aligned blocks of blockSize bytes, and serve the following reads
+// within the same block from memory. This avoids many tiny requests for random reads, like with parquet files.
+func WithReadAhead(blockSize int64) ReadOption {
+	return func(o *readOptions) {
+		o.blockSize = blockSize
+	}
+}
+
+// WithIdleTimeout makes reading the file fail with ErrIdleTimeout if no content is received for longer than the
+// timeout, even in the middle of the file. The stalled response is closed.
+func WithIdleTimeout(timeout time.Duration) ReadOption {
+	return func(o *readOptions) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithDecodeContentEncoding decodes the content of the file according to its Content-Encoding. The "gzip" and
+// "deflate" encodings are supported, and the decoders of other encodings, like "br" which the standard library doesn't
+// provide, can be given by encoding. The content of other encodings is read as is. The size of decoded files is still
+// the one of their encoded content, and they can only be read sequentially: reading them after a Seek, or with
+// ReadAt, fails with ErrNotSupported. The blocks fetched by WithReadAhead aren't decoded.
+func WithDecodeContentEncoding(decoders map[string]ContentDecoder) ReadOption {
+	return func(o *readOptions) {
+		o.decoders = decoderSet{"gzip": decodeGzip, "deflate": decodeDeflate}
+		for encoding, decoder := range decoders {
+			o.decoders[strings.ToLower(encoding)] = decoder
+		}
+	}
+}
+
+func (o *readOptions) applyHeadObject(req *s3.HeadObjectInput) {
+	if o.requestPayer != nil {
+		req.RequestPayer = o.requestPayer
+	}
+}
+
+func (o *readOptions) applyGetObject(req *s3.GetObjectInput) {
+	if o.requestPayer != nil {
+		req.RequestPayer = o.requestPayer
+	}
+
+	if o.validateChecksum && req.Range == nil {
+		req.ChecksumMode = aws.String(s3.ChecksumModeEnabled)
+	}
+}
+
+// wrapBody wraps the body of a GetObject response to apply the options to the content read
+func (o *readOptions) wrapBody(resp *s3.GetObjectOutput) io.ReadCloser {
+	body := o.wrapIdleTimeout(resp.Body)
+
+	if o.validateChecksum {
+		if h, expected := checksumOf(resp); h != nil {
+			body = &checksumReader{ReadCloser: body, hash: h, expected: expected}
+		}
+	}
+
+	return body
+}
+
+// decode wraps a body in the decoder of its Content-Encoding, if any, and tells if it did. Only whole contents can be
+// decoded.
+func (d decoderSet) decode(body io.ReadCloser, encoding *string, ranged bool) (io.ReadCloser, bool, error) {
+	decoder := d[strings.ToLower(strings.TrimSpace(aws.StringValue(encoding)))]
+	if decoder == nil {
+		return body, false, nil
+	}
+	if ranged {
+		_ = body.Close()
+		return nil, false, ErrNotSupported
+	}
+
+	decoded, err := decoder(body)
+	if err != nil {
+		_ = body.Close()
+		return nil, false, err
+	}
+	return &decodedBody{Reader: decoded, body: body}, true, nil
+}
+
+// decodedBody reads a body through its decoder, and closes both
+type decodedBody struct {
+	io.Reader
+	body io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	if c, ok := b.Reader.(io.Closer); ok {
+		_ = c.Close()
+	}
+	return b.body.Close()
+}
+
+func decodeGzip(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// decodeDeflate decodes the "deflate" encoding, which is zlib-wrapped, or raw as some servers send it
+func decodeDeflate(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	// The zlib header starts with the deflate method, and is a multiple of 31
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// wrapIdleTimeout aborts the reads of a body stalling for longer than the idle timeout
+func (o *readOptions) wrapIdleTimeout(body io.ReadCloser) io.ReadCloser {
+	if o.idleTimeout <= 0 {
+		return body
+	}
+	return &idleTimeoutReader{ReadCloser: body, timeout: o.idleTimeout}
+}
+
+// checksumOf returns the hash matching the additional checksum of an object, and the expected checksum
+func checksumOf(resp *s3.GetObjectOutput) (hash.Hash, string) {
+	checksums := []struct {
+		value   *string
+		newHash func() hash.Hash
+	}{
+		{resp.ChecksumSHA256, sha256.New},
+		{resp.ChecksumSHA1, sha1.New},
+		{resp.ChecksumCRC32, func() hash.Hash { return crc32.NewIEEE() }},
+		{resp.ChecksumCRC32C, func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) }},
+	}
+
+	for _, c := range checksums {
+		// Checksums of multipart uploads are checksums of the checksums of each part, suffixed with "-<parts>"
+		if c.value != nil && !strings.Contains(*c.value, "-") {
+			return c.newHash(), *c.value
+		}
+	}
+
+	return nil, ""
+}
+
+// checksumReader computes the checksum of the content read, and compares it at the end of the stream
+type checksumReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+
+	if errors.Is(err, io.EOF) && base64.StdEncoding.EncodeToString(r.hash.Sum(nil)) != r.expected {
+		return n, ErrChecksumMismatch
+	}
+
+	return n, err
+}
+
+// idleTimeoutReader closes the underlying body when a read doesn't return within the timeout, which unblocks it
+type idleTimeoutReader struct {
+	io.ReadCloser
+	timeout  time.Duration
+	timedOut int32 // timedOut is set atomically when the body was closed by the timer
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&r.timedOut) == 1 {
+		return 0, ErrIdleTimeout
+	}
+
+	timer := time.AfterFunc(r.timeout, func() {
+		atomic.StoreInt32(&r.timedOut, 1)
+		_ = r.ReadCloser.Close()
+	})
+	n, err := r.ReadCloser.Read(p)
+	if !timer.Stop() && atomic.LoadInt32(&r.timedOut) == 1 {
+		return n, ErrIdleTimeout
+	}
+
+	return n, err
+}
+
+func (r *idleTimeoutReader) Close() error {
+	// The body was already closed by the timer
+	if atomic.LoadInt32(&r.timedOut) == 1 {
+		return nil
+	}
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,289 @@
+package s3
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenWithOptionsRequestPayer(t *testing.T) {
+	req := require.New(t)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+		Endpoint:    aws.String("http://localhost:9000"),
+		Region:      aws.String("eu-west-1"),
+	})
+	req.NoError(err)
+
+	// We don't send anything, we only record the payer header of each request
+	payers := map[string][]string{}
+	client := s3.New(sess)
+	client.Handlers.Send.Clear()
+	client.Handlers.Send.PushBack(func(r *request.Request) {
+		payers[r.Operation.Name] = append(payers[r.Operation.Name], r.HTTPRequest.Header.Get("x-amz-request-payer"))
+		r.HTTPResponse = &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Content-Length": []string{"5"},
+				"Last-Modified":  []string{time.Now().UTC().Format(http.TimeFormat)},
+			},
+			Body: io.NopCloser(strings.NewReader("hello")),
+		}
+	})
+
+	fs := NewFs("bucket", sess)
+	fs.S3API = client
+
+	file, err := fs.OpenWithOptions("file", WithRequestPayer())
+	req.NoError(err)
+	content, err := io.ReadAll(file)
+	req.NoError(err)
+	req.Equal("hello", string(content))
+	req.NoError(file.Close())
+
+	req.Equal([]string{"requester"}, payers["HeadObject"])
+	req.Equal([]string{"requester"}, payers["GetObject"])
+
+	// The Fs default stays unchanged
+	file, err = fs.Open("file")
+	req.NoError(err)
+	_, err = io.ReadAll(file)
+	req.NoError(err)
+	req.NoError(file.Close())
+
+	req.Equal([]string{"requester", ""}, payers["HeadObject"])
+	req.Equal([]string{"requester", ""}, payers["GetObject"])
+}
+
+func TestOpenWithOptionsChecksumValidation(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	sum := sha256.Sum256([]byte("hello world"))
+	mock.putObject("bucket", "file", []byte("hello world"), time.Now()).checksumSHA256 = aws.String(
+		base64.StdEncoding.EncodeToString(sum[:]),
+	)
+
+	t.Run("Valid", func(t *testing.T) {
+		file, err := fs.OpenWithOptions("file", WithChecksumValidation())
+		req.NoError(err)
+		content, err := io.ReadAll(file)
+		req.NoError(err)
+		req.Equal("hello world", string(content))
+		req.NoError(file.Close())
+		req.Equal(s3.ChecksumModeEnabled, aws.StringValue(mock.lastInput("GetObject").(*s3.GetObjectInput).ChecksumMode))
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		mock.getObject("bucket", "file").body = []byte("hello w0rld")
+
+		file, err := fs.OpenWithOptions("file", WithChecksumValidation())
+		req.NoError(err)
+		_, err = io.ReadAll(file)
+		req.ErrorIs(err, ErrChecksumMismatch)
+		req.NoError(file.Close())
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		file, err := fs.Open("file")
+		req.NoError(err)
+		_, err = io.ReadAll(file)
+		req.NoError(err)
+		req.NoError(file.Close())
+	})
+}
+
+func TestOpenWithOptionsReadAhead(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	content := make([]byte, 2500)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	mock.putObject("bucket", "file.parquet", content, time.Now())
+
+	file, err := fs.OpenWithOptions("file.parquet", WithReadAhead(1024))
+	req.NoError(err)
+	defer func() { req.NoError(file.Close()) }()
+	mock.resetCalls()
+
+	buf := make([]byte, 100)
+	for _, off := range []int64{0, 500, 200, 924} {
+		n, err := file.ReadAt(buf, off)
+		req.NoError(err)
+		req.Equal(content[off:off+100], buf[:n])
+	}
+	req.Equal(1, mock.count("GetObject"))
+	req.Equal("bytes=0-1023", aws.StringValue(mock.lastInput("GetObject").(*s3.GetObjectInput).Range))
+
+	// Reads across blocks fetch the following ones
+	n, err := file.ReadAt(buf, 1000)
+	req.NoError(err)
+	req.Equal(content[1000:1100], buf[:n])
+	req.Equal(2, mock.count("GetObject"))
+	req.Equal("bytes=1024-2047", aws.StringValue(mock.lastInput("GetObject").(*s3.GetObjectInput).Range))
+
+	n, err = file.ReadAt(buf, 2450)
+	req.ErrorIs(err, io.EOF)
+	req.Equal(content[2450:], buf[:n])
+	req.Equal(3, mock.count("GetObject"))
+}
+
+// stallingBody returns its content, and then blocks until it's closed
+type stallingBody struct {
+	content []byte
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func (b *stallingBody) Read(p []byte) (int, error) {
+	if len(b.content) > 0 {
+		n := copy(p, b.content)
+		b.content = b.content[n:]
+		return n, nil
+	}
+	<-b.closed
+	return 0, errors.New("read on closed body")
+}
+
+func (b *stallingBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+// stallingS3 stalls the content of the objects it returns after their first bytes
+type stallingS3 struct {
+	*mockS3
+}
+
+func (m stallingS3) GetObjectWithContext(
+	ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option,
+) (*s3.GetObjectOutput, error) {
+	out, err := m.mockS3.GetObjectWithContext(ctx, in, opts...)
+	if err == nil {
+		content, _ := io.ReadAll(out.Body)
+		out.Body = &stallingBody{content: content[:len(content)/2], closed: make(chan struct{})}
+	}
+	return out, err
+}
+
+func TestOpenWithOptionsIdleTimeout(t *testing.T) {
+	req := require.New(t)
+	mock := newMockS3()
+	fs := NewFsWithOptions("bucket", nil, WithS3API(stallingS3{mock}))
+	mock.putObject("bucket", "file", []byte("content!"), time.Now())
+
+	file, err := fs.OpenWithOptions("file", WithIdleTimeout(50*time.Millisecond))
+	req.NoError(err)
+
+	start := time.Now()
+	data, err := io.ReadAll(file)
+	req.ErrorIs(err, ErrIdleTimeout)
+	req.ErrorIs(err, os.ErrDeadlineExceeded)
+	req.Equal("cont", string(data))
+	req.Less(time.Since(start), 5*time.Second)
+	req.NoError(file.Close())
+
+	t.Run("ReadAhead", func(t *testing.T) {
+		file, err := fs.OpenWithOptions("file", WithIdleTimeout(50*time.Millisecond), WithReadAhead(1024))
+		req.NoError(err)
+		_, err = file.ReadAt(make([]byte, 4), 0)
+		req.ErrorIs(err, ErrIdleTimeout)
+	})
+
+	t.Run("NoStall", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		mock.putObject("bucket", "file", []byte("content!"), time.Now())
+		file, err := fs.OpenWithOptions("file", WithIdleTimeout(time.Second))
+		req.NoError(err)
+		data, err := io.ReadAll(file)
+		req.NoError(err)
+		req.Equal("content!", string(data))
+	})
+}
+
+func TestOpenWithOptionsDecodeContentEncoding(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	// The decoded content is much bigger than the encoded one
+	content := strings.Repeat("compressible content\n", 1000)
+	encode := func(newWriter func(io.Writer) io.WriteCloser) []byte {
+		buf := &bytes.Buffer{}
+		w := newWriter(buf)
+		_, err := w.Write([]byte(content))
+		req.NoError(err)
+		req.NoError(w.Close())
+		return buf.Bytes()
+	}
+
+	mock.putObject("bucket", "file.gz", encode(func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	}), time.Now()).contentEncoding = aws.String("gzip")
+	mock.putObject("bucket", "file.zlib", encode(func(w io.Writer) io.WriteCloser {
+		return zlib.NewWriter(w)
+	}), time.Now()).contentEncoding = aws.String("deflate")
+	mock.putObject("bucket", "file.deflate", encode(func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.BestCompression)
+		return fw
+	}), time.Now()).contentEncoding = aws.String("Deflate")
+	mock.putObject("bucket", "file.br", []byte(base64.StdEncoding.EncodeToString([]byte(content))),
+		time.Now()).contentEncoding = aws.String("br")
+	mock.putObject("bucket", "file.txt", []byte(content), time.Now())
+
+	// Brotli isn't part of the standard library, base64 stands in for a brotli reader
+	decoders := map[string]ContentDecoder{"br": func(r io.Reader) (io.Reader, error) {
+		return base64.NewDecoder(base64.StdEncoding, r), nil
+	}}
+
+	for _, name := range []string{"/file.gz", "/file.zlib", "/file.deflate", "/file.br", "/file.txt"} {
+		file, err := fs.OpenWithOptions(name, WithDecodeContentEncoding(decoders))
+		req.NoError(err, name)
+		data, err := io.ReadAll(file)
+		req.NoError(err, name)
+		req.Equal(content, string(data), name)
+		req.NoError(file.Close())
+	}
+
+	// The content is read as is without the option
+	file, err := fs.Open("/file.gz")
+	req.NoError(err)
+	data, err := io.ReadAll(file)
+	req.NoError(err)
+	req.Equal(mock.getObject("bucket", "file.gz").body, data)
+
+	// Encoded files can't be read from an offset, others can
+	file, err = fs.OpenWithOptions("/file.gz", WithDecodeContentEncoding(nil))
+	req.NoError(err)
+	_, err = file.Seek(10, io.SeekStart)
+	req.NoError(err)
+	_, err = file.Read(make([]byte, 10))
+	req.ErrorIs(err, ErrNotSupported)
+
+	file, err = fs.OpenWithOptions("/file.txt", WithDecodeContentEncoding(nil))
+	req.NoError(err)
+	buf := make([]byte, 10)
+	_, err = file.ReadAt(buf, 21)
+	req.NoError(err)
+	req.Equal("compressib", string(buf))
+}
@@ -0,0 +1,72 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ReadSince reads the content of a file from an offset, like the size it had when it was last read, and returns the
+// current size of the file. This allows tailing append-only files, like logs, without fetching them again. If the
+// file didn't grow, or if it shrank, nothing is read and the returned size tells how the file changed.
+func (fs *Fs) ReadSince(name string, offset int64) (io.ReadCloser, int64, error) {
+	name = fs.sanitize(name)
+	if isRoot(name) {
+		return nil, 0, rootError("read", name)
+	}
+	if offset < 0 {
+		return nil, 0, &os.PathError{Op: "read", Path: name, Err: ErrInvalidSeek}
+	}
+
+	out, err := fs.S3API.GetObjectWithContext(aws.BackgroundContext(), &s3.GetObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+		Range:                aws.String(fmt.Sprintf("bytes=%d-", offset)),
+	}, fs.requestOptions()...)
+	switch {
+	case isInvalidRange(err):
+		// There is nothing after the offset, the size is only known by looking the file up
+		info, err := fs.Stat(name)
+		if err != nil {
+			return nil, 0, err
+		}
+		return http.NoBody, info.Size(), nil
+	case isNotFound(err):
+		return nil, 0, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	case err != nil:
+		return nil, 0, &os.PathError{Op: "read", Path: name, Err: permissionError(err)}
+	}
+
+	return out.Body, contentRangeSize(out, offset), nil
+}
+
+// isInvalidRange checks if an error means a requested range starts after the end of the object
+func isInvalidRange(err error) bool {
+	var errRequestFailure awserr.RequestFailure
+	return errors.As(err, &errRequestFailure) &&
+		errRequestFailure.StatusCode() == http.StatusRequestedRangeNotSatisfiable
+}
+
+// contentRangeSize returns the total size of an object from the "bytes start-end/size" Content-Range of a ranged
+// GetObject. It's deduced from the length of the response if the size is missing or unknown.
+func contentRangeSize(out *s3.GetObjectOutput, offset int64) int64 {
+	contentRange := aws.StringValue(out.ContentRange)
+	if i := strings.LastIndex(contentRange, "/"); i >= 0 {
+		if size, err := strconv.ParseInt(contentRange[i+1:], 10, 64); err == nil {
+			return size
+		}
+	}
+	return offset + aws.Int64Value(out.ContentLength)
+}
@@ -0,0 +1,51 @@
+package s3
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSince(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	readSince := func(offset int64) (string, int64) {
+		body, size, err := fs.ReadSince("/app.log", offset)
+		req.NoError(err)
+		defer func() { req.NoError(body.Close()) }()
+		data, err := io.ReadAll(body)
+		req.NoError(err)
+		return string(data), size
+	}
+
+	mock.putObject("bucket", "app.log", []byte("line 1\n"), time.Now())
+	data, size := readSince(0)
+	req.Equal("line 1\n", data)
+	req.Equal(int64(7), size)
+
+	// Growth: only the new bytes are read
+	mock.putObject("bucket", "app.log", []byte("line 1\nline 2\n"), time.Now())
+	data, size = readSince(size)
+	req.Equal("line 2\n", data)
+	req.Equal(int64(14), size)
+
+	// No growth: nothing is read
+	data, size = readSince(size)
+	req.Empty(data)
+	req.Equal(int64(14), size)
+
+	// Shrink: nothing is read and the new size is returned
+	mock.putObject("bucket", "app.log", []byte("line 3\n"), time.Now())
+	data, size = readSince(size)
+	req.Empty(data)
+	req.Equal(int64(7), size)
+
+	t.Run("Missing", func(t *testing.T) {
+		_, _, err := fs.ReadSince("/missing.log", 0)
+		req.ErrorIs(err, os.ErrNotExist)
+	})
+}
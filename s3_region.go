@@ -0,0 +1,84 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// endpointRegion extracts the region of an S3 endpoint, like "bucket.s3.eu-west-1.amazonaws.com"
+var endpointRegion = regexp.MustCompile(`(?:^|\.)s3[.-]([a-z]{2}(?:-[a-z]+)+-\d+)\.amazonaws\.com`)
+
+// RegionError is returned when the bucket isn't in the region the client is configured with, and S3 told which
+// region it is in. The client has to be configured with that region.
+type RegionError struct {
+	Region         string // Region the bucket is in
+	RequestsRegion string // Region the requests were sent to
+	Err            error
+}
+
+func (e *RegionError) Error() string {
+	return fmt.Sprintf("the bucket is in the %q region, not %q: %s", e.Region, e.RequestsRegion, e.Err)
+}
+
+func (e *RegionError) Unwrap() error { return e.Err }
+
+// regionHint is a request option turning the errors caused by a wrong region, like a 301 PermanentRedirect, into a
+// *RegionError when the response tells the region of the bucket. The SDK only reports it when S3 sets the
+// x-amz-bucket-region header, it is otherwise found in the body of the error.
+func regionHint(r *request.Request) {
+	var body []byte
+	r.Handlers.UnmarshalError.PushFront(func(r *request.Request) {
+		body, _ = io.ReadAll(r.HTTPResponse.Body)
+		_ = r.HTTPResponse.Body.Close()
+		r.HTTPResponse.Body = io.NopCloser(bytes.NewReader(body))
+	})
+
+	// The error is only replaced once it is known not to be retried
+	r.Handlers.AfterRetry.PushBack(func(r *request.Request) {
+		var awsErr awserr.Error
+		if aws.BoolValue(r.Retryable) || !errors.As(r.Error, &awsErr) || r.HTTPResponse == nil {
+			return
+		}
+		switch awsErr.Code() {
+		case "BucketRegionError", "PermanentRedirect", "AuthorizationHeaderMalformed":
+		default:
+			return
+		}
+
+		if region := bucketRegion(r.HTTPResponse.Header, body); region != "" {
+			r.Error = &RegionError{Region: region, RequestsRegion: aws.StringValue(r.Config.Region), Err: r.Error}
+		}
+	})
+}
+
+// bucketRegion returns the region of the bucket given by an error response, or an empty string
+func bucketRegion(header http.Header, body []byte) string {
+	if region := header.Get("X-Amz-Bucket-Region"); region != "" {
+		return region
+	}
+
+	var errResp struct {
+		Region   string `xml:"Region"`
+		Endpoint string `xml:"Endpoint"`
+	}
+	if xml.Unmarshal(body, &errResp) != nil {
+		return ""
+	}
+	if errResp.Region != "" {
+		return errResp.Region
+	}
+	if match := endpointRegion.FindStringSubmatch(errResp.Endpoint); match != nil {
+		return match[1]
+	}
+	return ""
+}
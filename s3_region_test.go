@@ -0,0 +1,96 @@
+package s3
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegionError(t *testing.T) {
+	req := require.New(t)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+		Endpoint:    aws.String("http://localhost:9000"),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	})
+	req.NoError(err)
+
+	var status int
+	var header http.Header
+	var body string
+	api := s3.New(sess)
+	api.Handlers.Send.Clear()
+	api.Handlers.Send.PushBack(func(r *request.Request) {
+		r.HTTPResponse = &http.Response{
+			StatusCode: status,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}
+	})
+	fs := NewFsWithOptions("bucket", sess, WithS3API(api))
+
+	t.Run("Header", func(t *testing.T) {
+		status, header, body = http.StatusMovedPermanently, http.Header{"X-Amz-Bucket-Region": {"eu-west-1"}}, ""
+		_, err := fs.Stat("/file")
+		var regionErr *RegionError
+		req.True(errors.As(err, &regionErr))
+		req.Equal("eu-west-1", regionErr.Region)
+		req.Equal("us-east-1", regionErr.RequestsRegion)
+		req.Contains(err.Error(), `the bucket is in the "eu-west-1" region, not "us-east-1"`)
+
+		// The original error is kept
+		var reqErr awserr.RequestFailure
+		req.True(errors.As(err, &reqErr))
+		req.Equal(http.StatusMovedPermanently, reqErr.StatusCode())
+	})
+
+	t.Run("Endpoint", func(t *testing.T) {
+		status, header = http.StatusMovedPermanently, http.Header{}
+		body = `<Error><Code>PermanentRedirect</Code><Message>Use the specified endpoint.</Message>` +
+			`<Endpoint>bucket.s3.ap-southeast-2.amazonaws.com</Endpoint><Bucket>bucket</Bucket></Error>`
+		_, err := fs.ReaddirAll("/dir")
+		var regionErr *RegionError
+		req.True(errors.As(err, &regionErr))
+		req.Equal("ap-southeast-2", regionErr.Region)
+	})
+
+	t.Run("AuthorizationHeaderMalformed", func(t *testing.T) {
+		status, header = http.StatusBadRequest, http.Header{}
+		body = `<Error><Code>AuthorizationHeaderMalformed</Code><Message>the region 'us-east-1' is wrong; ` +
+			`expecting 'eu-central-1'</Message><Region>eu-central-1</Region></Error>`
+		_, err := fs.PutBytes("/file", []byte("content"))
+		var regionErr *RegionError
+		req.True(errors.As(err, &regionErr))
+		req.Equal("eu-central-1", regionErr.Region)
+		req.Contains(err.Error(), "AuthorizationHeaderMalformed")
+	})
+
+	t.Run("NoHint", func(t *testing.T) {
+		status, header, body = http.StatusMovedPermanently, http.Header{}, ""
+		_, err := fs.Stat("/file")
+		req.Error(err)
+		var regionErr *RegionError
+		req.False(errors.As(err, &regionErr))
+	})
+
+	t.Run("OtherErrors", func(t *testing.T) {
+		status, header = http.StatusBadRequest, http.Header{"X-Amz-Bucket-Region": {"eu-west-1"}}
+		body = `<Error><Code>InvalidRequest</Code><Message>invalid</Message></Error>`
+		_, err := fs.PutBytes("/file", []byte("content"))
+		req.Error(err)
+		var regionErr *RegionError
+		req.False(errors.As(err, &regionErr))
+	})
+}
@@ -0,0 +1,129 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// deleteObjectsBatchSize is the maximum number of keys a DeleteObjects request accepts
+const deleteObjectsBatchSize = 1000
+
+// RemoveMatching removes the files inside a directory that match a predicate, like the ones older than some time. As
+// the listing is recursive, the names of the FileInfo given to the predicate are the full paths of the files. The
+// files are removed in batches, and the ones that couldn't be removed are reported in a *BatchError. It returns the
+// number of removed files. Like with RemoveAll, the files of the whole bucket are only considered if the prefix is
+// "/", and with soft deletion the files are moved to the trash, which is only emptied when the prefix is in it.
+func (fs *Fs) RemoveMatching(prefix string, match func(os.FileInfo) bool) (int, error) {
+	if prefix = fs.sanitize(prefix); isRoot(prefix) && prefix != "/" {
+		return 0, rootError("remove", prefix)
+	}
+
+	var names []string
+	err := fs.walkObjects(fs.dirPrefix(prefix), func(obj *s3.Object) error {
+		name := fs.keyName(*obj.Key)
+		if fs.keptInTrash(prefix, name) {
+			return nil
+		}
+		if match(fs.newFileInfo(name, false, *obj.Size, *obj.LastModified)) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return fs.removeMany(names)
+}
+
+// Purge removes all the files inside a directory, directory markers included, and returns the number of removed
+// files. An empty prefix, or "/", empties the whole bucket, or everything under the prefix of the Fs. As a safety
+// net, nothing is removed unless confirm is true. The files are removed in batches, and the ones that couldn't be
+// removed are reported in a *BatchError. With soft deletion, the files are moved to the trash, one by one, and the
+// trash is only emptied when the prefix is in it.
+func (fs *Fs) Purge(prefix string, confirm bool) (int, error) {
+	if !confirm {
+		return 0, ErrNotConfirmed
+	}
+
+	prefix = fs.sanitize(prefix)
+	var names []string
+	err := fs.walkAllObjects(fs.dirPrefix(prefix), func(obj *s3.Object) error {
+		if name := fs.keyName(*obj.Key); !fs.keptInTrash(prefix, name) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return fs.removeMany(names)
+}
+
+// removeMany removes files with as few requests as possible, and returns the number of removed files. With soft
+// deletion, the files are moved to the trash one by one, and only the ones already in it are deleted.
+func (fs *Fs) removeMany(names []string) (int, error) {
+	removed := 0
+	failed := &BatchError{}
+	if fs.TrashPrefix != "" {
+		trashed := make([]string, 0, len(names))
+		for _, name := range names {
+			if fs.inTrash(name) {
+				trashed = append(trashed, name)
+				continue
+			}
+			fs.invalidate(fs.sanitize(name))
+			if err := fs.moveToTrash(name); err != nil {
+				failed.add(name, err)
+				continue
+			}
+			removed++
+		}
+		names = trashed
+	}
+
+	for start := 0; start < len(names); start += deleteObjectsBatchSize {
+		end := start + deleteObjectsBatchSize
+		if end > len(names) {
+			end = len(names)
+		}
+
+		batch := names[start:end]
+		byKey := make(map[string]string, len(batch))
+		objects := make([]*s3.ObjectIdentifier, 0, len(batch))
+		for _, name := range batch {
+			fs.invalidate(fs.sanitize(name))
+			key := strings.TrimPrefix(fs.key(name), "/")
+			byKey[key] = name
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		out, err := fs.S3API.DeleteObjectsWithContext(aws.BackgroundContext(), &s3.DeleteObjectsInput{
+			Bucket:                    aws.String(fs.Bucket),
+			ExpectedBucketOwner:       fs.ExpectedBucketOwner,
+			Delete:                    &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+			BypassGovernanceRetention: fs.bypassGovernanceRetention(),
+		}, fs.requestOptions()...)
+		if err != nil {
+			return removed, permissionError(err)
+		}
+
+		// Being quiet, only the keys that couldn't be removed are reported
+		removed += len(batch) - len(out.Errors)
+		for _, e := range out.Errors {
+			name, ok := byKey[aws.StringValue(e.Key)]
+			if !ok {
+				name = fs.keyName(aws.StringValue(e.Key))
+			}
+			failed.add(name, permissionError(awserr.New(aws.StringValue(e.Code), aws.StringValue(e.Message), nil)))
+		}
+	}
+
+	return removed, failed.errOrNil()
+}
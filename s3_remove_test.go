@@ -0,0 +1,114 @@
+package s3
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveMatching(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	old := time.Now().Add(-48 * time.Hour)
+	mock.putObject("bucket", "logs/old.log", []byte("old"), old)
+	mock.putObject("bucket", "logs/sub/old.log", []byte("old"), old)
+	mock.putObject("bucket", "logs/old.txt", []byte("old"), old)
+	mock.putObject("bucket", "logs/new.log", []byte("new"), time.Now())
+	mock.putObject("bucket", "other/old.log", []byte("old"), old)
+	mock.putObject("bucket", "logs-archive/old.log", []byte("old"), old)
+
+	var names []string
+	removed, err := fs.RemoveMatching("/logs", func(info os.FileInfo) bool {
+		names = append(names, info.Name())
+		return strings.HasSuffix(info.Name(), ".log") && info.ModTime().Before(time.Now().Add(-24*time.Hour))
+	})
+	req.NoError(err)
+	req.Equal(2, removed)
+	req.ElementsMatch([]string{"logs/old.log", "logs/sub/old.log", "logs/old.txt", "logs/new.log"}, names)
+
+	req.Nil(mock.getObject("bucket", "logs/old.log"))
+	req.Nil(mock.getObject("bucket", "logs/sub/old.log"))
+	req.NotNil(mock.getObject("bucket", "logs/old.txt"))
+	req.NotNil(mock.getObject("bucket", "logs/new.log"))
+	req.NotNil(mock.getObject("bucket", "other/old.log"))
+	req.NotNil(mock.getObject("bucket", "logs-archive/old.log"))
+	req.Equal(1, mock.count("DeleteObjects"))
+
+	t.Run("NoMatch", func(t *testing.T) {
+		mock.resetCalls()
+		removed, err := fs.RemoveMatching("/logs", func(os.FileInfo) bool { return false })
+		req.NoError(err)
+		req.Zero(removed)
+		req.Zero(mock.count("DeleteObjects"))
+	})
+}
+
+func TestRemoveMatchingSoftDelete(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithSoftDelete(".trash"))
+
+	mock.putObject("bucket", "logs/a.log", []byte("a"), time.Now())
+	mock.putObject("bucket", "logs/b.txt", []byte("b"), time.Now())
+	mock.putObject("bucket", ".trash/logs/old.log", []byte("old"), time.Now())
+
+	isLog := func(info os.FileInfo) bool { return strings.HasSuffix(info.Name(), ".log") }
+	removed, err := fs.RemoveMatching("/logs", isLog)
+	req.NoError(err)
+	req.Equal(1, removed)
+	req.Nil(mock.getObject("bucket", "logs/a.log"))
+	req.Equal("a", string(mock.getObject("bucket", ".trash/logs/a.log").body))
+	req.NotNil(mock.getObject("bucket", "logs/b.txt"))
+	req.Zero(mock.count("DeleteObjects"))
+
+	// Removing everything keeps the trash
+	removed, err = fs.RemoveMatching("/", isLog)
+	req.NoError(err)
+	req.Zero(removed)
+	req.NotNil(mock.getObject("bucket", ".trash/logs/a.log"))
+
+	// The files removed from the trash are deleted
+	removed, err = fs.RemoveMatching("/.trash", isLog)
+	req.NoError(err)
+	req.Equal(2, removed)
+	req.Nil(mock.getObject("bucket", ".trash/logs/a.log"))
+	req.Nil(mock.getObject("bucket", ".trash/logs/old.log"))
+	req.Nil(mock.getObject("bucket", ".trash/.trash/logs/a.log"))
+	req.Equal(1, mock.count("DeleteObjects"))
+}
+
+func TestPurge(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	mock.putObject("bucket", "tmp/", nil, time.Now())
+	mock.putObject("bucket", "tmp/a", []byte("a"), time.Now())
+	mock.putObject("bucket", "tmp/sub/", nil, time.Now())
+	mock.putObject("bucket", "tmp/sub/b", []byte("b"), time.Now())
+	mock.putObject("bucket", "keep", []byte("keep"), time.Now())
+	mock.putObject("bucket", "tmp-keep/b", []byte("b"), time.Now())
+
+	removed, err := fs.Purge("/tmp/", false)
+	req.ErrorIs(err, ErrNotConfirmed)
+	req.Zero(removed)
+	req.Empty(mock.calls)
+	req.Len(mock.buckets["bucket"], 6)
+
+	removed, err = fs.Purge("/tmp", true)
+	req.NoError(err)
+	req.Equal(4, removed)
+	req.Len(mock.buckets["bucket"], 2)
+	req.NotNil(mock.getObject("bucket", "keep"))
+	req.NotNil(mock.getObject("bucket", "tmp-keep/b"))
+	req.Equal(1, mock.count("DeleteObjects"))
+
+	t.Run("Bucket", func(t *testing.T) {
+		removed, err := fs.Purge("", true)
+		req.NoError(err)
+		req.Equal(2, removed)
+		req.Empty(mock.buckets["bucket"])
+	})
+}
@@ -0,0 +1,41 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// SlowDownRetryer retries requests with an exponential backoff and jitter, and waits longer on throttling errors
+// like the "503 SlowDown" S3 returns when the request rate is too high.
+type SlowDownRetryer struct {
+	client.DefaultRetryer
+}
+
+// NewSlowDownRetryer creates a SlowDownRetryer performing at most maxRetries retries
+func NewSlowDownRetryer(maxRetries int) *SlowDownRetryer {
+	return &SlowDownRetryer{DefaultRetryer: client.DefaultRetryer{
+		NumMaxRetries:    maxRetries,
+		MinRetryDelay:    30 * time.Millisecond,
+		MaxRetryDelay:    5 * time.Second,
+		MinThrottleDelay: 500 * time.Millisecond,
+		MaxThrottleDelay: 30 * time.Second,
+	}}
+}
+
+// ShouldRetry retries the errors the default retryer retries, and the SlowDown errors
+func (r *SlowDownRetryer) ShouldRetry(req *request.Request) bool {
+	if r.NumMaxRetries > 0 && isSlowDown(req.Error) {
+		return true
+	}
+	return r.DefaultRetryer.ShouldRetry(req)
+}
+
+func isSlowDown(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == "SlowDown"
+}
@@ -0,0 +1,86 @@
+package s3
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowDownRetryer(t *testing.T) {
+	req := require.New(t)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+		Endpoint:    aws.String("http://localhost:9000"),
+		Region:      aws.String("eu-west-1"),
+		MaxRetries:  aws.Int(0),
+	})
+	req.NoError(err)
+
+	// The first two attempts are throttled
+	attempts := 0
+	var delays []time.Duration
+	api := s3.New(sess)
+	api.Handlers.Send.Clear()
+	api.Handlers.Send.PushBack(func(r *request.Request) {
+		attempts++
+		if attempts <= 2 {
+			r.HTTPResponse = &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header:     http.Header{},
+				Body: io.NopCloser(strings.NewReader(
+					"<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>",
+				)),
+			}
+			return
+		}
+		r.HTTPResponse = &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Content-Length": []string{"5"},
+				"Last-Modified":  []string{time.Now().UTC().Format(http.TimeFormat)},
+			},
+			Body: http.NoBody,
+		}
+	})
+	api.Handlers.AfterRetry.PushBack(func(r *request.Request) {
+		if r.Error == nil && aws.BoolValue(r.Retryable) {
+			delays = append(delays, r.RetryDelay)
+		}
+	})
+
+	retryer := NewSlowDownRetryer(3)
+	retryer.MinThrottleDelay = 5 * time.Millisecond
+	retryer.MaxThrottleDelay = 50 * time.Millisecond
+	fs := NewFsWithOptions("bucket", sess, WithS3API(api), WithRetryer(retryer))
+
+	info, err := fs.Stat("file")
+	req.NoError(err)
+	req.EqualValues(5, info.Size())
+	req.Equal(3, attempts)
+	req.Len(delays, 2)
+	for _, delay := range delays {
+		req.GreaterOrEqual(delay, 5*time.Millisecond)
+	}
+
+	t.Run("Exhausted", func(t *testing.T) {
+		attempts = -10
+		fs.Retryer = &SlowDownRetryer{DefaultRetryer: client.DefaultRetryer{
+			NumMaxRetries:    1,
+			MinThrottleDelay: time.Millisecond,
+		}}
+		_, err := fs.Stat("file")
+		req.Error(err)
+		req.Equal(-8, attempts)
+	})
+}
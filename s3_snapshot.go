@@ -0,0 +1,135 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectSnapshot holds the properties of a file, as exported by Export to recreate it later with Import
+type ObjectSnapshot struct {
+	ContentType     string            // ContentType is the Content-Type header
+	ContentEncoding string            // ContentEncoding is the Content-Encoding header
+	CacheControl    string            // CacheControl is the Cache-Control header
+	Expires         *time.Time        // Expires is the Expires header, when set
+	Metadata        map[string]string // Metadata is the user metadata
+	StorageClass    string            // StorageClass is empty for the STANDARD storage class
+	Tags            map[string]string // Tags are the tags of the file
+	Grants          []Grant           // Grants are the grants of the ACL of the file
+}
+
+// Export returns the properties of a file, to back them up along with its content. It performs a HeadObject, a
+// GetObjectTagging and a GetObjectAcl.
+func (fs *Fs) Export(name string) (*ObjectSnapshot, error) {
+	if name = fs.sanitize(name); isRoot(name) {
+		return nil, rootError("export", name)
+	}
+
+	head, err := fs.headObject(name)
+	if isNotFound(err) {
+		return nil, &os.PathError{Op: "export", Path: name, Err: os.ErrNotExist}
+	} else if err != nil {
+		return nil, &os.PathError{Op: "export", Path: name, Err: permissionError(err)}
+	}
+
+	snap := &ObjectSnapshot{
+		ContentType:     aws.StringValue(head.ContentType),
+		ContentEncoding: aws.StringValue(head.ContentEncoding),
+		CacheControl:    aws.StringValue(head.CacheControl),
+		Metadata:        aws.StringValueMap(head.Metadata),
+		StorageClass:    aws.StringValue(head.StorageClass),
+	}
+	if expires, err := http.ParseTime(aws.StringValue(head.Expires)); err == nil {
+		snap.Expires = &expires
+	}
+
+	if snap.Tags, err = fs.GetTags(name); err != nil {
+		// GetTags already reports the name, with its own operation
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return nil, &os.PathError{Op: "export", Path: name, Err: err}
+	}
+	if snap.Grants, err = fs.GetACLGrants(name); err != nil {
+		return nil, &os.PathError{Op: "export", Path: name, Err: err}
+	}
+	return snap, nil
+}
+
+// Import writes a file with the properties of a snapshot, given by Export, instead of the ones of the file properties.
+// The grants of the snapshot replace the ACL of the file properties, and are given to the same grantees, including
+// the owner of the exported file.
+func (fs *Fs) Import(name string, snap *ObjectSnapshot, body io.Reader) error {
+	if name = fs.sanitize(name); isRoot(name) {
+		return rootError("import", name)
+	}
+	fs.invalidate(name)
+
+	input := fs.uploadInput(name, body)
+	if snap.ContentType != "" {
+		input.ContentType = aws.String(snap.ContentType)
+	}
+	if snap.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(snap.ContentEncoding)
+	}
+	if snap.CacheControl != "" {
+		input.CacheControl = aws.String(snap.CacheControl)
+	}
+	if snap.StorageClass != "" {
+		input.StorageClass = aws.String(snap.StorageClass)
+	}
+	input.Expires = snap.Expires
+	input.Metadata = aws.StringMap(snap.Metadata)
+	if len(snap.Tags) > 0 {
+		tags := url.Values{}
+		for key, value := range snap.Tags {
+			tags.Set(key, value)
+		}
+		input.Tagging = aws.String(tags.Encode())
+	}
+	if len(snap.Grants) > 0 {
+		// S3 doesn't accept both a canned ACL and grants
+		input.ACL = nil
+		input.GrantRead = grantHeader(snap.Grants, s3.PermissionRead)
+		input.GrantReadACP = grantHeader(snap.Grants, s3.PermissionReadAcp)
+		input.GrantWriteACP = grantHeader(snap.Grants, s3.PermissionWriteAcp)
+		input.GrantFullControl = grantHeader(snap.Grants, s3.PermissionFullControl)
+	}
+
+	if err := fs.upload(input, fs.S3API); err != nil {
+		return &os.PathError{Op: "import", Path: name, Err: err}
+	}
+	return nil
+}
+
+// grantHeader returns the grantees given a permission, in the format of the x-amz-grant headers, or nil
+func grantHeader(grants []Grant, permission string) *string {
+	var grantees []string
+	for _, g := range grants {
+		if g.Permission != permission {
+			continue
+		}
+		switch {
+		case g.GranteeID != "":
+			grantees = append(grantees, fmt.Sprintf("id=%q", g.GranteeID))
+		case g.URI != "":
+			grantees = append(grantees, fmt.Sprintf("uri=%q", g.URI))
+		case g.EmailAddress != "":
+			grantees = append(grantees, fmt.Sprintf("emailAddress=%q", g.EmailAddress))
+		}
+	}
+	if len(grantees) == 0 {
+		return nil
+	}
+	return aws.String(strings.Join(grantees, ", "))
+}
@@ -0,0 +1,98 @@
+package s3
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithFileProps(&UploadedFileProperties{ACL: aws.String(s3.ObjectCannedACLPrivate)}))
+
+	owner := "79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be"
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, size := range []int{7, partSize + 1} {
+		content := bytes.Repeat([]byte("x"), size)
+		obj := mock.putObject("bucket", "site/index.html.gz", content, time.Now())
+		obj.contentType = aws.String("text/html")
+		obj.contentEncoding = aws.String("gzip")
+		obj.cacheControl = aws.String("max-age=3600")
+		obj.expires = aws.String(expires.Format(http.TimeFormat))
+		obj.metadata = map[string]*string{"Author": aws.String("me")}
+		obj.storageClass = aws.String(s3.StorageClassStandardIa)
+		obj.tagging = aws.String("env=prod&team=web")
+		obj.grants = []*s3.Grant{
+			{
+				Grantee:    &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String(owner)},
+				Permission: aws.String(s3.PermissionFullControl),
+			},
+			{
+				Grantee: &s3.Grantee{
+					Type: aws.String(s3.TypeGroup), URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers"),
+				},
+				Permission: aws.String(s3.PermissionRead),
+			},
+		}
+
+		snap, err := fs.Export("/site/index.html.gz")
+		req.NoError(err)
+		req.Equal("text/html", snap.ContentType)
+		req.Equal("gzip", snap.ContentEncoding)
+		req.Equal("max-age=3600", snap.CacheControl)
+		req.Equal(expires, *snap.Expires)
+		req.Equal(map[string]string{"Author": "me"}, snap.Metadata)
+		req.Equal(s3.StorageClassStandardIa, snap.StorageClass)
+		req.Equal(map[string]string{"env": "prod", "team": "web"}, snap.Tags)
+		req.Len(snap.Grants, 2)
+
+		req.NoError(fs.RemoveAll("/site"))
+		req.Nil(mock.getObject("bucket", "site/index.html.gz"))
+
+		req.NoError(fs.Import("/site/index.html.gz", snap, bytes.NewReader(content)))
+		restored := mock.getObject("bucket", "site/index.html.gz")
+		req.Equal(content, restored.body)
+		req.Nil(restored.acl)
+
+		again, err := fs.Export("/site/index.html.gz")
+		req.NoError(err)
+		req.ElementsMatch(snap.Grants, again.Grants)
+		snap.Grants, again.Grants = nil, nil
+		req.Equal(snap, again)
+	}
+
+	_, err := fs.Export("/missing")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	for _, op := range []string{"GetObjectTagging", "GetObjectAcl"} {
+		mock.hook = func(called string, _ interface{}) error {
+			if called == op {
+				return awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "mock")
+			}
+			return nil
+		}
+		_, err = fs.Export("/site/index.html.gz")
+		req.ErrorIs(err, os.ErrPermission, op)
+		var pathErr *os.PathError
+		req.ErrorAs(err, &pathErr, op)
+		req.Equal("export", pathErr.Op, op)
+		req.Equal("/site/index.html.gz", pathErr.Path, op)
+	}
+	mock.hook = nil
+
+	// Without any property, the file is written like any other
+	req.NoError(fs.Import("/plain.txt", &ObjectSnapshot{}, strings.NewReader("content")))
+	plain := mock.getObject("bucket", "plain.txt")
+	req.Equal("text/plain; charset=utf-8", aws.StringValue(plain.contentType))
+	req.Equal(s3.ObjectCannedACLPrivate, aws.StringValue(plain.acl))
+	req.Nil(plain.tagging)
+}
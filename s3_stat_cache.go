@@ -0,0 +1,78 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statCache keeps the FileInfo listed by Readdir for a short time, so that following Stat calls don't require any
+// request. All its methods can be called on a nil statCache, which is a disabled cache.
+type statCache struct {
+	mu      sync.Mutex
+	entries map[string]statCacheEntry
+	ttl     time.Duration
+}
+
+type statCacheEntry struct {
+	expires time.Time
+	info    os.FileInfo
+}
+
+func newStatCache(ttl time.Duration) *statCache {
+	return &statCache{
+		entries: map[string]statCacheEntry{},
+		ttl:     ttl,
+	}
+}
+
+// statCacheKey makes "/dir/file", "dir/file" and "dir/file/" the same entry
+func statCacheKey(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func (c *statCache) get(name string) (os.FileInfo, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := statCacheKey(name)
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.info, true
+}
+
+// addDir saves the FileInfo listed in a directory
+func (c *statCache) addDir(dir string, infos []os.FileInfo) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	for _, info := range infos {
+		c.entries[statCacheKey(path.Join(dir, info.Name()))] = statCacheEntry{expires: expires, info: info}
+	}
+}
+
+func (c *statCache) invalidate(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, statCacheKey(name))
+}
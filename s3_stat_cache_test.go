@@ -0,0 +1,66 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatCache(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithStatCache(time.Minute))
+
+	mock.putObject("bucket", "dir/file", []byte("content"), time.Now())
+	mock.putObject("bucket", "dir/sub/file", []byte("content"), time.Now())
+
+	dir, err := fs.Open("/dir")
+	req.NoError(err)
+	fis, err := dir.Readdir(-1)
+	req.NoError(err)
+	req.Len(fis, 2)
+
+	mock.resetCalls()
+
+	info, err := fs.Stat("/dir/file")
+	req.NoError(err)
+	req.False(info.IsDir())
+	req.Equal(int64(7), info.Size())
+
+	info, err = fs.Stat("dir/sub/")
+	req.NoError(err)
+	req.True(info.IsDir())
+
+	req.Empty(mock.calls)
+
+	t.Run("Invalidation", func(t *testing.T) {
+		req.NoError(fs.Remove("/dir/file"))
+		_, err := fs.Stat("/dir/file")
+		req.Error(err)
+	})
+
+	t.Run("Expiration", func(t *testing.T) {
+		cache := newStatCache(time.Millisecond)
+		cache.addDir("/dir", fis)
+		_, ok := cache.get("/dir/file")
+		req.True(ok)
+		time.Sleep(2 * time.Millisecond)
+		_, ok = cache.get("/dir/file")
+		req.False(ok)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		fs, mock := newMockFs(t)
+		mock.putObject("bucket", "dir/file", []byte("content"), time.Now())
+
+		dir, err := fs.Open("/dir")
+		req.NoError(err)
+		_, err = dir.Readdir(-1)
+		req.NoError(err)
+		mock.resetCalls()
+
+		_, err = fs.Stat("/dir/file")
+		req.NoError(err)
+		req.Equal(1, mock.count("HeadObject"))
+	})
+}
@@ -0,0 +1,103 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// statManyListThreshold is the number of files from which StatMany lists their common directory, instead of
+// performing a HeadObject per file
+var statManyListThreshold = 10
+
+// errStopWalk stops walkObjects without error
+var errStopWalk = errors.New("stop walk")
+
+// StatMany returns the FileInfo of many files, indexed by the given names. The files that don't exist are missing
+// from the result, and the ones that couldn't be looked up are reported in a *BatchError. When many files share a
+// common directory, they are looked up with a listing of the directory instead of a request per file. The files that
+// aren't listed, like directories, are still looked up one by one.
+func (fs *Fs) StatMany(names []string) (map[string]os.FileInfo, error) {
+	infos := make(map[string]os.FileInfo, len(names))
+
+	remaining := names
+	if len(names) >= statManyListThreshold {
+		var err error
+		if remaining, err = fs.statManyListing(names, infos); err != nil {
+			return nil, err
+		}
+	}
+
+	failed := &BatchError{}
+	for _, name := range remaining {
+		info, err := fs.Stat(name)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			failed.add(name, err)
+		default:
+			infos[name] = info
+		}
+	}
+	return infos, failed.errOrNil()
+}
+
+// statManyListing looks files up by listing their common directory, and returns the names of the files it didn't
+// find. Nothing is listed if they don't have a common directory.
+func (fs *Fs) statManyListing(names []string, infos map[string]os.FileInfo) ([]string, error) {
+	byName := make(map[string][]string, len(names))
+	var prefix, lastKey string
+	for i, name := range names {
+		clean := strings.TrimPrefix(fs.sanitize(name), "/")
+		byName[clean] = append(byName[clean], name)
+		if key := strings.TrimPrefix(fs.key(clean), "/"); key > lastKey {
+			lastKey = key
+		}
+		if i == 0 {
+			prefix = clean
+		} else {
+			prefix = commonPrefix(prefix, clean)
+		}
+	}
+
+	prefix = prefix[:strings.LastIndex(prefix, "/")+1]
+	if prefix == "" {
+		return names, nil
+	}
+
+	err := fs.walkObjects(prefix, func(obj *s3.Object) error {
+		// The keys are listed in order, the ones after the last file can't match
+		if *obj.Key > lastKey {
+			return errStopWalk
+		}
+		name := fs.keyName(*obj.Key)
+		for _, original := range byName[name] {
+			infos[original] = fs.newFileInfo(path.Base(name), false, *obj.Size, *obj.LastModified)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopWalk) {
+		return nil, err
+	}
+
+	var remaining []string
+	for _, name := range names {
+		if _, found := infos[name]; !found {
+			remaining = append(remaining, name)
+		}
+	}
+	return remaining, nil
+}
+
+// commonPrefix returns the longest prefix two strings share
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
@@ -0,0 +1,58 @@
+package s3
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatMany(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	var names []string
+	for i := 0; i < 12; i++ {
+		name := fmt.Sprintf("/dir/file-%02d", i)
+		mock.putObject("bucket", name[1:], []byte(name), time.Now())
+		names = append(names, name)
+	}
+	mock.putObject("bucket", "dir/sub/file", []byte("content"), time.Now())
+	mock.putObject("bucket", "other/file", []byte("content"), time.Now())
+	names = append(names, "/dir/sub", "/dir/missing")
+	mock.resetCalls()
+
+	infos, err := fs.StatMany(names)
+	req.NoError(err)
+	req.Len(infos, 13)
+	for _, name := range names[:12] {
+		req.Equal(int64(len(name)), infos[name].Size(), name)
+		req.False(infos[name].IsDir())
+	}
+	req.True(infos["/dir/sub"].IsDir())
+	req.NotContains(infos, "/dir/missing")
+
+	// A single listing finds the files, the directory and the missing file are looked up one by one
+	req.Equal(2, mock.count("HeadObject"))
+	req.Equal("dir/", aws.StringValue(mock.inputs["ListObjectsV2"][0].(*s3.ListObjectsV2Input).Prefix))
+
+	t.Run("FewFiles", func(t *testing.T) {
+		mock.resetCalls()
+		infos, err := fs.StatMany([]string{"/dir/file-00", "/dir/file-01", "/other/file"})
+		req.NoError(err)
+		req.Len(infos, 3)
+		req.Equal(3, mock.count("HeadObject"))
+		req.Zero(mock.count("ListObjectsV2"))
+	})
+
+	t.Run("NoCommonDirectory", func(t *testing.T) {
+		mock.resetCalls()
+		infos, err := fs.StatMany(append([]string{"/other/file"}, names[:12]...))
+		req.NoError(err)
+		req.Len(infos, 13)
+		req.Equal(13, mock.count("HeadObject"))
+	})
+}
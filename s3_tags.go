@@ -0,0 +1,60 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// GetTags returns the tags of a file
+func (fs *Fs) GetTags(name string) (map[string]string, error) {
+	if name = fs.sanitize(name); isRoot(name) {
+		return nil, rootError("gettags", name)
+	}
+
+	out, err := fs.S3API.GetObjectTaggingWithContext(aws.BackgroundContext(), &s3.GetObjectTaggingInput{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+		Key:                 aws.String(fs.key(name)),
+	}, fs.requestOptions()...)
+	if isNotFound(err) {
+		return nil, &os.PathError{Op: "gettags", Path: name, Err: os.ErrNotExist}
+	} else if err != nil {
+		return nil, &os.PathError{Op: "gettags", Path: name, Err: permissionError(err)}
+	}
+
+	tags := make(map[string]string, len(out.TagSet))
+	for _, tag := range out.TagSet {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags, nil
+}
+
+// SetTags replaces all the tags of a file, an empty set removes them. S3 accepts up to 10 tags per file.
+func (fs *Fs) SetTags(name string, tags map[string]string) error {
+	if name = fs.sanitize(name); isRoot(name) {
+		return rootError("settags", name)
+	}
+
+	tagSet := make([]*s3.Tag, 0, len(tags))
+	for key, value := range tags {
+		tagSet = append(tagSet, &s3.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	sort.Slice(tagSet, func(i, j int) bool { return *tagSet[i].Key < *tagSet[j].Key })
+
+	_, err := fs.S3API.PutObjectTaggingWithContext(aws.BackgroundContext(), &s3.PutObjectTaggingInput{
+		Bucket:              aws.String(fs.Bucket),
+		ExpectedBucketOwner: fs.ExpectedBucketOwner,
+		Key:                 aws.String(fs.key(name)),
+		Tagging:             &s3.Tagging{TagSet: tagSet},
+	}, fs.requestOptions()...)
+	if isNotFound(err) {
+		return &os.PathError{Op: "settags", Path: name, Err: os.ErrNotExist}
+	} else if err != nil {
+		return &os.PathError{Op: "settags", Path: name, Err: permissionError(err)}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package s3
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTags(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+	mock.putObject("bucket", "file", []byte("content"), time.Now())
+
+	tags, err := fs.GetTags("/file")
+	req.NoError(err)
+	req.Empty(tags)
+
+	req.NoError(fs.SetTags("/file", map[string]string{"project": "afero", "env": "test & prod"}))
+	tags, err = fs.GetTags("/file")
+	req.NoError(err)
+	req.Equal(map[string]string{"project": "afero", "env": "test & prod"}, tags)
+
+	// The tags are replaced
+	req.NoError(fs.SetTags("/file", map[string]string{"env": "dev"}))
+	tags, err = fs.GetTags("/file")
+	req.NoError(err)
+	req.Equal(map[string]string{"env": "dev"}, tags)
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := fs.GetTags("/missing")
+		req.ErrorIs(err, os.ErrNotExist)
+		req.ErrorIs(fs.SetTags("/missing", map[string]string{"env": "dev"}), os.ErrNotExist)
+	})
+}
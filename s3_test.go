@@ -70,12 +70,12 @@ func __getS3Fs(t *testing.T) *Fs {
 	fs := NewFs(bucketName, sess)
 
 	t.Cleanup(func() {
-		if err := fs.RemoveAll("/"); err != nil {
+		if _, err := fs.Purge("/", true); err != nil {
 			t.Fatal("Could not cleanup bucket:", err)
 			return
 		}
 
-		// The minio implementation makes the RemoveAll("/") also delete the simulated S3 bucket, so we *should* but
+		// The minio implementation makes the Purge("/") also delete the simulated S3 bucket, so we *should* but
 		// *can't* use the bucket deletion.
 		// if _, err := s3Client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(bucketName)}); err != nil {
 		//   t.Fatal("Could not delete bucket:", err)
@@ -486,6 +486,7 @@ func TestBadConnection(t *testing.T) {
 
 	// Let's mess-up the config
 	fs.Session.Config.Endpoint = aws.String("http://broken")
+	fs.S3API = s3.New(fs.Session)
 
 	t.Run("Read", func(t *testing.T) {
 		// We will fail here because we are checking if the file exists and its type
@@ -552,7 +553,7 @@ func TestFileStat(t *testing.T) {
 	} else {
 		if stat, err := file1.Stat(); err != nil {
 			t.Fatal(err)
-		} else if stat.Mode() != 0664 {
+		} else if stat.Mode() != 0644 {
 			t.Fatal("Wrong file mode")
 		}
 	}
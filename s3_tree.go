@@ -0,0 +1,133 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/spf13/afero"
+)
+
+// UploadTree uploads all the files of a directory of another afero.Fs, like a local one, under a prefix. The files
+// keep their path relative to the directory, and are written with the file properties and a Content-Type guessed
+// from their extension. Directories get a marker, so that empty ones are kept. Files failing to be uploaded are
+// reported in a *BatchError.
+func (fs *Fs) UploadTree(src afero.Fs, srcDir, dstPrefix string) error {
+	failed := &BatchError{}
+	err := afero.Walk(src, srcDir, func(srcPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcDir, srcPath)
+		if err != nil {
+			return err
+		}
+		name := fs.sanitize(path.Join(dstPrefix, filepath.ToSlash(rel)))
+
+		if info.IsDir() {
+			if errMkdir := fs.Mkdir(name, info.Mode()); errMkdir != nil {
+				failed.add(name, errMkdir)
+			}
+			return nil
+		}
+
+		if errUpload := fs.uploadFrom(src, srcPath, name); errUpload != nil {
+			failed.add(name, errUpload)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return failed.errOrNil()
+}
+
+// uploadFrom uploads a file of another afero.Fs
+func (fs *Fs) uploadFrom(src afero.Fs, srcPath, name string) error {
+	file, err := src.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	fs.invalidate(name)
+	return fs.upload(fs.uploadInput(name, file), fs.S3API)
+}
+
+// DownloadTree downloads all the files under a directory into a directory of another afero.Fs, like a local one. The
+// files keep their path relative to the directory, and the missing parent directories are created. Files failing to
+// be downloaded, and the ones whose key would be written outside of the destination directory, like "dir/../../file",
+// are reported in a *BatchError.
+func (fs *Fs) DownloadTree(dst afero.Fs, srcPrefix, dstDir string) error {
+	dir := strings.Trim(fs.sanitize(srcPrefix), "/")
+	if dir != "" {
+		dir += "/"
+	}
+
+	failed := &BatchError{}
+	err := fs.walkAllObjects(dir, func(obj *s3.Object) error {
+		name := fs.keyName(*obj.Key)
+		rel := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(name, dir)))
+		if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			failed.add(name, &os.PathError{Op: "download", Path: name, Err: os.ErrInvalid})
+			return nil
+		}
+		dstPath := filepath.Join(dstDir, rel)
+
+		// Directory markers keep the empty directories
+		if strings.HasSuffix(name, "/") {
+			if errMkdir := dst.MkdirAll(dstPath, 0o755); errMkdir != nil {
+				failed.add(name, errMkdir)
+			}
+			return nil
+		}
+
+		if errDownload := fs.downloadTo(name, dst, dstPath); errDownload != nil {
+			failed.add(name, errDownload)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return failed.errOrNil()
+}
+
+// downloadTo writes a file into another afero.Fs, with a single request
+func (fs *Fs) downloadTo(name string, dst afero.Fs, dstPath string) error {
+	if err := dst.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+		return err
+	}
+
+	resp, err := fs.S3API.GetObjectWithContext(aws.BackgroundContext(), &s3.GetObjectInput{
+		Bucket:               aws.String(fs.Bucket),
+		ExpectedBucketOwner:  fs.ExpectedBucketOwner,
+		Key:                  aws.String(fs.key(name)),
+		SSECustomerAlgorithm: fs.sseCustomerAlgorithm(),
+		SSECustomerKey:       fs.sseCustomerKey(),
+	}, fs.requestOptions()...)
+	if err != nil {
+		return permissionError(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	file, err := dst.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,102 @@
+package s3
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadTree(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithFileProps(&UploadedFileProperties{CacheControl: aws.String("max-age=60")}))
+
+	src := afero.NewMemMapFs()
+	req.NoError(afero.WriteFile(src, "/site/index.html", []byte("<html></html>"), 0o644))
+	req.NoError(afero.WriteFile(src, "/site/css/style.css", []byte("body {}"), 0o644))
+	req.NoError(afero.WriteFile(src, "/site/js/app/main.js", []byte("main()"), 0o644))
+	req.NoError(src.MkdirAll("/site/empty", 0o755))
+	req.NoError(afero.WriteFile(src, "/other/file", []byte("other"), 0o644))
+
+	req.NoError(fs.UploadTree(src, "/site", "/www"))
+
+	for key, content := range map[string]string{
+		"www/index.html":     "<html></html>",
+		"www/css/style.css":  "body {}",
+		"www/js/app/main.js": "main()",
+	} {
+		obj := mock.getObject("bucket", key)
+		req.NotNil(obj, key)
+		req.Equal(content, string(obj.body))
+		req.Equal("max-age=60", aws.StringValue(obj.cacheControl))
+	}
+	req.Equal("text/html; charset=utf-8", aws.StringValue(mock.getObject("bucket", "www/index.html").contentType))
+	req.Equal("text/css; charset=utf-8", aws.StringValue(mock.getObject("bucket", "www/css/style.css").contentType))
+	req.NotNil(mock.getObject("bucket", "www/empty/"))
+	req.Nil(mock.getObject("bucket", "www/other/file"))
+	req.Nil(mock.getObject("bucket", "other/file"))
+}
+
+func TestDownloadTree(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	mock.putObject("bucket", "backup/", nil, time.Now())
+	mock.putObject("bucket", "backup/db.sql", []byte("CREATE TABLE"), time.Now())
+	mock.putObject("bucket", "backup/logs/2021/app.log", []byte("started"), time.Now())
+	mock.putObject("bucket", "backup/empty/", nil, time.Now())
+	mock.putObject("bucket", "backup-old/db.sql", []byte("old"), time.Now())
+
+	dst := afero.NewMemMapFs()
+	req.NoError(fs.DownloadTree(dst, "/backup", "/restore"))
+
+	for name, content := range map[string]string{
+		"/restore/db.sql":            "CREATE TABLE",
+		"/restore/logs/2021/app.log": "started",
+	} {
+		data, err := afero.ReadFile(dst, name)
+		req.NoError(err, name)
+		req.Equal(content, string(data))
+	}
+
+	info, err := dst.Stat("/restore/empty")
+	req.NoError(err)
+	req.True(info.IsDir())
+
+	var files []string
+	req.NoError(afero.Walk(dst, "/", func(name string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, name)
+		}
+		return err
+	}))
+	req.ElementsMatch([]string{"/restore/db.sql", "/restore/logs/2021/app.log"}, files)
+}
+
+func TestDownloadTreeEscaping(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t)
+
+	mock.putObject("bucket", "backup/db.sql", []byte("CREATE TABLE"), time.Now())
+	mock.putObject("bucket", "backup/../../evil", []byte("evil"), time.Now())
+	mock.putObject("bucket", "backup/logs/../../../evil-dir/", nil, time.Now())
+
+	dst := afero.NewMemMapFs()
+	err := fs.DownloadTree(dst, "/backup", "/restore/here")
+
+	var batchErr *BatchError
+	req.ErrorAs(err, &batchErr)
+	req.Len(batchErr.Errors, 2)
+	req.ErrorIs(batchErr.Errors["backup/../../evil"], os.ErrInvalid)
+	req.ErrorIs(batchErr.Errors["backup/logs/../../../evil-dir/"], os.ErrInvalid)
+
+	var names []string
+	req.NoError(afero.Walk(dst, "/", func(name string, info os.FileInfo, err error) error {
+		names = append(names, name)
+		return err
+	}))
+	req.ElementsMatch([]string{"/", "/restore", "/restore/here", "/restore/here/db.sql"}, names)
+}
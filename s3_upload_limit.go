@@ -0,0 +1,74 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// uploadLimiter limits the number of requests sending content at the same time, the PutObject and UploadPart ones,
+// with slots shared by all the writes of an Fs. The other requests of the uploads, like the ones starting and
+// completing multipart uploads, aren't limited.
+type uploadLimiter struct {
+	s3iface.S3API
+	slots chan struct{}
+}
+
+// acquire waits for a free slot, or for the context to be done
+func (l *uploadLimiter) acquire(ctx aws.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *uploadLimiter) release() {
+	<-l.slots
+}
+
+func (l *uploadLimiter) PutObjectWithContext(
+	ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option,
+) (*s3.PutObjectOutput, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return l.S3API.PutObjectWithContext(ctx, in, opts...)
+}
+
+// PutObjectRequest is used by the uploader for uploads fitting in a single part. Each attempt to send the request
+// holds a slot, which is acquired before it's signed so that its signature doesn't expire while waiting, and a request
+// failing to acquire it isn't sent.
+func (l *uploadLimiter) PutObjectRequest(in *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput) {
+	req, out := l.S3API.PutObjectRequest(in)
+
+	held := false
+	req.Handlers.Sign.PushFront(func(r *request.Request) {
+		if err := l.acquire(r.Context()); err != nil {
+			r.Error = err
+			return
+		}
+		held = true
+	})
+	req.Handlers.CompleteAttempt.PushBack(func(*request.Request) {
+		if held {
+			held = false
+			l.release()
+		}
+	})
+	return req, out
+}
+
+func (l *uploadLimiter) UploadPartWithContext(
+	ctx aws.Context, in *s3.UploadPartInput, opts ...request.Option,
+) (*s3.UploadPartOutput, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return l.S3API.UploadPartWithContext(ctx, in, opts...)
+}
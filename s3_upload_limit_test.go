@@ -0,0 +1,112 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+// activeS3 tracks the maximum number of requests sending content at the same time, which take some time
+type activeS3 struct {
+	*mockS3
+	active    int32
+	maxActive int32
+}
+
+func (m *activeS3) enter() {
+	active := atomic.AddInt32(&m.active, 1)
+	for {
+		maxActive := atomic.LoadInt32(&m.maxActive)
+		if active <= maxActive || atomic.CompareAndSwapInt32(&m.maxActive, maxActive, active) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+}
+
+func (m *activeS3) leave() {
+	atomic.AddInt32(&m.active, -1)
+}
+
+func (m *activeS3) PutObjectWithContext(
+	ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option,
+) (*s3.PutObjectOutput, error) {
+	m.enter()
+	defer m.leave()
+	return m.mockS3.PutObjectWithContext(ctx, in, opts...)
+}
+
+func (m *activeS3) PutObjectRequest(in *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput) {
+	req, out := m.mockS3.PutObjectRequest(in)
+	req.Handlers.Send.PushFront(func(*request.Request) { m.enter() })
+	req.Handlers.Send.PushBack(func(*request.Request) { m.leave() })
+	return req, out
+}
+
+func (m *activeS3) UploadPartWithContext(
+	ctx aws.Context, in *s3.UploadPartInput, opts ...request.Option,
+) (*s3.UploadPartOutput, error) {
+	m.enter()
+	defer m.leave()
+	return m.mockS3.UploadPartWithContext(ctx, in, opts...)
+}
+
+func TestMaxConcurrentUploads(t *testing.T) {
+	req := require.New(t)
+
+	upload := func(opts ...Option) (*mockS3, int32) {
+		api := &activeS3{mockS3: newMockS3()}
+		fs := NewFsWithOptions("bucket", nil, append([]Option{WithS3API(api)}, opts...)...)
+
+		errs := make(chan error, 30)
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(3)
+			go func(i int) {
+				defer wg.Done()
+				_, err := fs.PutBytes(fmt.Sprintf("/put/%d", i), []byte("content"))
+				errs <- err
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				errs <- fs.UploadReaderAt(fmt.Sprintf("/upload/%d", i), bytes.NewReader([]byte("content")), 7)
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				file, err := fs.OpenFile(fmt.Sprintf("/parts/%d", i), os.O_WRONLY, 0)
+				if err == nil {
+					_, err = file.Write(make([]byte, partSize+1))
+				}
+				if err == nil {
+					err = file.Close()
+				}
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			req.NoError(err)
+		}
+		return api.mockS3, atomic.LoadInt32(&api.maxActive)
+	}
+
+	mock, maxActive := upload(WithMaxConcurrentUploads(3))
+	req.Equal(int32(3), maxActive)
+	req.Equal(10, mock.count("CreateMultipartUpload"))
+	req.Equal(20, mock.count("UploadPart"))
+	req.Len(mock.buckets["bucket"], 30)
+
+	// Without limit, the uploads are only limited by the number of files
+	_, maxActive = upload()
+	req.Greater(maxActive, int32(3))
+}
@@ -0,0 +1,108 @@
+// Package s3 brings S3 files handling to afero
+package s3
+
+import (
+	"container/list"
+	"path"
+	"sync"
+	"time"
+)
+
+// writeCache keeps the content of the files written recently, so that they can be read back without any request
+// and without being exposed to eventual consistency. The least recently used files are evicted once the cache holds
+// more than maxBytes. All its methods can be called on a nil writeCache, which is a disabled cache.
+type writeCache struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List // lru has the most recently used entries at the front
+	ttl      time.Duration
+	maxBytes int64
+	size     int64 // size is the sum of the sizes of the entries
+}
+
+type writeCacheEntry struct {
+	key     string
+	expires time.Time
+	content []byte
+	info    FileInfo
+}
+
+func newWriteCache(ttl time.Duration, maxBytes int64) *writeCache {
+	return &writeCache{
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+		ttl:      ttl,
+		maxBytes: maxBytes,
+	}
+}
+
+// accepts tells if a file of a given size can be cached
+func (c *writeCache) accepts(size int) bool {
+	return c != nil && int64(size) <= c.maxBytes
+}
+
+func (c *writeCache) get(name string) (*writeCacheEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[statCacheKey(name)]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*writeCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// add saves the content written to a file
+func (c *writeCache) add(name string, content []byte) {
+	if !c.accepts(len(content)) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := statCacheKey(name)
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	now := time.Now()
+	c.entries[key] = c.lru.PushFront(&writeCacheEntry{
+		key:     key,
+		expires: now.Add(c.ttl),
+		content: content,
+		info:    NewFileInfo(path.Base(name), false, int64(len(content)), now),
+	})
+	c.size += int64(len(content))
+
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *writeCache) invalidate(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[statCacheKey(name)]; ok {
+		c.remove(elem)
+	}
+}
+
+// remove drops an entry, the lock must be held
+func (c *writeCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*writeCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.content))
+}
@@ -0,0 +1,78 @@
+package s3
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCache(t *testing.T) {
+	req := require.New(t)
+	fs, mock := newMockFs(t, WithWriteCache(time.Minute, 16))
+
+	testCreateFile(t, fs, "/dir/file.txt", "content")
+	mock.resetCalls()
+
+	file, err := fs.Open("/dir/file.txt")
+	req.NoError(err)
+	content, err := io.ReadAll(file)
+	req.NoError(err)
+	req.Equal("content", string(content))
+
+	buf := make([]byte, 4)
+	n, err := file.ReadAt(buf, 3)
+	req.NoError(err)
+	req.Equal("tent", string(buf[:n]))
+	req.NoError(file.Close())
+
+	info, err := fs.Stat("dir/file.txt")
+	req.NoError(err)
+	req.Equal(int64(7), info.Size())
+	req.Empty(mock.calls)
+
+	t.Run("Invalidation", func(t *testing.T) {
+		req.NoError(fs.Rename("/dir/file.txt", "/dir/renamed.txt"))
+		_, err := fs.Stat("/dir/file.txt")
+		req.Error(err)
+
+		testCreateFile(t, fs, "/other.txt", "other")
+		req.NoError(fs.Remove("/other.txt"))
+		_, err = fs.Open("/other.txt")
+		req.Error(err)
+	})
+
+	t.Run("TooBig", func(t *testing.T) {
+		testCreateFile(t, fs, "/big.txt", "more than sixteen bytes")
+		mock.resetCalls()
+		content, err := afero.ReadFile(fs, "/big.txt")
+		req.NoError(err)
+		req.Equal("more than sixteen bytes", string(content))
+		req.Equal(1, mock.count("GetObject"))
+	})
+
+	t.Run("Eviction", func(t *testing.T) {
+		cache := newWriteCache(time.Minute, 10)
+		cache.add("/a", []byte("aaaa"))
+		cache.add("/b", []byte("bbbb"))
+		_, ok := cache.get("/a")
+		req.True(ok)
+		cache.add("/c", []byte("cccc"))
+		_, ok = cache.get("/b")
+		req.False(ok)
+		_, ok = cache.get("/a")
+		req.True(ok)
+		req.Equal(int64(8), cache.size)
+	})
+
+	t.Run("Expiration", func(t *testing.T) {
+		cache := newWriteCache(time.Millisecond, 10)
+		cache.add("/a", []byte("aaaa"))
+		time.Sleep(2 * time.Millisecond)
+		_, ok := cache.get("/a")
+		req.False(ok)
+		req.Zero(cache.size)
+	})
+}